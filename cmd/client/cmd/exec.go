@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	pb "github.com/ilyazz/jobs/pkg/api/grpc/jobs/v1"
+	"github.com/ilyazz/jobs/pkg/client"
+	"github.com/spf13/cobra"
+)
+
+// execCmd represents the exec command
+var execCmd = &cobra.Command{
+	Use:   "exec JOB_ID -- COMMAND [ARGS...]",
+	Short: "Execute a command in a running job",
+	Long:  `Execute a command in the namespaces and cgroup of a running job, with the job identity. Exits with the command exit code`,
+	Run: func(cmd *cobra.Command, args []string) {
+		_, cfg, err := client.FindConfig(config)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "failed to load config\n")
+			os.Exit(1)
+		}
+
+		if len(args) < 2 {
+			_, _ = fmt.Fprintf(os.Stderr, "job_id and command required\n")
+			os.Exit(1)
+		}
+
+		cl, err := client.New(cfg)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "failed to connect: %v\n", err)
+			os.Exit(1)
+		}
+
+		stream, err := cl.Exec(context.Background())
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "failed to exec: %v\n", diagMessage(err))
+			os.Exit(1)
+		}
+
+		err = stream.Send(&pb.ExecRequest{Input: &pb.ExecRequest_Start{Start: &pb.ExecStart{
+			JobId:   args[0],
+			Command: args[1],
+			Args:    args[2:],
+		}}})
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "failed to exec: %v\n", diagMessage(err))
+			os.Exit(1)
+		}
+
+		if interactive {
+			go sendStdin(stream)
+		} else {
+			_ = stream.Send(&pb.ExecRequest{Input: &pb.ExecRequest_CloseStdin{CloseStdin: true}})
+		}
+
+		for {
+			rsp, err := stream.Recv()
+			if err != nil {
+				if err == io.EOF {
+					_, _ = fmt.Fprintf(os.Stderr, "no exit code received\n")
+				} else {
+					_, _ = fmt.Fprintf(os.Stderr, "failed to exec: %v\n", diagMessage(err))
+				}
+				os.Exit(1)
+			}
+
+			switch out := rsp.Output.(type) {
+			case *pb.ExecResponse_Stdout:
+				_, _ = os.Stdout.Write(out.Stdout)
+			case *pb.ExecResponse_Stderr:
+				_, _ = os.Stderr.Write(out.Stderr)
+			case *pb.ExecResponse_ExitCode:
+				os.Exit(int(out.ExitCode))
+			}
+		}
+	},
+}
+
+// sendStdin streams the local stdin to the command, and closes the command stdin on EOF
+func sendStdin(stream pb.JobService_ExecClient) {
+	data := make([]byte, 4096)
+	for {
+		n, err := os.Stdin.Read(data)
+		if n > 0 {
+			chunk := append([]byte(nil), data[:n]...)
+			if stream.Send(&pb.ExecRequest{Input: &pb.ExecRequest_Stdin{Stdin: chunk}}) != nil {
+				return
+			}
+		}
+		if err != nil {
+			_ = stream.Send(&pb.ExecRequest{Input: &pb.ExecRequest_CloseStdin{CloseStdin: true}})
+			return
+		}
+	}
+}
+
+var interactive bool
+
+func init() {
+	execCmd.PersistentFlags().BoolVarP(&interactive, "interactive", "i", false, "Send stdin to the command. Stdin of the command is closed otherwise.")
+	rootCmd.AddCommand(execCmd)
+}
@@ -7,6 +7,8 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	pb "github.com/ilyazz/jobs/pkg/api/grpc/jobs/v1"
 	"github.com/ilyazz/jobs/pkg/client"
@@ -54,6 +56,123 @@ ExitCode:	%v
 			rsp.Details.Command,
 			rsp.Details.Status,
 			rsp.Details.ExitCode)
+
+		if rsp.Details.Status == pb.Status_STATUS_QUEUED {
+			fmt.Printf("QueuePosition:\t%d\n", rsp.Details.QueuePosition)
+		}
+		if rsp.Details.Error != "" {
+			fmt.Printf("Error:\t\t%s\n", rsp.Details.Error)
+		}
+		if rsp.Details.ScheduleId != "" {
+			fmt.Printf("Schedule:\t%s\n", rsp.Details.ScheduleId)
+		}
+		if len(rsp.Details.Preemptions) > 0 {
+			fmt.Printf("Preemptions:\n")
+			for _, p := range rsp.Details.Preemptions {
+				fmt.Printf("  %s  by %s\n", p.At.AsTime().Local().Format(time.RFC3339), p.By)
+			}
+		}
+		if rsp.Details.ArrayId != "" {
+			fmt.Printf("Array:\t\t%s, task %d\n", rsp.Details.ArrayId, rsp.Details.ArrayIndex)
+		}
+
+		if a := rsp.Details.Array; a != nil {
+			fmt.Printf("Tasks:\t\t%d total, %d waiting, %d active, %d succeeded, %d failed, %d cancelled\n",
+				a.Total, a.Waiting, a.Active, a.Succeeded, a.Failed, a.Cancelled)
+			for _, t := range a.Tasks {
+				item := ""
+				if t.Item != "" {
+					item = fmt.Sprintf("  %q", t.Item)
+				}
+				fmt.Printf("  %-5d %s  %-15s exit code %d%s\n", t.Index, t.JobId, t.Status, t.ExitCode, item)
+			}
+			// the rest are the task details
+			return
+		}
+
+		fmt.Printf("User:\t\t%d:%d\n", rsp.Details.Uid, rsp.Details.Gid)
+		filter := rsp.Details.SeccompProfile
+		if filter == "" {
+			filter = "unconfined"
+		}
+		fmt.Printf("Seccomp:\t%s\n", filter)
+		caps := "none"
+		if len(rsp.Details.Capabilities) > 0 {
+			caps = strings.Join(rsp.Details.Capabilities, ",")
+		}
+		fmt.Printf("Capabilities:\t%s\n", caps)
+		if rsp.Details.Hostname != "" {
+			fmt.Printf("Hostname:\t%s\n", rsp.Details.Hostname)
+		}
+		fmt.Printf("Namespaces:\t%s\n", strings.Join(rsp.Details.Namespaces, ","))
+		fmt.Printf("Network:\t%s\n", rsp.Details.Network)
+		if rsp.Details.Address != "" {
+			fmt.Printf("Address:\t%s\n", rsp.Details.Address)
+		}
+		if len(rsp.Details.Egress) > 0 {
+			fmt.Printf("Egress:\n")
+			for _, r := range rsp.Details.Egress {
+				fmt.Printf("  %s\n", r)
+			}
+		}
+
+		if rsp.Details.DiskLimit > 0 {
+			fmt.Printf("Disk:\t\t%d of %d bytes\n", rsp.Details.DiskUsage, rsp.Details.DiskLimit)
+		} else {
+			fmt.Printf("Disk:\t\t%d bytes\n", rsp.Details.DiskUsage)
+		}
+
+		if len(rsp.Details.Pressure) > 0 {
+			fmt.Printf("Pressure:\n")
+			for _, p := range rsp.Details.Pressure {
+				fmt.Printf("  %-8s some avg10=%.2f avg60=%.2f avg300=%.2f  full avg10=%.2f avg60=%.2f avg300=%.2f\n",
+					p.Resource,
+					p.Some.GetAvg10(), p.Some.GetAvg60(), p.Some.GetAvg300(),
+					p.Full.GetAvg10(), p.Full.GetAvg60(), p.Full.GetAvg300())
+			}
+		}
+
+		if r := rsp.Details.Restart; r.GetMode() > pb.RestartMode_RESTART_MODE_NEVER {
+			retries := "unlimited"
+			if r.MaxRetries > 0 {
+				retries = fmt.Sprint(r.MaxRetries)
+			}
+			fmt.Printf("Restart:	%s, max retries: %s\n", r.Mode, retries)
+			if rsp.Details.NextRestart != nil {
+				fmt.Printf("NextRestart:	%s\n", rsp.Details.NextRestart.AsTime().Local().Format(time.RFC3339))
+			}
+		}
+
+		if len(rsp.Details.Attempts) > 1 || rsp.Details.Restart.GetMode() > pb.RestartMode_RESTART_MODE_NEVER {
+			fmt.Printf("Attempts:\n")
+			for i, a := range rsp.Details.Attempts {
+				started := a.Started.AsTime().Local().Format(time.RFC3339)
+				switch {
+				case a.Error != "":
+					fmt.Printf("  %d  %s  failed to start: %s\n", i+1, started, a.Error)
+				case a.Ended == nil:
+					fmt.Printf("  %d  %s  running\n", i+1, started)
+				default:
+					fmt.Printf("  %d  %s  exit code %d after %v, %d bytes of output\n", i+1, started, a.ExitCode,
+						a.Ended.AsTime().Sub(a.Started.AsTime()).Round(time.Millisecond), a.LogSize)
+				}
+			}
+		}
+
+		if len(rsp.Details.PressureEvents) > 0 {
+			fmt.Printf("PressureEvents:\n")
+			for _, e := range rsp.Details.PressureEvents {
+				kind := "some"
+				if e.Trigger.GetFull() {
+					kind = "full"
+				}
+				fmt.Printf("  %s  %s %s %v per %v\n",
+					e.Time.AsTime().Local().Format(time.RFC3339),
+					e.Trigger.GetResource(), kind,
+					time.Duration(e.Trigger.GetStallUs())*time.Microsecond,
+					time.Duration(e.Trigger.GetWindowUs())*time.Microsecond)
+			}
+		}
 	},
 }
 
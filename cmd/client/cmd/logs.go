@@ -37,7 +37,8 @@ var logsCmd = &cobra.Command{
 		rsp, err := cl.Logs(context.Background(), &pb.LogsRequest{
 			JobId: args[0],
 			Options: &pb.LogsOptions{
-				Follow: follow,
+				Follow:  follow,
+				Attempt: attempt,
 			},
 		})
 		if err != nil {
@@ -61,8 +62,10 @@ var logsCmd = &cobra.Command{
 }
 
 var follow bool
+var attempt int32
 
 func init() {
 	logsCmd.PersistentFlags().BoolVarP(&follow, "follow", "f", false, "follow mode")
+	logsCmd.PersistentFlags().Int32Var(&attempt, "attempt", 0, "Output of this attempt only, starting with 1. All the output if not set.")
 	rootCmd.AddCommand(logsCmd)
 }
@@ -0,0 +1,204 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	pb "github.com/ilyazz/jobs/pkg/api/grpc/jobs/v1"
+	"github.com/ilyazz/jobs/pkg/client"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+// pipelineFile is the pipeline definition file
+type pipelineFile struct {
+	Steps []struct {
+		Name          string   `yaml:"name"`
+		Command       string   `yaml:"command"`
+		Args          []string `yaml:"args"`
+		Image         string   `yaml:"image"`
+		Profile       string   `yaml:"profile"`
+		CPU           float32  `yaml:"cpu"`
+		Memory        int64    `yaml:"memory"`
+		Network       string   `yaml:"network"`
+		PriorityClass string   `yaml:"priorityClass"`
+		DependsOn     []struct {
+			Step      string `yaml:"step"`
+			Condition string `yaml:"condition"`
+		} `yaml:"dependsOn"`
+	} `yaml:"steps"`
+}
+
+// pipelineCmd represents the pipeline command
+var pipelineCmd = &cobra.Command{
+	Use:   "pipeline",
+	Short: "Run jobs with dependencies",
+	Long:  `Run a pipeline: a set of jobs, each started once the jobs it depends on are done with the required outcome: success, failure, or always`,
+}
+
+// pipelineRunCmd represents the pipeline run command
+var pipelineRunCmd = &cobra.Command{
+	Use:   "run FILE",
+	Short: "Start a pipeline defined in a YAML file",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			_, _ = fmt.Fprintf(os.Stderr, "pipeline file required\n")
+			os.Exit(1)
+		}
+
+		req, err := loadPipeline(args[0])
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "invalid pipeline file: %v\n", err)
+			os.Exit(1)
+		}
+
+		cl := mustConnect()
+		rsp, err := cl.StartPipeline(context.Background(), req)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "failed to start the pipeline: %v\n", diagMessage(err))
+			os.Exit(1)
+		}
+
+		fmt.Printf("Pipeline:\t%s\n", rsp.PipelineId)
+		printPipeline(rsp.Details)
+	},
+}
+
+// pipelineInspectCmd represents the pipeline inspect command
+var pipelineInspectCmd = &cobra.Command{
+	Use:   "inspect PIPELINE_ID",
+	Short: "Show the pipeline status and its steps",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			_, _ = fmt.Fprintf(os.Stderr, "pipeline_id required\n")
+			os.Exit(1)
+		}
+
+		cl := mustConnect()
+		rsp, err := cl.InspectPipeline(context.Background(), &pb.InspectPipelineRequest{PipelineId: args[0]})
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "failed to inspect the pipeline: %v\n", diagMessage(err))
+			os.Exit(1)
+		}
+
+		fmt.Printf("Pipeline:\t%s\n", args[0])
+		printPipeline(rsp.Details)
+	},
+}
+
+// pipelineStopCmd represents the pipeline stop command
+var pipelineStopCmd = &cobra.Command{
+	Use:   "stop PIPELINE_ID",
+	Short: "Stop a pipeline: skip the waiting steps, and stop the started step jobs",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			_, _ = fmt.Fprintf(os.Stderr, "pipeline_id required\n")
+			os.Exit(1)
+		}
+
+		cl := mustConnect()
+		if _, err := cl.StopPipeline(context.Background(), &pb.StopPipelineRequest{PipelineId: args[0]}); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "failed to stop the pipeline: %v\n", diagMessage(err))
+			os.Exit(1)
+		}
+	},
+}
+
+// mustConnect connects to the server, or exits
+func mustConnect() pb.JobServiceClient {
+	_, cfg, err := client.FindConfig(config)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "failed to load config\n")
+		os.Exit(1)
+	}
+
+	cl, err := client.New(cfg)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "failed to connect: %v\n", err)
+		os.Exit(1)
+	}
+	return cl
+}
+
+// loadPipeline reads the pipeline definition file
+func loadPipeline(path string) (*pb.StartPipelineRequest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var f pipelineFile
+	if err := yaml.UnmarshalStrict(data, &f); err != nil {
+		return nil, err
+	}
+
+	req := &pb.StartPipelineRequest{}
+	for _, st := range f.Steps {
+		if st.Command == "" {
+			return nil, fmt.Errorf("step %q: command required", st.Name)
+		}
+
+		nm, err := netMode(st.Network)
+		if err != nil {
+			return nil, fmt.Errorf("step %q: %w", st.Name, err)
+		}
+
+		var deps []*pb.Dependency
+		for _, d := range st.DependsOn {
+			c, err := condition(d.Condition)
+			if err != nil {
+				return nil, fmt.Errorf("step %q: %w", st.Name, err)
+			}
+			deps = append(deps, &pb.Dependency{Step: d.Step, Condition: c})
+		}
+
+		req.Steps = append(req.Steps, &pb.PipelineStep{
+			Name: st.Name,
+			Job: &pb.StartRequest{
+				Command:       st.Command,
+				Args:          st.Args,
+				Limits:        &pb.Limits{Cpus: st.CPU, Memory: st.Memory},
+				Image:         st.Image,
+				Profile:       st.Profile,
+				Network:       nm,
+				PriorityClass: st.PriorityClass,
+			},
+			DependsOn: deps,
+		})
+	}
+
+	return req, nil
+}
+
+// condition parses the dependency condition name
+func condition(name string) (pb.Condition, error) {
+	switch name {
+	case "", "success":
+		return pb.Condition_CONDITION_SUCCESS, nil
+	case "failure":
+		return pb.Condition_CONDITION_FAILURE, nil
+	case "always":
+		return pb.Condition_CONDITION_ALWAYS, nil
+	default:
+		return 0, fmt.Errorf("expected success, failure or always condition, got %q", name)
+	}
+}
+
+// printPipeline prints the pipeline status and its steps
+func printPipeline(d *pb.PipelineDetails) {
+	fmt.Printf("Status:\t\t%s\n\n", d.GetStatus())
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "STEP\tSTATE\tJOB\tERROR")
+	for _, st := range d.GetSteps() {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", st.Name, st.State, st.JobId, st.Error)
+	}
+	_ = w.Flush()
+}
+
+func init() {
+	pipelineCmd.AddCommand(pipelineRunCmd, pipelineInspectCmd, pipelineStopCmd)
+	rootCmd.AddCommand(pipelineCmd)
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	pb "github.com/ilyazz/jobs/pkg/api/grpc/jobs/v1"
+	"github.com/ilyazz/jobs/pkg/client"
+	"github.com/spf13/cobra"
+)
+
+var pruneOlderThan time.Duration
+
+// pruneCmd represents the prune command
+var pruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove completed jobs",
+	Long:  `Remove the completed jobs of the client: ended, stopped, or failed to start, with their files. Prints the removed jobs`,
+	Run: func(cmd *cobra.Command, args []string) {
+		_, cfg, err := client.FindConfig(config)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "failed to load config\n")
+			os.Exit(1)
+		}
+
+		if pruneOlderThan < 0 {
+			_, _ = fmt.Fprintf(os.Stderr, "negative --older-than\n")
+			os.Exit(1)
+		}
+
+		cl, err := client.New(cfg)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "failed to connect: %v\n", err)
+			os.Exit(1)
+		}
+
+		rsp, err := cl.Prune(context.Background(), &pb.PruneRequest{
+			OlderThanMs: pruneOlderThan.Milliseconds(),
+		})
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "failed to prune: %v\n", diagMessage(err))
+			os.Exit(1)
+		}
+
+		for _, id := range rsp.JobIds {
+			_, _ = fmt.Println(id)
+		}
+	},
+}
+
+func init() {
+	pruneCmd.Flags().DurationVar(&pruneOlderThan, "older-than", 0, "Remove only the jobs completed at least that long ago, e.g. 24h. All if not set.")
+
+	rootCmd.AddCommand(pruneCmd)
+}
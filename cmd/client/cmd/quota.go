@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	pb "github.com/ilyazz/jobs/pkg/api/grpc/jobs/v1"
+	"github.com/ilyazz/jobs/pkg/client"
+	"github.com/spf13/cobra"
+)
+
+// quotaCmd represents the quota command
+var quotaCmd = &cobra.Command{
+	Use:   "quota",
+	Short: "Show the quota and its usage",
+	Long:  `Show what the client jobs hold against the client quota: active (running and queued) jobs, their total CPU and memory limits, and completed jobs not removed yet`,
+	Run: func(cmd *cobra.Command, args []string) {
+		_, cfg, err := client.FindConfig(config)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "failed to load config\n")
+			os.Exit(1)
+		}
+
+		cl, err := client.New(cfg)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "failed to connect: %v\n", err)
+			os.Exit(1)
+		}
+
+		rsp, err := cl.Quota(context.Background(), &pb.QuotaRequest{})
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "failed to get quota: %v\n", diagMessage(err))
+			os.Exit(1)
+		}
+
+		q, u := rsp.GetQuota(), rsp.GetUsage()
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "RESOURCE\tUSED\tLIMIT")
+		_, _ = fmt.Fprintf(w, "active jobs\t%d\t%s\n", u.ActiveJobs, quotaLimit(int64(q.ActiveJobs), fmt.Sprint(q.ActiveJobs)))
+		_, _ = fmt.Fprintf(w, "cpu\t%.2f\t%s\n", u.Cpu, quotaLimit(int64(q.Cpu*100), fmt.Sprintf("%.2f", q.Cpu)))
+		_, _ = fmt.Fprintf(w, "memory\t%d\t%s\n", u.Memory, quotaLimit(q.Memory, fmt.Sprint(q.Memory)))
+		_, _ = fmt.Fprintf(w, "retained jobs\t%d\t%s\n", u.RetainedJobs, quotaLimit(int64(q.RetainedJobs), fmt.Sprint(q.RetainedJobs)))
+		_ = w.Flush()
+	},
+}
+
+// quotaLimit returns the formatted limit s, or "unlimited" if the limit v is 0
+func quotaLimit(v int64, s string) string {
+	if v == 0 {
+		return "unlimited"
+	}
+	return s
+}
+
+func init() {
+	rootCmd.AddCommand(quotaCmd)
+}
@@ -3,11 +3,16 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"math"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	pb "github.com/ilyazz/jobs/pkg/api/grpc/jobs/v1"
 	"github.com/ilyazz/jobs/pkg/client"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 // runCmd represents the run command
@@ -33,16 +38,13 @@ var runCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
-		rsp, err := cl.Start(context.Background(), &pb.StartRequest{
-			Command: args[0],
-			Args:    args[1:],
-			Limits: &pb.Limits{
-				Cpus:   cpuLimit,
-				Memory: memLimit,
-				Io:     ioLimit,
-			},
-		})
+		req := startRequest(args)
+		if req.Array, err = arrayRequest(); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "invalid array: %v\n", err)
+			os.Exit(1)
+		}
 
+		rsp, err := cl.Start(context.Background(), req)
 		if err != nil {
 			_, _ = fmt.Fprintf(os.Stderr, "failed to start the job: %v\n", diagMessage(err))
 			os.Exit(1)
@@ -52,15 +54,497 @@ var runCmd = &cobra.Command{
 	},
 }
 
+// startRequest builds the start request of command args from the run flags. Exits if the flags are invalid
+func startRequest(args []string) *pb.StartRequest {
+	devices, err := deviceLimits()
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "invalid device limits: %v\n", err)
+		os.Exit(1)
+	}
+
+	triggers, err := pressureTriggers()
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "invalid pressure trigger: %v\n", err)
+		os.Exit(1)
+	}
+
+	limits, err := rlimits()
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "invalid rlimit: %v\n", err)
+		os.Exit(1)
+	}
+
+	disk, err := parseSize(diskLimit)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "invalid disk limit: %v\n", err)
+		os.Exit(1)
+	}
+
+	vols, err := volumes()
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "invalid volume: %v\n", err)
+		os.Exit(1)
+	}
+
+	nm, err := netMode(network)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "invalid network: %v\n", err)
+		os.Exit(1)
+	}
+
+	ports, err := publishedPorts()
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "invalid port: %v\n", err)
+		os.Exit(1)
+	}
+
+	restart, err := restartPolicy()
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "invalid restart policy: %v\n", err)
+		os.Exit(1)
+	}
+
+	runAsUser, runAsGroup, _ := strings.Cut(runAs, ":")
+
+	var swap *int64
+	if swapFlag.Changed {
+		swap = &swapLimit
+	}
+
+	var ns *pb.Namespaces
+	if namespacesFlag.Changed {
+		ns = &pb.Namespaces{}
+		if namespaces != "" {
+			ns.Names = strings.Split(namespaces, ",")
+		}
+	}
+
+	return &pb.StartRequest{
+		Command: args[0],
+		Args:    args[1:],
+		Limits: &pb.Limits{
+			Cpus:       cpuLimit,
+			Memory:     memLimit,
+			MemoryHigh: memHighLimit,
+			MemoryLow:  memLowLimit,
+			MemoryMin:  memMinLimit,
+			Swap:       swap,
+			Io:         ioLimit,
+			Devices:    devices,
+			IoWeight:   ioWeight,
+			Disk:       disk,
+		},
+		PressureTriggers: triggers,
+		Rlimits:          limits,
+		Image:            image,
+		Volumes:          vols,
+		Network:          nm,
+		Ports:            ports,
+		Egress:           &pb.EgressPolicy{Allow: egressAllow, Deny: egressDeny},
+		RunAsUser:        runAsUser,
+		RunAsGroup:       runAsGroup,
+		SeccompProfile:   seccompProfile,
+		Capabilities:     capAdd,
+		Hostname:         hostname,
+		Namespaces:       ns,
+		Profile:          profile,
+		Restart:          restart,
+		PriorityClass:    priorityClass,
+		Remove:           autoRemove,
+		TtlMs:            ttl.Milliseconds(),
+	}
+}
+
 var cpuLimit float32
 var memLimit int64
+var memHighLimit int64
+var memLowLimit int64
+var memMinLimit int64
+var swapLimit int64
+
+// swapFlag tells if the swap limit is set, 0 is a valid one
+var swapFlag *pflag.Flag
 var ioLimit int64
+var ioWeight uint32
+var diskLimit string
+
+// parseSize parses a size in bytes with an optional K, M, G or T suffix, powers of 1024. Empty means 0
+func parseSize(s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	mul := int64(1)
+	switch strings.ToUpper(s[len(s)-1:]) {
+	case "K":
+		mul = 1 << 10
+	case "M":
+		mul = 1 << 20
+	case "G":
+		mul = 1 << 30
+	case "T":
+		mul = 1 << 40
+	}
+	if mul > 1 {
+		s = s[:len(s)-1]
+	}
+
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if v < 0 || v > math.MaxInt64/mul {
+		return 0, fmt.Errorf("size out of range: %q", s)
+	}
+	return v * mul, nil
+}
+
+var image string
+var runAs string
+var seccompProfile string
+var capAdd []string
+var hostname string
+var namespaces string
+
+// namespacesFlag tells if the namespaces are set, empty means none
+var namespacesFlag *pflag.Flag
+var profile string
+var rlimitFlags []string
+var volumeFlags []string
+var network string
+var portFlags []string
+var egressAllow []string
+var egressDeny []string
+
+// netMode parses the network mode name
+func netMode(name string) (pb.NetworkMode, error) {
+	switch name {
+	case "", "none":
+		return pb.NetworkMode_NETWORK_MODE_NONE, nil
+	case "host":
+		return pb.NetworkMode_NETWORK_MODE_HOST, nil
+	case "bridge":
+		return pb.NetworkMode_NETWORK_MODE_BRIDGE, nil
+	default:
+		return 0, fmt.Errorf("expected none, host or bridge, got %q", name)
+	}
+}
+
+var priorityClass string
+var restartFlag string
+var restartBackoff time.Duration
+
+var autoRemove bool
+var ttl time.Duration
+
+var arrayFlag string
+var arrayItems []string
+
+// maxArrayTasks is the max number of tasks in --array, the server limit
+const maxArrayTasks = 10000
+
+// arrayRequest parses the array job tasks in "[INDEXES][%PARALLELISM]" format, e.g. 0-99%10 or 1,3,5-7.
+// INDEXES are set by the items, if there are any. nil if it's not an array job
+func arrayRequest() (*pb.ArrayRequest, error) {
+	if arrayFlag == "" && len(arrayItems) == 0 {
+		return nil, nil
+	}
+
+	indexes, parallelism, ok := strings.Cut(arrayFlag, "%")
+
+	rt := &pb.ArrayRequest{Items: arrayItems}
+	if ok {
+		n, err := strconv.ParseUint(parallelism, 10, 31)
+		if err != nil || n == 0 {
+			return nil, fmt.Errorf("invalid parallelism %q", parallelism)
+		}
+		rt.Parallelism = int32(n)
+	}
+
+	switch {
+	case indexes == "" && len(arrayItems) == 0:
+		return nil, fmt.Errorf("task indexes or items required")
+	case indexes == "":
+		return rt, nil
+	case len(arrayItems) > 0:
+		return nil, fmt.Errorf("task indexes are set by the items")
+	}
+
+	for _, r := range strings.Split(indexes, ",") {
+		lo, hi, isRange := strings.Cut(r, "-")
+		if !isRange {
+			hi = lo
+		}
+
+		first, err := strconv.ParseUint(lo, 10, 31)
+		if err != nil {
+			return nil, fmt.Errorf("invalid index %q", lo)
+		}
+		last, err := strconv.ParseUint(hi, 10, 31)
+		if err != nil || last < first {
+			return nil, fmt.Errorf("invalid index range %q", r)
+		}
+		if int(last-first)+len(rt.Indexes) >= maxArrayTasks {
+			return nil, fmt.Errorf("more than %d tasks", maxArrayTasks)
+		}
+
+		for i := first; i <= last; i++ {
+			rt.Indexes = append(rt.Indexes, int32(i))
+		}
+	}
+
+	return rt, nil
+}
+
+// restartPolicy parses the restart policy in "MODE[:MAX_RETRIES]" format
+func restartPolicy() (*pb.RestartPolicy, error) {
+	mode, retries, ok := strings.Cut(restartFlag, ":")
+
+	rt := &pb.RestartPolicy{BackoffMs: restartBackoff.Milliseconds()}
+	switch mode {
+	case "", "never":
+		rt.Mode = pb.RestartMode_RESTART_MODE_NEVER
+		if ok {
+			return nil, fmt.Errorf("max retries is set for 'never' mode")
+		}
+	case "on-failure":
+		rt.Mode = pb.RestartMode_RESTART_MODE_ON_FAILURE
+	case "always":
+		rt.Mode = pb.RestartMode_RESTART_MODE_ALWAYS
+	default:
+		return nil, fmt.Errorf("expected never, on-failure or always, got %q", mode)
+	}
+
+	if ok {
+		n, err := strconv.ParseUint(retries, 10, 31)
+		if err != nil {
+			return nil, fmt.Errorf("invalid max retries %q", retries)
+		}
+		rt.MaxRetries = int32(n)
+	}
+
+	return rt, nil
+}
+
+// publishedPorts parses ports to publish in "HOST:JOB[/tcp|udp]" format
+func publishedPorts() ([]*pb.Port, error) {
+	var rt []*pb.Port
+	for _, s := range portFlags {
+		ports, proto, ok := strings.Cut(s, "/")
+		if !ok {
+			proto = "tcp"
+		}
+
+		host, job, ok := strings.Cut(ports, ":")
+		if !ok {
+			return nil, fmt.Errorf("expected HOST:JOB[/PROTOCOL], got %q", s)
+		}
+
+		hp, err := strconv.ParseUint(host, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid host port in %q: %w", s, err)
+		}
+		jp, err := strconv.ParseUint(job, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid job port in %q: %w", s, err)
+		}
+
+		rt = append(rt, &pb.Port{HostPort: uint32(hp), JobPort: uint32(jp), Protocol: proto})
+	}
+	return rt, nil
+}
+
+// volumes parses server volume mounts in "NAME:TARGET[:ro|rw]" format. Volumes are read-write by default
+func volumes() ([]*pb.Volume, error) {
+	var rt []*pb.Volume
+	for _, s := range volumeFlags {
+		parts := strings.Split(s, ":")
+		if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("expected NAME:TARGET[:ro|rw], got %q", s)
+		}
+
+		v := &pb.Volume{Name: parts[0], Target: parts[1]}
+		if len(parts) == 3 {
+			switch parts[2] {
+			case "ro":
+				v.ReadOnly = true
+			case "rw":
+			default:
+				return nil, fmt.Errorf("expected 'ro' or 'rw', got %q", parts[2])
+			}
+		}
+		rt = append(rt, v)
+	}
+	return rt, nil
+}
+
+// rlimits parses POSIX resource limits in "RESOURCE=SOFT[:HARD]" format. 'unlimited' may be used as a value
+func rlimits() ([]*pb.Rlimit, error) {
+	parse := func(s string) (uint64, error) {
+		if s == "unlimited" {
+			return math.MaxUint64, nil
+		}
+		return strconv.ParseUint(s, 10, 64)
+	}
+
+	var rt []*pb.Rlimit
+	for _, s := range rlimitFlags {
+		res, val, ok := strings.Cut(s, "=")
+		if !ok {
+			return nil, fmt.Errorf("expected RESOURCE=SOFT[:HARD], got %q", s)
+		}
+
+		soft, hard, ok := strings.Cut(val, ":")
+		if !ok {
+			hard = soft
+		}
+
+		l := &pb.Rlimit{Resource: res}
+		var err error
+		if l.Soft, err = parse(soft); err != nil {
+			return nil, fmt.Errorf("invalid soft limit in %q: %w", s, err)
+		}
+		if l.Hard, err = parse(hard); err != nil {
+			return nil, fmt.Errorf("invalid hard limit in %q: %w", s, err)
+		}
+		rt = append(rt, l)
+	}
+	return rt, nil
+}
+
+var psiTriggers []string
+
+// pressureTriggers parses PSI triggers in "RESOURCE some|full STALL [per] WINDOW [stop]" format,
+// e.g. "memory some 150ms per 1s stop"
+func pressureTriggers() ([]*pb.PressureTrigger, error) {
+	var rt []*pb.PressureTrigger
+	for _, s := range psiTriggers {
+		parts := strings.Fields(s)
+
+		t := &pb.PressureTrigger{}
+		if n := len(parts); n > 0 && parts[n-1] == "stop" {
+			t.Stop = true
+			parts = parts[:n-1]
+		}
+		if len(parts) == 5 && parts[3] == "per" {
+			parts = append(parts[:3], parts[4])
+		}
+		if len(parts) != 4 {
+			return nil, fmt.Errorf("expected 'RESOURCE some|full STALL per WINDOW [stop]', got %q", s)
+		}
+
+		t.Resource = parts[0]
+		switch parts[1] {
+		case "some":
+		case "full":
+			t.Full = true
+		default:
+			return nil, fmt.Errorf("expected 'some' or 'full', got %q", parts[1])
+		}
+
+		stall, err := time.ParseDuration(parts[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid stall time: %w", err)
+		}
+		window, err := time.ParseDuration(parts[3])
+		if err != nil {
+			return nil, fmt.Errorf("invalid window: %w", err)
+		}
+		t.StallUs = stall.Microseconds()
+		t.WindowUs = window.Microseconds()
+
+		rt = append(rt, t)
+	}
+	return rt, nil
+}
+
+var deviceReadBps []string
+var deviceWriteBps []string
+var deviceReadIops []string
+var deviceWriteIops []string
+
+// deviceLimits collects per-device IO limits from "DEVICE:VALUE" flag values
+func deviceLimits() ([]*pb.DeviceIOLimit, error) {
+	var rt []*pb.DeviceIOLimit
+	byDevice := make(map[string]*pb.DeviceIOLimit)
+
+	for _, f := range []struct {
+		values []string
+		set    func(l *pb.DeviceIOLimit, v int64)
+	}{
+		{deviceReadBps, func(l *pb.DeviceIOLimit, v int64) { l.ReadBps = v }},
+		{deviceWriteBps, func(l *pb.DeviceIOLimit, v int64) { l.WriteBps = v }},
+		{deviceReadIops, func(l *pb.DeviceIOLimit, v int64) { l.ReadIops = v }},
+		{deviceWriteIops, func(l *pb.DeviceIOLimit, v int64) { l.WriteIops = v }},
+	} {
+		for _, s := range f.values {
+			// device may be major:minor itself, so split by the last colon
+			i := strings.LastIndex(s, ":")
+			if i <= 0 {
+				return nil, fmt.Errorf("expected DEVICE:VALUE, got %q", s)
+			}
+			v, err := strconv.ParseInt(s[i+1:], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value in %q: %w", s, err)
+			}
+
+			dev := s[:i]
+			l, ok := byDevice[dev]
+			if !ok {
+				l = &pb.DeviceIOLimit{Device: dev}
+				byDevice[dev] = l
+				rt = append(rt, l)
+			}
+			f.set(l, v)
+		}
+	}
+
+	return rt, nil
+}
 
 func init() {
 
 	runCmd.PersistentFlags().Float32VarP(&cpuLimit, "cpu", "c", 1.0, "CPU limit for the job. No limit if zero or not set.")
 	runCmd.PersistentFlags().Int64VarP(&memLimit, "mem", "m", 0, "RAM limit for the job. No limit if zero or not set.")
+	runCmd.PersistentFlags().Int64Var(&memHighLimit, "mem-high", 0, "RAM usage above which the job is throttled. No throttling if zero or not set.")
+	runCmd.PersistentFlags().Int64Var(&memLowLimit, "mem-low", 0, "Best-effort RAM protection for the job. No protection if zero or not set.")
+	runCmd.PersistentFlags().Int64Var(&memMinLimit, "mem-min", 0, "Hard RAM protection for the job. No protection if zero or not set.")
+	runCmd.PersistentFlags().Int64Var(&swapLimit, "swap", 0, "Swap limit for the job. Zero disables swap. No limit if not set.")
+	swapFlag = runCmd.PersistentFlags().Lookup("swap")
 	runCmd.PersistentFlags().Int64VarP(&ioLimit, "io", "i", 0, "IO rate limit for the job. No limit if zero or not set.")
 
+	runCmd.PersistentFlags().StringVar(&diskLimit, "disk", "", "Working directory size limit, e.g. 2G. Suffixes: K, M, G, T. No limit if not set.")
+
+	runCmd.PersistentFlags().Uint32Var(&ioWeight, "io-weight", 0, "Proportional IO share of the job, 1-10000. Default weight if zero or not set.")
+	runCmd.PersistentFlags().StringArrayVar(&deviceReadBps, "device-read-bps", nil, "Read rate limit for a device, DEVICE:BYTES. DEVICE is a path under /dev, major:minor or '*' for all disks.")
+	runCmd.PersistentFlags().StringArrayVar(&deviceWriteBps, "device-write-bps", nil, "Write rate limit for a device, DEVICE:BYTES.")
+	runCmd.PersistentFlags().StringArrayVar(&deviceReadIops, "device-read-iops", nil, "Read IOPS limit for a device, DEVICE:COUNT.")
+	runCmd.PersistentFlags().StringArrayVar(&deviceWriteIops, "device-write-iops", nil, "Write IOPS limit for a device, DEVICE:COUNT.")
+
+	runCmd.PersistentFlags().StringArrayVar(&psiTriggers, "psi-trigger", nil, "Pressure trigger, e.g. 'memory some 150ms per 1s'. Add 'stop' to stop the job when it fires.")
+
+	runCmd.PersistentFlags().StringVarP(&runAs, "user", "u", "", "User and group to run the job as, USER[:GROUP], names or IDs. Must be allowed by the server.")
+	runCmd.PersistentFlags().StringVar(&seccompProfile, "seccomp", "", "Seccomp profile name: default, unconfined or a server profile. The server default if not set.")
+	runCmd.PersistentFlags().StringArrayVar(&capAdd, "cap-add", nil, "Capability to keep, e.g. NET_BIND_SERVICE. Must be allowed by the server. All capabilities are dropped by default.")
+	runCmd.PersistentFlags().StringVar(&profile, "profile", "", "Isolation profile name. Must be allowed by the server. The server default if not set.")
+	runCmd.PersistentFlags().StringVar(&hostname, "hostname", "", "Job hostname. The job ID if not set.")
+	runCmd.PersistentFlags().StringVar(&namespaces, "namespaces", "", "Comma-separated optional job namespaces: pid, uts, ipc. Empty for none. The profile ones if not set.")
+	namespacesFlag = runCmd.PersistentFlags().Lookup("namespaces")
+	runCmd.PersistentFlags().StringVar(&image, "image", "", "Name of the server root filesystem image to run the job in. Host filesystem if not set.")
+	runCmd.PersistentFlags().StringArrayVarP(&volumeFlags, "volume", "v", nil, "Server volume to mount, NAME:TARGET[:ro|rw], e.g. data:/data:ro. Read-write if mode is not set.")
+	runCmd.PersistentFlags().StringVar(&network, "net", "none", "Network mode: none (loopback only), host or bridge.")
+	runCmd.PersistentFlags().StringArrayVarP(&portFlags, "publish", "p", nil, "Publish a job port on the server, HOST:JOB[/tcp|udp], e.g. 8080:80. Bridge network only.")
+	runCmd.PersistentFlags().StringArrayVar(&egressAllow, "egress-allow", nil, "Allowed outbound destination, [tcp|udp:]CIDR[:PORT], e.g. tcp:10.0.0.0/8:443. Bridge network only.")
+	runCmd.PersistentFlags().StringArrayVar(&egressDeny, "egress-deny", nil, "Denied outbound destination, [tcp|udp:]CIDR[:PORT]. Bridge network only.")
+	runCmd.PersistentFlags().StringVar(&priorityClass, "priority-class", "", "Queue priority class, configured by the server. Effective if the server queue is ordered by priority. Priority 0 if not set.")
+	runCmd.PersistentFlags().StringVar(&restartFlag, "restart", "never", "Restart policy, MODE[:MAX_RETRIES]. Modes: never, on-failure, always. No retries limit if not set.")
+	runCmd.PersistentFlags().DurationVar(&restartBackoff, "restart-backoff", 0, "Delay before the first restart, doubled for each next one. The server default if not set.")
+	runCmd.PersistentFlags().StringArrayVar(&rlimitFlags, "rlimit", nil, "POSIX resource limit, RESOURCE=SOFT[:HARD], e.g. nofile=1024:4096. Resources: nofile, core, stack, fsize, cpu.")
+
+	runCmd.PersistentFlags().BoolVar(&autoRemove, "rm", false, "Remove the job once it's completed.")
+	runCmd.PersistentFlags().DurationVar(&ttl, "ttl", 0, "How long the job is kept once it's completed, e.g. 1h. The server retention if not set.")
+	runCmd.Flags().StringVar(&arrayFlag, "array", "", "Start an array job of tasks, [INDEXES][%PARALLELISM], e.g. 0-99%10 or 1,3,5-7. Each task gets its index in $JOB_ARRAY_INDEX.")
+	runCmd.Flags().StringArrayVar(&arrayItems, "array-item", nil, "Array task item, one task each, in $JOB_ARRAY_ITEM. Excludes --array indexes.")
+
 	rootCmd.AddCommand(runCmd)
 }
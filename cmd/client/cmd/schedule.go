@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	pb "github.com/ilyazz/jobs/pkg/api/grpc/jobs/v1"
+	"github.com/spf13/cobra"
+)
+
+// scheduleCmd represents the schedule command
+var scheduleCmd = &cobra.Command{
+	Use:   "schedule",
+	Short: "Manage job schedules",
+	Long:  `Manage job schedules: jobs started by the server periodically, at the times of a cron expression`,
+}
+
+// scheduleCreateCmd represents the schedule create command
+var scheduleCreateCmd = &cobra.Command{
+	Use:   "create CRON -- COMMAND [ARGS...]",
+	Short: "Create a schedule",
+	Long: `Create a schedule starting the command at the times of the cron expression, in the server local time:
+MINUTE HOUR DAY-OF-MONTH MONTH DAY-OF-WEEK, or @hourly, @daily etc. The job options are the same as of the run command`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 2 {
+			_, _ = fmt.Fprintf(os.Stderr, "cron expression and command required\n")
+			os.Exit(1)
+		}
+
+		policy, err := concurrencyPolicy(concurrency)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "invalid concurrency policy: %v\n", err)
+			os.Exit(1)
+		}
+
+		cl := mustConnect()
+		rsp, err := cl.CreateSchedule(context.Background(), &pb.CreateScheduleRequest{
+			Cron:        args[0],
+			Job:         startRequest(args[1:]),
+			Concurrency: policy,
+		})
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "failed to create the schedule: %v\n", diagMessage(err))
+			os.Exit(1)
+		}
+
+		_, _ = fmt.Println(rsp.Schedule.Id)
+	},
+}
+
+// scheduleListCmd represents the schedule ls command
+var scheduleListCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "List schedules",
+	Run: func(cmd *cobra.Command, args []string) {
+		cl := mustConnect()
+		rsp, err := cl.ListSchedules(context.Background(), &pb.ListSchedulesRequest{})
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "failed to list schedules: %v\n", diagMessage(err))
+			os.Exit(1)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "SCHEDULE\tCRON\tCONCURRENCY\tNEXT RUN\tLAST RUN\tACTIVE\tCOMMAND")
+		for _, sc := range rsp.Schedules {
+			next, last := "never", "-"
+			if sc.NextRun != nil {
+				next = sc.NextRun.AsTime().Local().Format(time.RFC3339)
+			}
+			switch {
+			case sc.LastError != "":
+				last = "error: " + sc.LastError
+			case sc.LastJobId != "":
+				last = sc.LastJobId
+			}
+
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", sc.Id, sc.Cron,
+				strings.ToLower(strings.TrimPrefix(sc.Concurrency.String(), "CONCURRENCY_POLICY_")),
+				next, last, strings.Join(sc.ActiveJobIds, ","), sc.Command)
+		}
+		_ = w.Flush()
+	},
+}
+
+// scheduleRemoveCmd represents the schedule rm command
+var scheduleRemoveCmd = &cobra.Command{
+	Use:   "rm SCHEDULE_ID",
+	Short: "Delete a schedule. Its active runs are not stopped",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			_, _ = fmt.Fprintf(os.Stderr, "schedule_id required\n")
+			os.Exit(1)
+		}
+
+		cl := mustConnect()
+		if _, err := cl.DeleteSchedule(context.Background(), &pb.DeleteScheduleRequest{ScheduleId: args[0]}); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "failed to delete the schedule: %v\n", diagMessage(err))
+			os.Exit(1)
+		}
+	},
+}
+
+var concurrency string
+
+// concurrencyPolicy parses the concurrency policy name
+func concurrencyPolicy(name string) (pb.ConcurrencyPolicy, error) {
+	switch name {
+	case "", "allow":
+		return pb.ConcurrencyPolicy_CONCURRENCY_POLICY_ALLOW, nil
+	case "forbid":
+		return pb.ConcurrencyPolicy_CONCURRENCY_POLICY_FORBID, nil
+	case "replace":
+		return pb.ConcurrencyPolicy_CONCURRENCY_POLICY_REPLACE, nil
+	default:
+		return 0, fmt.Errorf("expected allow, forbid or replace, got %q", name)
+	}
+}
+
+func init() {
+	scheduleCreateCmd.Flags().StringVar(&concurrency, "concurrency", "allow",
+		"What a run does if the previous runs are still active: allow, forbid (skip the run) or replace (stop them)")
+	// the job options
+	scheduleCreateCmd.Flags().AddFlagSet(runCmd.PersistentFlags())
+
+	scheduleCmd.AddCommand(scheduleCreateCmd, scheduleListCmd, scheduleRemoveCmd)
+	rootCmd.AddCommand(scheduleCmd)
+}
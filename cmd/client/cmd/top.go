@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	pb "github.com/ilyazz/jobs/pkg/api/grpc/jobs/v1"
+	"github.com/ilyazz/jobs/pkg/client"
+	"github.com/spf13/cobra"
+)
+
+// topCmd represents the top command
+var topCmd = &cobra.Command{
+	Use:   "top JOB_ID",
+	Short: "List processes of a running job",
+	Long:  `List processes of a running job, including re-parented ones and executed commands. PID is the host one, NSPID is the one inside the job`,
+	Run: func(cmd *cobra.Command, args []string) {
+		_, cfg, err := client.FindConfig(config)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "failed to load config\n")
+			os.Exit(1)
+		}
+
+		if len(args) == 0 {
+			_, _ = fmt.Fprintf(os.Stderr, "job_id required\n")
+			os.Exit(1)
+		}
+
+		cl, err := client.New(cfg)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "failed to connect: %v\n", err)
+			os.Exit(1)
+		}
+
+		rsp, err := cl.Processes(context.Background(), &pb.ProcessesRequest{
+			JobId: args[0],
+		})
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "failed to list processes: %v\n", diagMessage(err))
+			os.Exit(1)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', tabwriter.AlignRight)
+		_, _ = fmt.Fprintln(w, "PID\tNSPID\tSTAT\tTIME\tRSS\t COMMAND")
+		for _, p := range rsp.Processes {
+			_, _ = fmt.Fprintf(w, "%d\t%d\t%s\t%s\t%d\t %s\n",
+				p.Pid, p.NsPid, p.State, cpuTime(p.CpuTimeUs), p.RssBytes/1024, strings.Join(p.Cmdline, " "))
+		}
+		_ = w.Flush()
+	},
+}
+
+// cpuTime formats CPU time in microseconds as ps(1) does: [hh:]mm:ss
+func cpuTime(us int64) string {
+	d := time.Duration(us) * time.Microsecond
+	h, m, s := int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60
+	if h > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", h, m, s)
+	}
+	return fmt.Sprintf("%d:%02d", m, s)
+}
+
+func init() {
+	rootCmd.AddCommand(topCmd)
+}
@@ -17,6 +17,8 @@ func diagMessage(err error) string {
 			return "no such job"
 		case codes.Unauthenticated:
 			return "invalid certificate"
+		case codes.InvalidArgument:
+			return gerr.Message()
 		}
 	}
 
@@ -9,12 +9,14 @@ import (
 	"net"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
 
 	pb "github.com/ilyazz/jobs/pkg/api/grpc/jobs/v1"
 	"github.com/ilyazz/jobs/pkg/certloader"
+	"github.com/ilyazz/jobs/pkg/job"
 	"github.com/ilyazz/jobs/pkg/server"
 	"github.com/ilyazz/jobs/pkg/server/shim"
 	"github.com/rs/zerolog"
@@ -36,6 +38,16 @@ var cmd string
 var cgroup string
 var uid int
 var gid int
+var rlimits string
+var rootfs string
+var volumes string
+var netMode string
+var userNS bool
+var seccompProfile string
+var caps string
+var hostname string
+var target int
+var namespaces string
 
 var pidfile string
 
@@ -49,6 +61,16 @@ func init() {
 	flag.StringVar(&cgroup, "cgroup", "", "")
 	flag.IntVar(&uid, "uid", 0, "")
 	flag.IntVar(&gid, "gid", 0, "")
+	flag.StringVar(&rlimits, "rlimits", "", "")
+	flag.StringVar(&rootfs, "rootfs", "", "")
+	flag.StringVar(&volumes, "volumes", "", "")
+	flag.StringVar(&netMode, "net", "", "")
+	flag.BoolVar(&userNS, "userns", false, "")
+	flag.StringVar(&seccompProfile, "seccomp", "", "")
+	flag.StringVar(&caps, "caps", "", "")
+	flag.StringVar(&hostname, "hostname", "", "")
+	flag.IntVar(&target, "target", 0, "")
+	flag.StringVar(&namespaces, "namespaces", "", "")
 
 	flag.StringVar(&pidfile, "pid", "", "")
 }
@@ -62,8 +84,56 @@ func main() {
 
 	flag.Parse()
 
-	if mode == "shim" {
-		shim.Main(cmd, flag.Args(), cgroup, uid, gid)
+	if mode == "shim" || mode == "exec" || mode == "exec-inner" {
+		limits, err := job.ParseRlimits(rlimits)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "invalid rlimits: %v\n", err)
+			os.Exit(1)
+		}
+
+		mounts, err := job.ParseMounts(volumes)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "invalid volumes: %v\n", err)
+			os.Exit(1)
+		}
+
+		net, err := job.ParseNetMode(netMode)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "invalid network: %v\n", err)
+			os.Exit(1)
+		}
+
+		keep, err := job.ParseCaps(caps)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "invalid capabilities: %v\n", err)
+			os.Exit(1)
+		}
+
+		cfg := job.ProcConfig{
+			Cgroup:   cgroup,
+			IDs:      job.ExecIdentity{UID: uid, GID: gid},
+			Rlimits:  limits,
+			RootFS:   rootfs,
+			Volumes:  mounts,
+			Network:  net,
+			UserNS:   userNS,
+			Seccomp:  seccompProfile,
+			Caps:     keep,
+			Hostname: hostname,
+		}
+
+		switch mode {
+		case "exec":
+			var ns []job.Namespace
+			for _, n := range strings.Split(namespaces, ",") {
+				ns = append(ns, job.Namespace(n))
+			}
+			shim.Exec(cmd, flag.Args(), cfg, target, ns)
+		case "exec-inner":
+			shim.ExecInner(cmd, flag.Args(), cfg)
+		default:
+			shim.Main(cmd, flag.Args(), cfg)
+		}
 		return
 	}
 
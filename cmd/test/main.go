@@ -85,12 +85,15 @@ func main() {
 
 		f := os.NewFile(3, "out")
 
-		ids := job.ExecIdentity{
-			UID: *uid,
-			GID: *gid,
+		cfg := job.ProcConfig{
+			Cgroup: *cg,
+			IDs: job.ExecIdentity{
+				UID: *uid,
+				GID: *gid,
+			},
 		}
 
-		if err := job.SetupProc(*cg, ids); err != nil {
+		if err := job.SetupProc(cfg); err != nil {
 			_, _ = f.WriteString("failed to setup the process: " + err.Error())
 			_ = f.Close()
 			os.Exit(1)
@@ -113,6 +116,11 @@ func main() {
 
 		_ = f.Close()
 
+		if err := job.WaitReady(cfg, os.NewFile(4, "ready")); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "failed to setup the process: %v\n", err)
+			os.Exit(1)
+		}
+
 		cmd := exec.Command(*cmd, flag.Args()...)
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
@@ -0,0 +1,200 @@
+// Package cron parses cron expressions, and computes their schedules.
+package cron
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidExpr means the cron expression is not valid
+var ErrInvalidExpr = errors.New("invalid cron expression")
+
+// horizon limits the search of the next time, for the expressions that never match, e.g. 0 0 30 2 *
+const horizon = 5 * 366 * 24 * time.Hour
+
+// Expr is a parsed cron expression: minute, hour, day of month, month and day of week fields.
+type Expr struct {
+	minute, hour, dom, month, dow uint64
+	// a day matches either the day of month or the day of week, if both are restricted
+	domAny, dowAny bool
+}
+
+// field describes a cron expression field.
+type field struct {
+	name     string
+	min, max int
+	names    []string
+}
+
+var (
+	minuteField = field{name: "minute", min: 0, max: 59}
+	hourField   = field{name: "hour", min: 0, max: 23}
+	domField    = field{name: "day of month", min: 1, max: 31}
+	monthField  = field{name: "month", min: 1, max: 12,
+		names: []string{"", "jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}}
+	// 7 is Sunday too
+	dowField = field{name: "day of week", min: 0, max: 7,
+		names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}}
+)
+
+// macros are the shortcuts of the common expressions
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parse parses a standard 5-field cron expression: MINUTE HOUR DAY-OF-MONTH MONTH DAY-OF-WEEK.
+// A field is *, a value, a range A-B, or a list of them separated by commas, each optionally with a /STEP.
+// Months and days of week may be given by their 3-letter names. @hourly, @daily etc. macros are supported.
+func Parse(s string) (*Expr, error) {
+	if m, ok := macros[strings.ToLower(strings.TrimSpace(s))]; ok {
+		s = m
+	}
+
+	fields := strings.Fields(s)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("%w: expected 5 fields, got %d", ErrInvalidExpr, len(fields))
+	}
+
+	var e Expr
+	var err error
+	if e.minute, err = minuteField.parse(fields[0]); err != nil {
+		return nil, err
+	}
+	if e.hour, err = hourField.parse(fields[1]); err != nil {
+		return nil, err
+	}
+	if e.dom, err = domField.parse(fields[2]); err != nil {
+		return nil, err
+	}
+	if e.month, err = monthField.parse(fields[3]); err != nil {
+		return nil, err
+	}
+	if e.dow, err = dowField.parse(fields[4]); err != nil {
+		return nil, err
+	}
+
+	if e.dow&(1<<7) != 0 {
+		e.dow |= 1
+	}
+	e.domAny = strings.HasPrefix(fields[2], "*")
+	e.dowAny = strings.HasPrefix(fields[4], "*")
+
+	return &e, nil
+}
+
+// parse returns the bit set of the field values.
+func (f field) parse(s string) (uint64, error) {
+	var rt uint64
+
+	for _, part := range strings.Split(s, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepStr)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("%w: invalid %s step %q", ErrInvalidExpr, f.name, stepStr)
+			}
+			step = n
+		}
+
+		var lo, hi int
+		switch {
+		case rng == "*":
+			lo, hi = f.min, f.max
+		case strings.Contains(rng, "-"):
+			a, b, _ := strings.Cut(rng, "-")
+			var err error
+			if lo, err = f.value(a); err != nil {
+				return 0, err
+			}
+			if hi, err = f.value(b); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("%w: invalid %s range %q", ErrInvalidExpr, f.name, rng)
+			}
+		default:
+			var err error
+			if lo, err = f.value(rng); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if hasStep {
+				// N/STEP means from N to the max
+				hi = f.max
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			rt |= 1 << uint(v)
+		}
+	}
+
+	return rt, nil
+}
+
+// value parses a single field value, a number or a name.
+func (f field) value(s string) (int, error) {
+	for i, n := range f.names {
+		if n != "" && strings.EqualFold(s, n) {
+			return i, nil
+		}
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("%w: invalid %s %q, expected %d-%d", ErrInvalidExpr, f.name, s, f.min, f.max)
+	}
+	return v, nil
+}
+
+// Next returns the first time after t matching the expression, in the t location.
+// Returns zero time if there's no such time in the next 5 years.
+func (e *Expr) Next(t time.Time) time.Time {
+	limit := t.Add(horizon)
+	t = t.Truncate(time.Minute).Add(time.Minute)
+
+	for t.Before(limit) {
+		switch {
+		case e.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !e.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case e.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case e.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+// dayMatches checks if the day of t matches the day of month and day of week fields.
+func (e *Expr) dayMatches(t time.Time) bool {
+	dom := e.dom&(1<<uint(t.Day())) != 0
+	dow := e.dow&(1<<uint(t.Weekday())) != 0
+
+	switch {
+	case e.domAny && e.dowAny:
+		return true
+	case e.domAny:
+		return dow
+	case e.dowAny:
+		return dom
+	default:
+		return dom || dow
+	}
+}
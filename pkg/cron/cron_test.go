@@ -0,0 +1,51 @@
+package cron
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	valid := []string{"* * * * *", "*/5 * * * *", "0 9-17 * * mon-fri", "30 2 1,15 jan,jul *", "0 0 * * 7", "@daily", "5/10 * * * *"}
+	for _, s := range valid {
+		_, err := Parse(s)
+		assert.NoError(t, err, s)
+	}
+
+	invalid := []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8",
+		"*/0 * * * *", "5-1 * * * *", "* * * foo *", "@often"}
+	for _, s := range invalid {
+		_, err := Parse(s)
+		assert.ErrorIs(t, err, ErrInvalidExpr, s)
+	}
+}
+
+func TestNext(t *testing.T) {
+	// Wednesday
+	base := time.Date(2022, time.November, 2, 10, 17, 30, 0, time.UTC)
+
+	tests := []struct {
+		expr string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2022, time.November, 2, 10, 18, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2022, time.November, 2, 10, 30, 0, 0, time.UTC)},
+		{"0 9 * * *", time.Date(2022, time.November, 3, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * sat,sun", time.Date(2022, time.November, 5, 9, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2022, time.December, 1, 0, 0, 0, 0, time.UTC)},
+		{"@yearly", time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		// either the day of month or the day of week
+		{"0 0 13 * fri", time.Date(2022, time.November, 4, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+
+	for _, tt := range tests {
+		e, err := Parse(tt.expr)
+		if assert.NoError(t, err, tt.expr) {
+			assert.Equal(t, tt.next, e.Next(base), tt.expr)
+		}
+	}
+}
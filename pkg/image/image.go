@@ -0,0 +1,232 @@
+package image
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// MountPoints are directories every job root filesystem must have, to mount job-specific FS to.
+var MountPoints = []string{"proc", "dev", "tmp", "work"}
+
+// Load prepares named root filesystem images, returning name -> rootfs directory map.
+// An image is either a directory or a tarball (.tar, .tar.gz, .tgz). Relative paths are resolved
+// against workRoot, and all images must be located under workRoot. Tarballs are unpacked to
+// workRoot/images/NAME, replacing the previous content.
+func Load(workRoot string, images map[string]string) (map[string]string, error) {
+	rt := make(map[string]string)
+	if len(images) == 0 {
+		return rt, nil
+	}
+
+	if workRoot == "" {
+		return nil, fmt.Errorf("workroot is required to use images")
+	}
+
+	root, err := filepath.Abs(workRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, path := range images {
+		if name == "" || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+			return nil, fmt.Errorf("invalid image name: %q", name)
+		}
+
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(root, path)
+		}
+		path = filepath.Clean(path)
+
+		if !within(root, path) {
+			return nil, fmt.Errorf("image %q is not under workroot %q", name, root)
+		}
+
+		fi, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid image %q: %w", name, err)
+		}
+
+		if !fi.IsDir() {
+			dest := filepath.Join(root, "images", name)
+			if err := unpack(path, dest); err != nil {
+				return nil, fmt.Errorf("failed to unpack image %q: %w", name, err)
+			}
+			path = dest
+		}
+
+		for _, mp := range MountPoints {
+			// mount points must be real directories, a symlink might point to the host FS
+			if fi, err := os.Lstat(filepath.Join(path, mp)); err == nil && !fi.IsDir() {
+				return nil, fmt.Errorf("invalid image %q: /%s is not a directory", name, mp)
+			}
+			if err := os.MkdirAll(filepath.Join(path, mp), 0755); err != nil {
+				return nil, fmt.Errorf("failed to prepare image %q: %w", name, err)
+			}
+		}
+
+		rt[name] = path
+	}
+
+	return rt, nil
+}
+
+// within checks if path is dir itself or located inside dir.
+func within(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// unpack extracts tarball file to dest directory.
+func unpack(file, dest string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+
+	defer func() { _ = f.Close() }()
+
+	var r io.Reader = f
+	if strings.HasSuffix(file, ".gz") || strings.HasSuffix(file, ".tgz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = gz.Close() }()
+		r = gz
+	} else if !strings.HasSuffix(file, ".tar") {
+		return fmt.Errorf("unsupported image format: %q", file)
+	}
+
+	if err := os.RemoveAll(dest); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return err
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := extract(tr, hdr, dest); err != nil {
+			return fmt.Errorf("failed to extract %q: %w", hdr.Name, err)
+		}
+	}
+}
+
+// extract creates a single tarball entry in dest.
+func extract(r io.Reader, hdr *tar.Header, dest string) error {
+	target, err := securePath(dest, hdr.Name)
+	if err != nil {
+		return err
+	}
+
+	mode := os.FileMode(hdr.Mode).Perm()
+
+	// an entry may replace a previous one. never write through an existing symlink
+	if fi, err := os.Lstat(target); err == nil && !fi.IsDir() {
+		if err := os.Remove(target); err != nil {
+			return err
+		}
+	}
+
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		if err := os.MkdirAll(target, 0755); err != nil {
+			return err
+		}
+		if err := os.Chmod(target, mode); err != nil {
+			return err
+		}
+	case tar.TypeReg:
+		f, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(f, r); err != nil {
+			_ = f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	case tar.TypeSymlink:
+		// symlinks are resolved relative to the job root after pivot_root
+		if err := os.Symlink(hdr.Linkname, target); err != nil {
+			return err
+		}
+	case tar.TypeLink:
+		src, err := securePath(dest, hdr.Linkname)
+		if err != nil {
+			return err
+		}
+		if err := os.Link(src, target); err != nil {
+			return err
+		}
+	default:
+		// device nodes, fifos etc. are not supported. jobs get a minimal /dev
+		return nil
+	}
+
+	if os.Geteuid() == 0 {
+		return os.Lchown(target, hdr.Uid, hdr.Gid)
+	}
+
+	return nil
+}
+
+// securePath resolves tarball entry name to a path under dest, making sure neither the name,
+// nor already extracted symlinks lead outside dest.
+func securePath(dest, name string) (string, error) {
+	target := filepath.Join(dest, filepath.Clean("/"+name))
+	if !within(dest, target) {
+		return "", fmt.Errorf("path is outside the image: %q", name)
+	}
+
+	rel, _ := filepath.Rel(dest, target)
+	if rel == "." {
+		return target, nil
+	}
+
+	// check the parent directories of the entry are not symlinks
+	cur := dest
+	parts := strings.Split(filepath.Dir(rel), string(filepath.Separator))
+	for _, p := range parts {
+		if p == "." {
+			continue
+		}
+		cur = filepath.Join(cur, p)
+		fi, err := os.Lstat(cur)
+		if os.IsNotExist(err) {
+			if err := os.MkdirAll(cur, 0755); err != nil {
+				return "", err
+			}
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return "", fmt.Errorf("path goes through a symlink: %q", name)
+		}
+		if !fi.IsDir() {
+			return "", fmt.Errorf("parent is not a directory: %q", name)
+		}
+	}
+
+	return target, nil
+}
@@ -0,0 +1,102 @@
+package image
+
+import (
+	"archive/tar"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type entry struct {
+	hdr  tar.Header
+	data string
+}
+
+// writeTar creates a tarball file with the given entries.
+func writeTar(t *testing.T, file string, entries []entry) {
+	f, err := os.Create(file)
+	assert.NoError(t, err)
+
+	w := tar.NewWriter(f)
+	for _, e := range entries {
+		e.hdr.Size = int64(len(e.data))
+		assert.NoError(t, w.WriteHeader(&e.hdr))
+		_, err := w.Write([]byte(e.data))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, w.Close())
+	assert.NoError(t, f.Close())
+}
+
+func TestLoadTarball(t *testing.T) {
+	root := t.TempDir()
+
+	writeTar(t, filepath.Join(root, "base.tar"), []entry{
+		{hdr: tar.Header{Name: "bin/", Typeflag: tar.TypeDir, Mode: 0755}},
+		{hdr: tar.Header{Name: "bin/sh", Typeflag: tar.TypeReg, Mode: 0755}, data: "#!"},
+		{hdr: tar.Header{Name: "bin/bash", Typeflag: tar.TypeSymlink, Linkname: "/bin/sh"}},
+	})
+
+	images, err := Load(root, map[string]string{"base": "base.tar"})
+	assert.NoError(t, err)
+
+	dir := filepath.Join(root, "images", "base")
+	assert.Equal(t, map[string]string{"base": dir}, images)
+
+	data, err := os.ReadFile(filepath.Join(dir, "bin", "sh"))
+	assert.NoError(t, err)
+	assert.Equal(t, "#!", string(data))
+
+	link, err := os.Readlink(filepath.Join(dir, "bin", "bash"))
+	assert.NoError(t, err)
+	assert.Equal(t, "/bin/sh", link)
+
+	for _, mp := range MountPoints {
+		assert.DirExists(t, filepath.Join(dir, mp))
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	root := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, "debian"), 0755))
+
+	images, err := Load(root, map[string]string{"debian": "debian"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"debian": filepath.Join(root, "debian")}, images)
+
+	_, err = Load(root, map[string]string{"outside": t.TempDir()})
+	assert.Error(t, err, "images outside workroot must be rejected")
+
+	_, err = Load("", map[string]string{"debian": "debian"})
+	assert.Error(t, err)
+}
+
+func TestUnpackEscape(t *testing.T) {
+	outside := t.TempDir()
+
+	for _, entries := range [][]entry{
+		{
+			{hdr: tar.Header{Name: "../../escape", Typeflag: tar.TypeReg, Mode: 0644}, data: "x"},
+		},
+		{
+			{hdr: tar.Header{Name: "etc", Typeflag: tar.TypeSymlink, Linkname: outside}},
+			{hdr: tar.Header{Name: "etc/passwd", Typeflag: tar.TypeReg, Mode: 0644}, data: "x"},
+		},
+		{
+			{hdr: tar.Header{Name: "passwd", Typeflag: tar.TypeSymlink, Linkname: filepath.Join(outside, "passwd")}},
+			{hdr: tar.Header{Name: "passwd", Typeflag: tar.TypeReg, Mode: 0644}, data: "x"},
+		},
+	} {
+		root := t.TempDir()
+		writeTar(t, filepath.Join(root, "bad.tar"), entries)
+
+		_, _ = Load(root, map[string]string{"bad": "bad.tar"})
+
+		files, err := os.ReadDir(outside)
+		assert.NoError(t, err)
+		assert.Empty(t, files, "nothing must be written outside the image")
+		assert.NoFileExists(t, filepath.Join(root, "..", "escape"))
+	}
+}
@@ -0,0 +1,190 @@
+//go:build linux
+
+package job
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// ErrInvalidCapability means the capability name is unknown.
+var ErrInvalidCapability = errors.New("invalid capability")
+
+// Capability is a Linux capability, e.g. unix.CAP_NET_BIND_SERVICE.
+type Capability int
+
+// capabilityNames maps capabilities to their names, without CAP_ prefix.
+var capabilityNames = map[Capability]string{
+	unix.CAP_CHOWN:              "CHOWN",
+	unix.CAP_DAC_OVERRIDE:       "DAC_OVERRIDE",
+	unix.CAP_DAC_READ_SEARCH:    "DAC_READ_SEARCH",
+	unix.CAP_FOWNER:             "FOWNER",
+	unix.CAP_FSETID:             "FSETID",
+	unix.CAP_KILL:               "KILL",
+	unix.CAP_SETGID:             "SETGID",
+	unix.CAP_SETUID:             "SETUID",
+	unix.CAP_SETPCAP:            "SETPCAP",
+	unix.CAP_LINUX_IMMUTABLE:    "LINUX_IMMUTABLE",
+	unix.CAP_NET_BIND_SERVICE:   "NET_BIND_SERVICE",
+	unix.CAP_NET_BROADCAST:      "NET_BROADCAST",
+	unix.CAP_NET_ADMIN:          "NET_ADMIN",
+	unix.CAP_NET_RAW:            "NET_RAW",
+	unix.CAP_IPC_LOCK:           "IPC_LOCK",
+	unix.CAP_IPC_OWNER:          "IPC_OWNER",
+	unix.CAP_SYS_MODULE:         "SYS_MODULE",
+	unix.CAP_SYS_RAWIO:          "SYS_RAWIO",
+	unix.CAP_SYS_CHROOT:         "SYS_CHROOT",
+	unix.CAP_SYS_PTRACE:         "SYS_PTRACE",
+	unix.CAP_SYS_PACCT:          "SYS_PACCT",
+	unix.CAP_SYS_ADMIN:          "SYS_ADMIN",
+	unix.CAP_SYS_BOOT:           "SYS_BOOT",
+	unix.CAP_SYS_NICE:           "SYS_NICE",
+	unix.CAP_SYS_RESOURCE:       "SYS_RESOURCE",
+	unix.CAP_SYS_TIME:           "SYS_TIME",
+	unix.CAP_SYS_TTY_CONFIG:     "SYS_TTY_CONFIG",
+	unix.CAP_MKNOD:              "MKNOD",
+	unix.CAP_LEASE:              "LEASE",
+	unix.CAP_AUDIT_WRITE:        "AUDIT_WRITE",
+	unix.CAP_AUDIT_CONTROL:      "AUDIT_CONTROL",
+	unix.CAP_SETFCAP:            "SETFCAP",
+	unix.CAP_MAC_OVERRIDE:       "MAC_OVERRIDE",
+	unix.CAP_MAC_ADMIN:          "MAC_ADMIN",
+	unix.CAP_SYSLOG:             "SYSLOG",
+	unix.CAP_WAKE_ALARM:         "WAKE_ALARM",
+	unix.CAP_BLOCK_SUSPEND:      "BLOCK_SUSPEND",
+	unix.CAP_AUDIT_READ:         "AUDIT_READ",
+	unix.CAP_PERFMON:            "PERFMON",
+	unix.CAP_BPF:                "BPF",
+	unix.CAP_CHECKPOINT_RESTORE: "CHECKPOINT_RESTORE",
+}
+
+// String returns the capability name, e.g. CAP_NET_RAW.
+func (c Capability) String() string {
+	if n, ok := capabilityNames[c]; ok {
+		return "CAP_" + n
+	}
+	return "CAP_" + strconv.Itoa(int(c))
+}
+
+// ParseCapability parses a capability name. Case-insensitive, CAP_ prefix is optional.
+func ParseCapability(s string) (Capability, error) {
+	name := strings.TrimPrefix(strings.ToUpper(s), "CAP_")
+	for c, n := range capabilityNames {
+		if n == name {
+			return c, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %q", ErrInvalidCapability, s)
+}
+
+// ParseCaps parses a comma-separated list of capabilities.
+func ParseCaps(s string) ([]Capability, error) {
+	var rt []Capability
+	if s == "" {
+		return rt, nil
+	}
+
+	for _, part := range strings.Split(s, ",") {
+		c, err := ParseCapability(part)
+		if err != nil {
+			return nil, err
+		}
+		rt = append(rt, c)
+	}
+
+	return rt, nil
+}
+
+// FormatCaps formats capabilities as a sorted comma-separated list, suitable for ParseCaps.
+func FormatCaps(caps []Capability) string {
+	var parts []string
+	for _, c := range caps {
+		parts = append(parts, c.String())
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+// lastCap returns the highest capability supported by the kernel.
+func lastCap() Capability {
+	data, err := os.ReadFile("/proc/sys/kernel/cap_last_cap")
+	if err != nil {
+		return unix.CAP_LAST_CAP
+	}
+	c, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return unix.CAP_LAST_CAP
+	}
+	return Capability(c)
+}
+
+// dropCaps limits the bounding set of the current thread to caps, and clears the ambient set.
+// Capability sets are per-thread, so the calling goroutine is locked to the thread for good:
+// the job command must be started from it. Must be called before setupIDs.
+func dropCaps(caps []Capability) error {
+	runtime.LockOSThread()
+
+	keep := make(map[Capability]bool)
+	for _, c := range caps {
+		keep[c] = true
+	}
+
+	for c := Capability(0); c <= lastCap(); c++ {
+		if keep[c] {
+			continue
+		}
+		if err := unix.Prctl(unix.PR_CAPBSET_DROP, uintptr(c), 0, 0, 0); err != nil {
+			return fmt.Errorf("failed to drop %s: %w", c, err)
+		}
+	}
+
+	if err := unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_CLEAR_ALL, 0, 0, 0); err != nil {
+		return fmt.Errorf("failed to clear ambient capabilities: %w", err)
+	}
+
+	// keep the permitted set when switching from root to the job UID
+	if len(caps) > 0 {
+		if err := unix.Prctl(unix.PR_SET_KEEPCAPS, 1, 0, 0, 0); err != nil {
+			return fmt.Errorf("failed to keep capabilities: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// raiseCaps sets the permitted, effective and inheritable sets of the current thread to caps,
+// and raises them in the ambient set, for a non-root job command to keep them. Sets no_new_privs,
+// so that setuid binaries can't gain privileges. Must be called after setupIDs.
+func raiseCaps(caps []Capability) error {
+	hdr := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	var data [2]unix.CapUserData
+	for _, c := range caps {
+		bit := uint32(1) << (uint(c) % 32)
+		data[c/32].Permitted |= bit
+		data[c/32].Effective |= bit
+		data[c/32].Inheritable |= bit
+	}
+
+	if err := unix.Capset(&hdr, &data[0]); err != nil {
+		return fmt.Errorf("failed to set capabilities: %w", err)
+	}
+
+	for _, c := range caps {
+		if err := unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_RAISE, uintptr(c), 0, 0); err != nil {
+			return fmt.Errorf("failed to raise %s: %w", c, err)
+		}
+	}
+
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("failed to set no_new_privs: %w", err)
+	}
+
+	return nil
+}
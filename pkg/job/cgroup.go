@@ -4,16 +4,15 @@ package job
 
 import (
 	"bufio"
-	"bytes"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"syscall"
 
 	"github.com/rs/zerolog/log"
+	"golang.org/x/sys/unix"
 )
 
 // echo appends string "text" to file "file".
@@ -43,6 +42,38 @@ func echo(text, file string) error {
 	return nil
 }
 
+// DefaultControllers are the cgroup controllers enabled for a job unless configured otherwise.
+var DefaultControllers = []string{"io", "cpu", "memory"}
+
+// knownControllers are the cgroup v2 controllers which may be enabled for a job.
+var knownControllers = map[string]bool{
+	"cpu": true, "cpuset": true, "io": true, "memory": true, "pids": true, "hugetlb": true, "rdma": true, "misc": true,
+}
+
+// validateControllers checks the controllers are known, and the ones required by the limits are enabled.
+func (j *Job) validateControllers() error {
+	enabled := make(map[string]bool)
+	for _, c := range j.controllers {
+		if !knownControllers[c] {
+			return fmt.Errorf("%w: unknown cgroup controller %q", ErrInvalidLimits, c)
+		}
+		enabled[c] = true
+	}
+
+	l := j.limits
+	for c, required := range map[string]bool{
+		"cpu":    l.CPU > 0,
+		"memory": l.MaxRAMBytes > 0 || l.HighRAMBytes > 0 || l.LowRAMBytes > 0 || l.MinRAMBytes > 0 || l.MaxSwapBytes != nil,
+		"io":     l.MaxDiskIOBytes > 0 || len(l.Devices) > 0 || l.IOWeight > 0,
+	} {
+		if required && !enabled[c] {
+			return fmt.Errorf("%w: %s controller is not enabled", ErrInvalidLimits, c)
+		}
+	}
+
+	return nil
+}
+
 // cgroupName creates a cgroup name based on Job ID
 func cgroupName(jid ID) string {
 	return "job-" + string(jid)
@@ -86,35 +117,57 @@ func (j *Job) setupCgroup() (ferr error) {
 		return fmt.Errorf("failed to create cgroup: %w", err)
 	}
 
-	if err := echo("+io +cpu +memory", filepath.Join(j.cgroupOuter, "cgroup.subtree_control")); err != nil {
-		return fmt.Errorf("failed to setup cgroup: %w", err)
+	if len(j.controllers) > 0 {
+		enable := "+" + strings.Join(j.controllers, " +")
+		if err := echo(enable, filepath.Join(j.cgroupOuter, "cgroup.subtree_control")); err != nil {
+			return fmt.Errorf("failed to setup cgroup: %w", err)
+		}
 	}
 
 	// limit disk IO
-	if j.limits.MaxDiskIOBytes > 0 {
-		blocks, err := listBlockDevs()
+	if err := j.setupIO(); err != nil {
+		return fmt.Errorf("failed to configure IO limits: %w", err)
+	}
+
+	// limit RAM
+	if j.limits.MaxRAMBytes > 0 {
+		err := echo(itoa(j.limits.MaxRAMBytes), filepath.Join(j.cgroupInner, "memory.max"))
 		if err != nil {
-			return fmt.Errorf("failed to configure IO limits: %w", err)
+			return fmt.Errorf("failed to configure RAM limits: %w", err)
 		}
+	}
 
-		rate := itoa(j.limits.MaxDiskIOBytes)
+	// throttle RAM usage before OOM
+	if j.limits.HighRAMBytes > 0 {
+		err := echo(itoa(j.limits.HighRAMBytes), filepath.Join(j.cgroupInner, "memory.high"))
+		if err != nil {
+			return fmt.Errorf("failed to configure RAM limits: %w", err)
+		}
+	}
 
-		for _, b := range blocks {
-			txt := fmt.Sprintf("%s rbps=%s wbps=%s", b, rate, rate)
-			if err := echo(txt, filepath.Join(j.cgroupInner, "io.max")); err != nil {
-				return fmt.Errorf("failed to configure IO limits: %w", err)
-			}
+	// protect RAM from reclaim
+	if j.limits.LowRAMBytes > 0 {
+		err := echo(itoa(j.limits.LowRAMBytes), filepath.Join(j.cgroupInner, "memory.low"))
+		if err != nil {
+			return fmt.Errorf("failed to configure RAM limits: %w", err)
 		}
 	}
 
-	// limit RAM
-	if j.limits.MaxRAMBytes > 0 {
-		err := echo(itoa(j.limits.MaxRAMBytes), filepath.Join(j.cgroupInner, "memory.max"))
+	if j.limits.MinRAMBytes > 0 {
+		err := echo(itoa(j.limits.MinRAMBytes), filepath.Join(j.cgroupInner, "memory.min"))
 		if err != nil {
 			return fmt.Errorf("failed to configure RAM limits: %w", err)
 		}
 	}
 
+	// limit swap
+	if j.limits.MaxSwapBytes != nil {
+		err := echo(strconv.FormatInt(*j.limits.MaxSwapBytes, 10), filepath.Join(j.cgroupInner, "memory.swap.max"))
+		if err != nil {
+			return fmt.Errorf("failed to configure swap limits: %w", err)
+		}
+	}
+
 	// limit CPU usage
 	if j.limits.CPU > 0. {
 		period := float32(10000.)
@@ -136,32 +189,186 @@ func addPidToCgroup(pid int, cgPath string) error {
 	return nil
 }
 
-// ListBlockDevs enumerates all disk root devices
-// require 'lsblk' to be installed
-func listBlockDevs() ([]string, error) {
-	var rt []string
+// setupIO applies disk IO limits and IO weight to the inner job cgroup.
+// MaxDiskIOBytes is applied to reads and writes of all disks, per-device limits override it.
+func (j *Job) setupIO() error {
+	limits := make(map[string]DeviceIOLimit)
+	// keep the order of devices to make io.max content predictable
+	var devs []string
+
+	set := func(l DeviceIOLimit) {
+		if _, ok := limits[l.Device]; !ok {
+			devs = append(devs, l.Device)
+		}
+		limits[l.Device] = l
+	}
+
+	if j.limits.MaxDiskIOBytes > 0 || hasAllDevices(j.limits.Devices) {
+		blocks, err := listBlockDevs()
+		if err != nil {
+			return err
+		}
+		for _, b := range blocks {
+			set(DeviceIOLimit{
+				Device:   b,
+				ReadBPS:  j.limits.MaxDiskIOBytes,
+				WriteBPS: j.limits.MaxDiskIOBytes,
+			})
+		}
+	}
+
+	for _, d := range j.limits.Devices {
+		if d.Device == AllDevices {
+			for _, b := range devs {
+				set(d.merge(limits[b], b))
+			}
+			continue
+		}
+
+		dev, err := resolveBlockDev(d.Device)
+		if err != nil {
+			return err
+		}
+		set(d.merge(limits[dev], dev))
+	}
+
+	for _, dev := range devs {
+		txt := limits[dev].ioMax()
+		if txt == "" {
+			continue
+		}
+		if err := echo(txt, filepath.Join(j.cgroupInner, "io.max")); err != nil {
+			return err
+		}
+	}
+
+	if j.limits.IOWeight > 0 {
+		txt := fmt.Sprintf("default %d", j.limits.IOWeight)
+		if err := echo(txt, filepath.Join(j.cgroupInner, "io.weight")); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// hasAllDevices checks if any of the limits applies to all disks.
+func hasAllDevices(limits []DeviceIOLimit) bool {
+	for _, l := range limits {
+		if l.Device == AllDevices {
+			return true
+		}
+	}
+	return false
+}
+
+// merge returns a copy of base limits for device dev, overridden by non-zero values of l.
+func (l DeviceIOLimit) merge(base DeviceIOLimit, dev string) DeviceIOLimit {
+	base.Device = dev
+	if l.ReadBPS > 0 {
+		base.ReadBPS = l.ReadBPS
+	}
+	if l.WriteBPS > 0 {
+		base.WriteBPS = l.WriteBPS
+	}
+	if l.ReadIOPS > 0 {
+		base.ReadIOPS = l.ReadIOPS
+	}
+	if l.WriteIOPS > 0 {
+		base.WriteIOPS = l.WriteIOPS
+	}
+	return base
+}
+
+// ioMax formats the limit as io.max cgroup file line. Returns empty string if no limits set.
+func (l DeviceIOLimit) ioMax() string {
+	var parts []string
+	for _, v := range []struct {
+		key   string
+		value int64
+	}{
+		{"rbps", l.ReadBPS},
+		{"wbps", l.WriteBPS},
+		{"riops", l.ReadIOPS},
+		{"wiops", l.WriteIOPS},
+	} {
+		if v.value > 0 {
+			parts = append(parts, v.key+"="+itoa(v.value))
+		}
+	}
+
+	if len(parts) == 0 {
+		return ""
+	}
 
-	cmd := exec.Command("lsblk", "-d")
-	out, err := cmd.CombinedOutput()
+	return l.Device + " " + strings.Join(parts, " ")
+}
+
+// sysBlockPath is where the kernel lists block devices. Overridden in tests.
+var sysBlockPath = "/sys/block"
+
+// listBlockDevs enumerates all physical disk root devices as "major:minor" strings.
+// Virtual devices (loop, ram, zram, device mapper) have no 'device' link and are skipped.
+func listBlockDevs() ([]string, error) {
+	entries, err := os.ReadDir(sysBlockPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to enlist block devices: %w", err)
 	}
-	s := bufio.NewScanner(bytes.NewReader(out))
-	for s.Scan() {
-		parts := strings.Fields(s.Text())
-		if len(parts) < 6 {
-			return nil, fmt.Errorf("unexpected output of lsblk: %q", s.Text())
+
+	var rt []string
+	for _, e := range entries {
+		if _, err := os.Stat(filepath.Join(sysBlockPath, e.Name(), "device")); err != nil {
+			continue
 		}
-		if parts[5] == "disk" {
-			rt = append(rt, parts[1])
+
+		dev, err := os.ReadFile(filepath.Join(sysBlockPath, e.Name(), "dev"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read block device %q: %w", e.Name(), err)
 		}
+		rt = append(rt, strings.TrimSpace(string(dev)))
+	}
+
+	return rt, nil
+}
+
+// resolveBlockDev converts a block device given as "major:minor" or as a device file path under /dev
+// to "major:minor" form. The server stats the path as root, so all the failures look the same,
+// not to tell what exists on the host.
+func resolveBlockDev(dev string) (string, error) {
+	if isDevNumber(dev) {
+		return dev, nil
 	}
 
-	if s.Err() != nil {
-		return nil, fmt.Errorf("failed to scan block devices: %w", s.Err())
+	invalid := fmt.Errorf("%w: invalid block device %q", ErrInvalidLimits, dev)
+	if filepath.Clean(dev) != dev || !strings.HasPrefix(dev, "/dev/") {
+		return "", invalid
 	}
 
-	return rt, nil
+	fi, err := os.Stat(dev)
+	if err != nil {
+		return "", invalid
+	}
+
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if fi.Mode()&os.ModeDevice == 0 || fi.Mode()&os.ModeCharDevice != 0 || !ok {
+		return "", invalid
+	}
+
+	rdev := uint64(st.Rdev) //nolint:unconvert // Rdev type differs between arches
+	return fmt.Sprintf("%d:%d", unix.Major(rdev), unix.Minor(rdev)), nil
+}
+
+// isDevNumber checks if s has "major:minor" format.
+func isDevNumber(s string) bool {
+	maj, min, ok := strings.Cut(s, ":")
+	if !ok {
+		return false
+	}
+	if _, err := strconv.ParseUint(maj, 10, 32); err != nil {
+		return false
+	}
+	_, err := strconv.ParseUint(min, 10, 32)
+	return err == nil
 }
 
 // findCgroupMount returns the current mount point of cgroup2 FS if exist
@@ -187,24 +394,6 @@ func findCgroupMount() (bool, string) {
 	return false, ""
 }
 
-// SetupProc is intended to be called from shim process, adding the process to required cgroup
-// and configuring /proc to make tools like top and ps work
-func SetupProc(cgPath string, identity ExecIdentity) error {
-	if err := remountProc(); err != nil {
-		return err
-	}
-
-	if err := addPidToCgroup(os.Getpid(), cgPath); err != nil {
-		return err
-	}
-
-	if err := setupIDs(identity); err != nil {
-		return err
-	}
-
-	return nil
-}
-
 // setupIDs sets UID and GID of the current process.
 func setupIDs(ids ExecIdentity) error {
 
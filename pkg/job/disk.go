@@ -0,0 +1,107 @@
+//go:build linux
+
+package job
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// diskUsageTTL is how long the working directory size is cached, if there's no disk limit
+const diskUsageTTL = 10 * time.Second
+
+// mountWorkDir mounts a size-capped tmpfs to the job working directory, if disk limit is set.
+// tmpfs pages are charged to the memory cgroup of the job writing them.
+func (j *Job) mountWorkDir() error {
+	if j.limits.MaxDiskBytes == 0 {
+		return nil
+	}
+
+	ids := j.hostIDs()
+	data := fmt.Sprintf("size=%d,mode=0700,uid=%d,gid=%d", j.limits.MaxDiskBytes, ids.UID, ids.GID)
+	if err := j.syscalls.mount("tmpfs", j.workDir, "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, data); err != nil {
+		return fmt.Errorf("failed to mount working dir: %w", err)
+	}
+
+	return nil
+}
+
+// unmountWorkDir unmounts the job working directory tmpfs, if any.
+func (j *Job) unmountWorkDir() error {
+	if j.limits.MaxDiskBytes == 0 || j.workDir == "" {
+		return nil
+	}
+
+	err := j.syscalls.unmount(j.workDir, unix.MNT_DETACH)
+	if err != nil && !errors.Is(err, unix.EINVAL) {
+		// EINVAL means it's not mounted already
+		return fmt.Errorf("failed to unmount working dir: %w", err)
+	}
+
+	return nil
+}
+
+// cachedDiskUsage returns the number of bytes used in the job working directory. Statfs of the tmpfs is cheap,
+// so it's only the directory walk, without the disk limit, that is cached for diskUsageTTL.
+func (j *Job) cachedDiskUsage() (int64, error) {
+	if j.limits.MaxDiskBytes > 0 {
+		return j.diskUsage()
+	}
+
+	j.diskLock.Lock()
+	defer j.diskLock.Unlock()
+
+	if !j.diskChecked.IsZero() && time.Since(j.diskChecked) < diskUsageTTL {
+		return j.diskUsed, nil
+	}
+
+	usage, err := j.diskUsage()
+	if err != nil {
+		return 0, err
+	}
+	j.diskUsed, j.diskChecked = usage, time.Now()
+	return usage, nil
+}
+
+// diskUsage returns the number of bytes used in the job working directory.
+func (j *Job) diskUsage() (int64, error) {
+	if j.limits.MaxDiskBytes > 0 {
+		var st unix.Statfs_t
+		if err := unix.Statfs(j.workDir, &st); err != nil {
+			return 0, err
+		}
+		return int64(st.Blocks-st.Bfree) * st.Bsize, nil
+	}
+
+	var rt int64
+	err := filepath.WalkDir(j.workDir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			fi, err := d.Info()
+			if err != nil {
+				return err
+			}
+			rt += fi.Size()
+		}
+		return nil
+	})
+
+	return rt, err
+}
+
+// mountFs is just a wrapper around unix.Mount. for mocks.
+func mountFs(source, target, fstype string, flags uintptr, data string) error {
+	return unix.Mount(source, target, fstype, flags, data)
+}
+
+// unmountFs is just a wrapper around unix.Unmount. for mocks.
+func unmountFs(target string, flags int) error {
+	return unix.Unmount(target, flags)
+}
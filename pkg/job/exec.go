@@ -0,0 +1,356 @@
+//go:build linux
+
+package job
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/ilyazz/jobs/pkg/seccomp"
+	"golang.org/x/sys/unix"
+)
+
+// ErrNotRunning means the job process is not running.
+var ErrNotRunning = errors.New("job is not running")
+
+// setnsTypes are the namespaces an exec'd process may enter, in the order entered, with their setns(2) types.
+// The user namespace is not there: a threaded process can't enter one.
+var setnsTypes = []struct {
+	ns   Namespace
+	flag int
+}{
+	{NsPID, unix.CLONE_NEWPID},
+	{NsNet, unix.CLONE_NEWNET},
+	{NsUTS, unix.CLONE_NEWUTS},
+	{NsIPC, unix.CLONE_NEWIPC},
+	{NsMount, unix.CLONE_NEWNS},
+}
+
+// execParentFd is the fd of the process set up with SetupExecProc: a pipe hung up once the exec shim is gone.
+const execParentFd = 4
+
+// Process is a command executed in a running job.
+type Process struct {
+	cmd      *exec.Cmd
+	syscalls sysFun
+}
+
+// Exec starts a command in the namespaces and cgroup of the running job, with the job identity,
+// rlimits, capabilities and seccomp profile. The process counts against the job limits. If stdin
+// is not an *os.File, Wait blocks until it's closed. In a job with its own user namespace the command
+// runs with the host IDs of the job identity, without capabilities.
+func (j *Job) Exec(command string, args []string, stdin io.Reader, stdout, stderr io.Writer) (*Process, error) {
+	j.stateLock.Lock()
+	defer j.stateLock.Unlock()
+
+	if j.handler.status() != StatusActive {
+		return nil, ErrNotRunning
+	}
+
+	if j.restartTimer != nil {
+		// waiting for a restart, there's no process
+		return nil, ErrNotRunning
+	}
+
+	c := exec.Command(j.shimPath, j.execArgs(command, args)...)
+	c.Stdin = stdin
+	c.Stdout = stdout
+	c.Stderr = stderr
+
+	if err := j.syscalls.start(c); err != nil {
+		return nil, fmt.Errorf("failed to exec: %w", err)
+	}
+
+	j.log.Info().Str("cmd", command).Int("pid", c.Process.Pid).Msg("exec in the job")
+
+	return &Process{cmd: c, syscalls: j.syscalls}, nil
+}
+
+// execArgs creates a string slice of arguments to be passed to the shim process in exec mode.
+func (j *Job) execArgs(command string, args []string) []string {
+	ids, caps := j.ids, j.caps
+	if j.userNS != nil {
+		// the command stays in the host user namespace, capabilities would be the host ones
+		ids, caps = j.hostIDs(), nil
+	}
+
+	var ns []string
+	for _, n := range j.allNamespaces() {
+		if n != NsUser {
+			ns = append(ns, string(n))
+		}
+	}
+
+	rt := []string{"--mode=exec",
+		fmt.Sprintf("--cmd=%s", command),
+		fmt.Sprintf("--target=%d", j.cmd.Process.Pid),
+		fmt.Sprintf("--cgroup=%s", j.cgroupInner),
+		fmt.Sprintf("--namespaces=%s", strings.Join(ns, ",")),
+	}
+
+	rt = append(rt,
+		fmt.Sprintf("--uid=%d", ids.UID),
+		fmt.Sprintf("--gid=%d", ids.GID),
+	)
+
+	if len(j.rlimits) > 0 {
+		rt = append(rt, fmt.Sprintf("--rlimits=%s", FormatRlimits(j.rlimits)))
+	}
+
+	if len(caps) > 0 {
+		rt = append(rt, fmt.Sprintf("--caps=%s", FormatCaps(caps)))
+	}
+
+	if j.seccomp != "" {
+		rt = append(rt, fmt.Sprintf("--seccomp=%s", j.seccompProfile()))
+	}
+
+	if len(args) > 0 {
+		rt = append(rt, "--")
+		rt = append(rt, args...)
+	}
+
+	return rt
+}
+
+// Wait waits for the process to exit, and returns its exit code.
+func (p *Process) Wait() (int, error) {
+	err := p.syscalls.wait(p.cmd)
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return -1, err
+	}
+	return p.cmd.ProcessState.ExitCode(), nil
+}
+
+// Kill kills the process.
+func (p *Process) Kill() error {
+	return p.syscalls.signal(p.cmd, syscall.SIGKILL)
+}
+
+// EnterJob is intended to be called from shim process in exec mode. It adds the process to the job
+// cgroup, enters namespaces ns of the job process target, and the job root and working dir, on the
+// current thread, and starts the shim binary again from it, to set up the process inside with
+// SetupExecProc and execute the command. The process joins the PID namespace this way, and is killed
+// with the shim. Returns the exit code of the process.
+func EnterJob(command string, args []string, cfg ProcConfig, target int, ns []Namespace) (int, error) {
+	if err := addPidToCgroup(os.Getpid(), cfg.Cgroup); err != nil {
+		return -1, err
+	}
+
+	proc := fmt.Sprintf("/proc/%d", target)
+	var files []*os.File
+	defer func() {
+		for _, f := range files {
+			_ = f.Close()
+		}
+	}()
+	open := func(path string) (*os.File, error) {
+		f, err := os.Open(path)
+		if err == nil {
+			files = append(files, f)
+		}
+		return f, err
+	}
+
+	// the shim binary, the seccomp profile and the target namespaces are out of reach inside the job.
+	// The first two are passed to the process as fds 3 and 5, the pipe as execParentFd
+	self, err := open("/proc/self/exe")
+	if err != nil {
+		return -1, err
+	}
+
+	// the parent death signal can't be set on start in another PID namespace, the process sets it,
+	// and checks the shim is still there with the pipe
+	parentR, parentW, err := os.Pipe()
+	if err != nil {
+		return -1, err
+	}
+	files = append(files, parentR, parentW)
+	extra := []*os.File{self, parentR}
+
+	profile := cfg.Seccomp
+	if profile != "" && profile != seccomp.DefaultProfile {
+		f, err := open(profile)
+		if err != nil {
+			return -1, err
+		}
+		extra = append(extra, f)
+		profile = "/proc/self/fd/5"
+	}
+
+	enter := make(map[Namespace]bool)
+	for _, n := range ns {
+		enter[n] = true
+	}
+	type nsFile struct {
+		f    *os.File
+		flag int
+	}
+	var nsFiles []nsFile
+	for _, t := range setnsTypes {
+		if !enter[t.ns] {
+			continue
+		}
+		delete(enter, t.ns)
+		f, err := open(filepath.Join(proc, "ns", string(t.ns)))
+		if err != nil {
+			return -1, err
+		}
+		nsFiles = append(nsFiles, nsFile{f: f, flag: t.flag})
+	}
+	for n := range enter {
+		return -1, fmt.Errorf("%w: can't enter %q", ErrInvalidNamespace, n)
+	}
+
+	root, err := open(proc + "/root")
+	if err != nil {
+		return -1, err
+	}
+	wd, err := open(proc + "/cwd")
+	if err != nil {
+		return -1, err
+	}
+
+	// the namespaces and the root are changed for this thread only, and the process is started from it.
+	// The thread is never unlocked, it's gone with the shim
+	runtime.LockOSThread()
+
+	// a thread sharing the filesystem attributes with others can't enter a mount namespace
+	if err := unix.Unshare(unix.CLONE_FS); err != nil {
+		return -1, fmt.Errorf("failed to unshare fs attributes: %w", err)
+	}
+	for _, n := range nsFiles {
+		if err := unix.Setns(int(n.f.Fd()), n.flag); err != nil {
+			return -1, fmt.Errorf("failed to enter %s: %w", n.f.Name(), err)
+		}
+	}
+	if err := unix.Fchdir(int(root.Fd())); err != nil {
+		return -1, err
+	}
+	if err := unix.Chroot("."); err != nil {
+		return -1, fmt.Errorf("failed to enter the job root: %w", err)
+	}
+	if err := unix.Fchdir(int(wd.Fd())); err != nil {
+		return -1, err
+	}
+
+	rt := []string{"--mode=exec-inner",
+		fmt.Sprintf("--cmd=%s", command),
+		fmt.Sprintf("--uid=%d", cfg.IDs.UID),
+		fmt.Sprintf("--gid=%d", cfg.IDs.GID),
+	}
+
+	if len(cfg.Rlimits) > 0 {
+		rt = append(rt, fmt.Sprintf("--rlimits=%s", FormatRlimits(cfg.Rlimits)))
+	}
+
+	if len(cfg.Caps) > 0 {
+		rt = append(rt, fmt.Sprintf("--caps=%s", FormatCaps(cfg.Caps)))
+	}
+
+	if profile != "" {
+		rt = append(rt, fmt.Sprintf("--seccomp=%s", profile))
+	}
+
+	if len(args) > 0 {
+		rt = append(rt, "--")
+		rt = append(rt, args...)
+	}
+
+	c := exec.Command("/proc/self/fd/3", rt...)
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	c.ExtraFiles = extra
+
+	if err := c.Start(); err != nil {
+		return -1, err
+	}
+	_ = parentR.Close()
+
+	err = c.Wait()
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return -1, err
+	}
+	if ws, ok := c.ProcessState.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return 128 + int(ws.Signal()), nil
+	}
+	return c.ProcessState.ExitCode(), nil
+}
+
+// SetupExecProc is intended to be called from shim process inside the job namespaces, setting
+// the job rlimits, capabilities and identity, and making the process killed with the exec shim. The
+// descriptors the shim was passed are not inherited by the command, so the seccomp profile must be loaded before.
+func SetupExecProc(cfg ProcConfig) error {
+	if err := closeOnExec(); err != nil {
+		return err
+	}
+
+	if err := setupRlimits(cfg.Rlimits); err != nil {
+		return err
+	}
+
+	if err := dropCaps(cfg.Caps); err != nil {
+		return err
+	}
+
+	if err := setupIDs(cfg.IDs); err != nil {
+		return err
+	}
+
+	if err := raiseCaps(cfg.Caps); err != nil {
+		return err
+	}
+
+	return dieWithParent()
+}
+
+// dieWithParent makes the process killed once the exec shim is gone. Changing the IDs resets
+// the parent death signal, so it's set after.
+func dieWithParent() error {
+	if err := unix.Prctl(unix.PR_SET_PDEATHSIG, uintptr(unix.SIGKILL), 0, 0, 0); err != nil {
+		return fmt.Errorf("failed to set parent death signal: %w", err)
+	}
+
+	// the shim holds the write end, the pipe is hung up if it's gone already
+	fds := []unix.PollFd{{Fd: execParentFd, Events: unix.POLLIN}}
+	n, err := unix.Poll(fds, 0)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return fmt.Errorf("exec shim is gone")
+	}
+	return nil
+}
+
+// closeOnExec marks all the file descriptors but stdio close-on-exec: the shim binary and the seccomp
+// profile are passed to the shim opened, and must not be readable by the command.
+func closeOnExec() error {
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		fd, err := strconv.Atoi(e.Name())
+		if err != nil || fd < 3 {
+			continue
+		}
+		// the directory read is closed already
+		if _, err := unix.FcntlInt(uintptr(fd), unix.F_SETFD, unix.FD_CLOEXEC); err != nil && !errors.Is(err, unix.EBADF) {
+			return fmt.Errorf("failed to close fd %d on exec: %w", fd, err)
+		}
+	}
+	return nil
+}
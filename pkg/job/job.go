@@ -3,6 +3,7 @@
 package job
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -13,6 +14,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/ilyazz/jobs/pkg/seccomp"
 	"github.com/rs/xid"
 	"github.com/rs/zerolog"
 	"github.com/spf13/afero"
@@ -26,11 +28,93 @@ type ExecIdentity struct {
 	GID int
 }
 
+// ErrInvalidLimits means the requested job limits are inconsistent.
+var ErrInvalidLimits = errors.New("invalid limits")
+
 // ExecLimits defines job resource limits.
 type ExecLimits struct {
-	CPU            float32
-	MaxRAMBytes    int64
+	CPU         float32
+	MaxRAMBytes int64
+	// HighRAMBytes is the throttling limit. The job is slowed down and reclaimed above it (memory.high)
+	HighRAMBytes int64
+	// LowRAMBytes is the best-effort memory protection (memory.low)
+	LowRAMBytes int64
+	// MinRAMBytes is the hard memory protection (memory.min)
+	MinRAMBytes int64
+	// MaxSwapBytes limits swap usage (memory.swap.max). nil means no limit, 0 disables swap
+	MaxSwapBytes   *int64
 	MaxDiskIOBytes int64
+	// Devices is a list of per-device IO limits, overriding MaxDiskIOBytes
+	Devices []DeviceIOLimit
+	// IOWeight is the proportional IO share of the job, 1-10000 (io.weight). 0 means the default weight
+	IOWeight int
+	// MaxDiskBytes caps the size of the job working directory. 0 means no limit
+	MaxDiskBytes int64
+}
+
+// AllDevices is a DeviceIOLimit.Device value to apply the limit to all disks.
+const AllDevices = "*"
+
+// DeviceIOLimit defines IO limits for a single block device. Zero values mean no limit.
+type DeviceIOLimit struct {
+	// Device is "major:minor" or a path to the block device file under /dev, e.g. /dev/sda, or AllDevices
+	Device string
+	// ReadBPS is max read rate, bytes per second
+	ReadBPS int64
+	// WriteBPS is max write rate, bytes per second
+	WriteBPS int64
+	// ReadIOPS is max read operations per second
+	ReadIOPS int64
+	// WriteIOPS is max write operations per second
+	WriteIOPS int64
+}
+
+// Validate checks the limits are not negative, and memory limits are consistent:
+// min <= low <= high <= max, ignoring the unset ones.
+func (l ExecLimits) Validate() error {
+	if l.CPU < 0 || l.MaxDiskIOBytes < 0 || (l.MaxSwapBytes != nil && *l.MaxSwapBytes < 0) || l.MaxDiskBytes < 0 {
+		return fmt.Errorf("%w: negative value", ErrInvalidLimits)
+	}
+
+	if l.IOWeight < 0 || l.IOWeight > 10000 {
+		return fmt.Errorf("%w: io weight must be in range 1-10000", ErrInvalidLimits)
+	}
+
+	for _, d := range l.Devices {
+		if d.Device == "" {
+			return fmt.Errorf("%w: empty device", ErrInvalidLimits)
+		}
+		if d.ReadBPS < 0 || d.WriteBPS < 0 || d.ReadIOPS < 0 || d.WriteIOPS < 0 {
+			return fmt.Errorf("%w: negative value for device %q", ErrInvalidLimits, d.Device)
+		}
+	}
+
+	mem := []struct {
+		name  string
+		value int64
+	}{
+		{"memory.min", l.MinRAMBytes},
+		{"memory.low", l.LowRAMBytes},
+		{"memory.high", l.HighRAMBytes},
+		{"memory.max", l.MaxRAMBytes},
+	}
+
+	prev := -1
+	for i, m := range mem {
+		if m.value < 0 {
+			return fmt.Errorf("%w: negative %s", ErrInvalidLimits, m.name)
+		}
+		if m.value == 0 {
+			continue
+		}
+		if prev >= 0 && mem[prev].value > m.value {
+			return fmt.Errorf("%w: %s (%d) exceeds %s (%d)", ErrInvalidLimits,
+				mem[prev].name, mem[prev].value, m.name, m.value)
+		}
+		prev = i
+	}
+
+	return nil
 }
 
 // stateHandler is an internal job state, defining how to handle job API methods.
@@ -45,8 +129,8 @@ type stateHandler interface {
 	exited(j *Job) stateHandler
 	// purge logs and working dir of the job
 	cleanup(j *Job) error
-	// returns a new concurrent reader object to get the job output
-	logs(j *Job) (io.ReadCloser, error)
+	// returns a new concurrent reader object to get the job output, or the output of attempt a if not nil
+	logs(j *Job, a *attempt) (io.ReadCloser, error)
 }
 
 type activeHandler struct{}
@@ -81,6 +165,28 @@ type Job struct {
 	workDir string
 	// path to a binary to be used as a shim process
 	shimPath string
+	// job root filesystem directory. empty to use the host root
+	rootFS string
+	// host paths mounted into the job
+	volumes []Mount
+	// network mode, and the host side of the bridge network
+	netMode NetMode
+	network Network
+	// host IDs mapped to the job user namespace. nil if the job shares the host one
+	userNS *IDRange
+	// seccomp profile name, and the profile file. The built-in profile if the path is empty
+	seccomp     string
+	seccompPath string
+	// capabilities the job keeps
+	caps []Capability
+	// optional namespaces of the job. nil means DefaultNamespaces
+	namespaces []Namespace
+	// job hostname, in its own UTS namespace
+	hostname string
+	// cgroup controllers enabled for the job. nil means DefaultControllers
+	controllers []string
+	// extra environment variables of the job command, KEY=VALUE
+	env []string
 
 	// wait group to control concurrent access to the output
 	outLock    sync.WaitGroup
@@ -88,6 +194,8 @@ type Job struct {
 
 	// output file path
 	outFilePath string
+	// output file, shared by all attempts. Closed when the job ends
+	out afero.File
 
 	// path to the outer cgroup controller used by the job
 	cgroupOuter string
@@ -102,18 +210,34 @@ type Job struct {
 	// Cmd object to represent the job process
 	cmd *exec.Cmd
 
-	//
+	// exit code of the last attempt
 	exitCode int
 	done     chan struct{}
 
-	limits ExecLimits
-	ids    ExecIdentity
+	// restart policy, the runs of the job command, and the pending restart
+	restart      RestartPolicy
+	attempts     []*attempt
+	restartTimer *time.Timer
+	nextRestart  time.Time
+
+	limits  ExecLimits
+	ids     ExecIdentity
+	rlimits []Rlimit
+
+	// PSI triggers to watch, and the record of fired ones
+	pressureTriggers []PressureTrigger
+	pressureEvents   []PressureEvent
 
 	stopTimer *time.Timer
 
 	stateLock sync.Mutex
 	handler   stateHandler
 
+	// working directory size, cached for diskUsageTTL, if there's no disk limit
+	diskLock    sync.Mutex
+	diskUsed    int64
+	diskChecked time.Time
+
 	syscalls sysFun
 	log      zerolog.Logger
 }
@@ -154,6 +278,69 @@ func New(cmd string, args []string, opts ...Option) (_ *Job, reterr error) {
 	j.Command = cmd
 	j.Args = args
 
+	var err error
+	if err = j.limits.Validate(); err != nil {
+		return nil, err
+	}
+
+	if j.controllers == nil {
+		j.controllers = DefaultControllers
+	}
+	if err = j.validateControllers(); err != nil {
+		return nil, err
+	}
+
+	for _, r := range j.rlimits {
+		if err := r.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = j.restart.Validate(); err != nil {
+		return nil, err
+	}
+
+	for _, m := range j.volumes {
+		if err := m.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	if j.netMode, err = ParseNetMode(string(j.netMode)); err != nil {
+		return nil, err
+	}
+	if j.netMode == NetBridge && j.network == nil {
+		return nil, fmt.Errorf("%w: bridge network is not available", ErrInvalidNetwork)
+	}
+
+	if j.namespaces == nil {
+		j.namespaces = DefaultNamespaces
+	}
+	for _, ns := range j.namespaces {
+		if _, ok := namespaceFlags[ns]; !ok {
+			return nil, fmt.Errorf("%w: %q is not configurable", ErrInvalidNamespace, ns)
+		}
+	}
+
+	if hasNamespace(j.namespaces, NsUTS) {
+		if j.hostname == "" {
+			j.hostname = string(j.ID)
+		}
+		if err := validateHostname(j.hostname); err != nil {
+			return nil, err
+		}
+	} else if j.hostname != "" {
+		return nil, fmt.Errorf("%w: hostname requires uts namespace", ErrInvalidNamespace)
+	}
+
+	if j.userNS != nil {
+		if err := j.userNS.Validate(); err != nil {
+			return nil, err
+		}
+		// the job is root in its own user namespace
+		j.ids = ExecIdentity{}
+	}
+
 	if err := j.initJobDirs(); err != nil {
 		return nil, fmt.Errorf("failed to create job: %w", err)
 	}
@@ -179,7 +366,7 @@ func New(cmd string, args []string, opts ...Option) (_ *Job, reterr error) {
 		}
 	}()
 
-	of, err := appFs.Create(j.outFilePath)
+	of, err = appFs.Create(j.outFilePath)
 	if err != nil {
 		return nil, err
 	}
@@ -189,32 +376,90 @@ func New(cmd string, args []string, opts ...Option) (_ *Job, reterr error) {
 		return nil, err
 	}
 
+	var triggers []*os.File
+	defer func() {
+		if reterr != nil {
+			for _, f := range triggers {
+				_ = f.Close()
+			}
+		}
+	}()
+
+	for _, t := range j.pressureTriggers {
+		f, err := j.registerTrigger(t)
+		if err != nil {
+			return nil, err
+		}
+		triggers = append(triggers, f)
+	}
+
+	j.out = of
+	if err := j.startProc(); err != nil {
+		return nil, err
+	}
+
+	for i, f := range triggers {
+		go j.watchPressure(f, j.pressureTriggers[i])
+	}
+
+	return j, nil
+}
+
+// startProc starts an attempt of the job command: the shim process, set up and connected to the network.
+func (j *Job) startProc() error {
 	r, w, err := os.Pipe()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	defer func() { _ = r.Close() }()
 
+	// the shim waits for the process setup to finish on the read end, see prepareProc
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		_ = w.Close()
+		return err
+	}
+
+	defer func() { _ = readyR.Close() }()
+
 	j.cmd = exec.Command(j.shimPath, j.cmdArgs()...)
 
-	j.cmd.Stdout = of
-	j.cmd.Stderr = of
+	j.cmd.Stdout = j.out
+	j.cmd.Stderr = j.out
+	if len(j.env) > 0 {
+		j.cmd.Env = append(os.Environ(), j.env...)
+	}
 
-	j.cmd.ExtraFiles = append(j.cmd.ExtraFiles, w)
+	j.cmd.ExtraFiles = append(j.cmd.ExtraFiles, w, readyR)
 	j.cmd.Dir = j.workDir
 
 	j.cmd.SysProcAttr = &syscall.SysProcAttr{
-		// new net and mount namespaces
-		Unshareflags: syscall.CLONE_NEWNET | syscall.CLONE_NEWNS,
-		// new PID namespace
-		Cloneflags: syscall.CLONE_NEWPID,
+		// new mount namespace
+		Unshareflags: syscall.CLONE_NEWNS,
+	}
+
+	for _, ns := range j.namespaces {
+		j.cmd.SysProcAttr.Cloneflags |= namespaceFlags[ns]
 	}
 
+	if j.netMode != NetHost {
+		j.cmd.SysProcAttr.Unshareflags |= syscall.CLONE_NEWNET
+	}
+
+	j.setupUserNS(j.cmd.SysProcAttr)
+
 	j.log.Info().Msgf("Start proc for: %q %v", j.cmd.Path, j.cmd.Args)
 
+	a := &attempt{
+		Attempt: Attempt{Started: time.Now(), LogOffset: j.outputSize()},
+		done:    make(chan struct{}),
+	}
+
 	if err := j.syscalls.start(j.cmd); err != nil {
-		return nil, err
+		_ = w.Close()
+		_ = readyW.Close()
+		return err
 	}
 
 	// need to close the local copy of write-end to receive io.EOF when the child does the same
@@ -223,26 +468,49 @@ func New(cmd string, args []string, opts ...Option) (_ *Job, reterr error) {
 
 	childMsg, err := io.ReadAll(r)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	if len(childMsg) > 0 {
-		return nil, fmt.Errorf("failed to start the process: %q", string(childMsg))
+		_ = readyW.Close()
+		return fmt.Errorf("failed to start the process: %q", string(childMsg))
 	}
 
-	go func() {
-		defer func() { _ = of.Close() }()
+	if err := j.prepareProc(readyW); err != nil {
+		// the shim exits when the pipe is closed without the ready message
 		_ = j.syscalls.wait(j.cmd)
-		j.log.Info().Int("exit_code", j.cmd.ProcessState.ExitCode()).Msg("job ended")
+		j.detachNetwork()
+		return err
+	}
+
+	j.attempts = append(j.attempts, a)
+
+	go func(c *exec.Cmd) {
+		_ = j.syscalls.wait(c)
+		j.log.Info().Int("exit_code", c.ProcessState.ExitCode()).Msg("job command ended")
 
 		j.exited()
-	}()
+	}(j.cmd)
 
-	return j, nil
+	return nil
+
+}
+
+// outputSize returns the current size of the job output.
+func (j *Job) outputSize() int64 {
+	fi, err := j.out.Stat()
+	if err != nil {
+		j.log.Debug().Err(err).Msg("failed to get output size")
+		return 0
+	}
+	return fi.Size()
 }
 
 // rmJobDirs removes job directory structure
 func (j *Job) rmJobDirs() error {
+	if err := j.unmountWorkDir(); err != nil {
+		return err
+	}
 	return os.RemoveAll(j.jobDir)
 }
 
@@ -268,20 +536,49 @@ func (j *Job) initJobDirs() error {
 	}
 
 	// Working dir needs to be accessible by user
-	if err := appFs.Chown(wd, j.ids.UID, j.ids.GID); err != nil {
+	ids := j.hostIDs()
+	if err := appFs.Chown(wd, ids.UID, ids.GID); err != nil {
 		if err2 := appFs.RemoveAll(jobDir); err2 != nil {
 			j.log.Warn().Err(err2).Msg("failed to undo")
 		}
 		return err
 	}
 
+	// the shim in a user namespace has no host privileges, let it reach the working dir.
+	// other job directories are still not accessible
+	if j.userNS != nil {
+		for _, d := range []string{j.baseJobDir, jobDir} {
+			if err := appFs.Chmod(d, 0711); err != nil {
+				if err2 := appFs.RemoveAll(jobDir); err2 != nil {
+					j.log.Warn().Err(err2).Msg("failed to undo")
+				}
+				return err
+			}
+		}
+	}
+
 	j.jobDir = jobDir
 	j.workDir = wd
 	j.outFilePath = filepath.Join(out, "output")
 
+	if err := j.mountWorkDir(); err != nil {
+		if err2 := appFs.RemoveAll(jobDir); err2 != nil {
+			j.log.Warn().Err(err2).Msg("failed to undo")
+		}
+		return err
+	}
+
 	return nil
 }
 
+// seccompProfile returns the seccomp profile file, or the built-in profile name.
+func (j *Job) seccompProfile() string {
+	if j.seccompPath == "" {
+		return seccomp.DefaultProfile
+	}
+	return j.seccompPath
+}
+
 // cmdArgs creates a string slice of arguments to be passed to the shim process.
 func (j *Job) cmdArgs() []string {
 	rt := []string{"--mode=shim",
@@ -291,6 +588,38 @@ func (j *Job) cmdArgs() []string {
 		fmt.Sprintf("--gid=%d", j.ids.GID),
 	}
 
+	if len(j.rlimits) > 0 {
+		rt = append(rt, fmt.Sprintf("--rlimits=%s", FormatRlimits(j.rlimits)))
+	}
+
+	if j.rootFS != "" {
+		rt = append(rt, fmt.Sprintf("--rootfs=%s", j.rootFS))
+	}
+
+	if len(j.volumes) > 0 {
+		rt = append(rt, fmt.Sprintf("--volumes=%s", FormatMounts(j.volumes)))
+	}
+
+	if j.netMode != NetNone {
+		rt = append(rt, fmt.Sprintf("--net=%s", j.netMode))
+	}
+
+	if j.userNS != nil {
+		rt = append(rt, "--userns")
+	}
+
+	if j.hostname != "" {
+		rt = append(rt, fmt.Sprintf("--hostname=%s", j.hostname))
+	}
+
+	if len(j.caps) > 0 {
+		rt = append(rt, fmt.Sprintf("--caps=%s", FormatCaps(j.caps)))
+	}
+
+	if j.seccomp != "" {
+		rt = append(rt, fmt.Sprintf("--seccomp=%s", j.seccompProfile()))
+	}
+
 	if len(j.Args) > 0 {
 		rt = append(rt, "--")
 		rt = append(rt, j.Args...)
@@ -299,6 +628,20 @@ func (j *Job) cmdArgs() []string {
 	return rt
 }
 
+// allNamespaces returns all the namespaces of the job.
+func (j *Job) allNamespaces() []Namespace {
+	rt := []Namespace{NsMount}
+	for _, ns := range []Namespace{NsPID, NsNet, NsUTS, NsIPC, NsUser} {
+		switch {
+		case ns == NsNet && j.netMode != NetHost,
+			ns == NsUser && j.userNS != nil,
+			hasNamespace(j.namespaces, ns):
+			rt = append(rt, ns)
+		}
+	}
+	return rt
+}
+
 // Status returns the job current status, and exit code, if it's ended or stopped. If not, exit code is 0.
 func (j *Job) Status() (Status, int) {
 	j.stateLock.Lock()
@@ -310,6 +653,70 @@ func (j *Job) Status() (Status, int) {
 	return st, j.cmd.ProcessState.ExitCode()
 }
 
+// Details returns the job state snapshot.
+func (j *Job) Details() Details {
+	d := j.stateDetails()
+
+	// the working directory walk may take a while, so it's done without the state lock
+	if d.Status != StatusRemoved {
+		d.DiskLimitBytes = j.limits.MaxDiskBytes
+		usage, err := j.cachedDiskUsage()
+		if err != nil {
+			j.log.Debug().Err(err).Msg("failed to get disk usage")
+		}
+		d.DiskUsageBytes = usage
+	}
+
+	return d
+}
+
+// stateDetails returns the job state snapshot, without the disk usage.
+func (j *Job) stateDetails() Details {
+	j.stateLock.Lock()
+	defer j.stateLock.Unlock()
+
+	d := Details{
+		Status:         j.handler.status(),
+		Command:        append([]string{j.Command}, j.Args...),
+		Pressure:       j.pressure(),
+		PressureEvents: append([]PressureEvent(nil), j.pressureEvents...),
+		Network:        j.netMode,
+		IDs:            j.ids,
+		Seccomp:        j.seccomp,
+		Caps:           append([]Capability(nil), j.caps...),
+		Namespaces:     j.allNamespaces(),
+		Hostname:       j.hostname,
+		Restart:        j.restart,
+		Attempts:       j.attemptsInfo(),
+		NextRestart:    j.nextRestart,
+	}
+
+	if j.netMode == NetBridge {
+		d.Egress = j.network.Egress()
+		if d.Status == StatusActive || d.Status == StatusStopping {
+			d.Address = j.network.Address()
+		}
+	}
+
+	if d.Status != StatusActive && d.Status != StatusStopping {
+		d.ExitCode = j.cmd.ProcessState.ExitCode()
+	}
+
+	return d
+}
+
+// LogSize returns the size of the job output, of all the attempts ended so far.
+func (j *Job) LogSize() int64 {
+	j.stateLock.Lock()
+	defer j.stateLock.Unlock()
+
+	if len(j.attempts) == 0 {
+		return 0
+	}
+	a := j.attempts[len(j.attempts)-1]
+	return a.LogOffset + a.LogSize
+}
+
 // Completed returns if the job process is still running and additional output can be produced
 func (j *Job) Completed() bool {
 	j.stateLock.Lock()
@@ -330,6 +737,12 @@ func (j *Job) InitStop(to time.Duration) error {
 	j.stateLock.Lock()
 	defer j.stateLock.Unlock()
 
+	// nothing to stop gracefully while waiting for a restart
+	if j.handler.status() == StatusActive && j.cancelRestart() {
+		j.setHandler(stoppedHandler{})
+		return nil
+	}
+
 	err := j.handler.gracefulStop(j, to)
 	if err != nil {
 		return err
@@ -345,6 +758,11 @@ func (j *Job) Stop() error {
 	j.stateLock.Lock()
 	defer j.stateLock.Unlock()
 
+	if j.handler.status() == StatusActive && j.cancelRestart() {
+		j.setHandler(stoppedHandler{})
+		return nil
+	}
+
 	err := j.handler.forceStop(j)
 	if err == nil {
 		j.setHandler(stoppedHandler{})
@@ -375,7 +793,25 @@ func (j *Job) Logs() (io.ReadCloser, error) {
 	j.stateLock.Lock()
 	defer j.stateLock.Unlock()
 
-	r, err := j.handler.logs(j)
+	r, err := j.handler.logs(j, nil)
+	if err == nil {
+		n := atomic.AddInt32(&j.logReaders, 1)
+		j.log.Info().Int32("total", n).Msg("log reader added")
+	}
+
+	return r, err
+}
+
+// AttemptLogs creates a new Reader object to provide the output of attempt n, starting with 1.
+func (j *Job) AttemptLogs(n int) (io.ReadCloser, error) {
+	j.stateLock.Lock()
+	defer j.stateLock.Unlock()
+
+	if n < 1 || n > len(j.attempts) {
+		return nil, ErrNoAttempt
+	}
+
+	r, err := j.handler.logs(j, j.attempts[n-1])
 	if err == nil {
 		n := atomic.AddInt32(&j.logReaders, 1)
 		j.log.Info().Int32("total", n).Msg("log reader added")
@@ -389,20 +825,33 @@ func (j *Job) exited() {
 	j.stateLock.Lock()
 	defer j.stateLock.Unlock()
 
+	exitCode := 0
 	ps := j.cmd.ProcessState
 	if ps != nil {
-		j.exitCode = ps.ExitCode()
+		exitCode = ps.ExitCode()
 	}
 
+	// the network namespace is gone with the process, the next attempt gets a new one
+	j.detachNetwork()
+
+	j.attemptEnded(exitCode)
+}
+
+// finish releases the job resources once the last attempt has ended, and updates the job state.
+func (j *Job) finish() {
+	// supposed to be called under j.stateLock
 	if err := j.removeCgroup(); err != nil {
 		j.log.Warn().Err(err).Msg("failed to delete cgroup")
 	}
 
+	_ = j.out.Close()
+
 	j.setHandler(j.handler.exited(j))
 }
 
-// logsReader is an internal method that does all the Logs() actual work.
-func (j *Job) logsReader() (io.ReadCloser, error) {
+// logsReader is an internal method that does all the Logs() actual work. Reads the output
+// of attempt a only, if it's not nil.
+func (j *Job) logsReader(a *attempt) (io.ReadCloser, error) {
 	f, err := appFs.OpenFile(j.outFilePath, os.O_RDONLY, 0200)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get output: %w", err)
@@ -415,6 +864,16 @@ func (j *Job) logsReader() (io.ReadCloser, error) {
 		done:    j.done,
 	}
 
+	if a != nil {
+		if _, err := f.Seek(a.LogOffset, io.SeekStart); err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("failed to get output: %w", err)
+		}
+		r.pos = a.LogOffset
+		r.done = a.done
+		r.end = &a.logEnd
+	}
+
 	j.outLock.Add(1)
 
 	return &r, nil
@@ -428,6 +887,10 @@ func (j *Job) doCleanup() error {
 	j.outLock.Wait()
 	j.log.Debug().Msg("cleanup: all log readers closed.")
 
+	if err := j.unmountWorkDir(); err != nil {
+		return err
+	}
+
 	return appFs.RemoveAll(j.jobDir)
 }
 
@@ -463,16 +926,20 @@ func signalCommand(c *exec.Cmd, s os.Signal) error {
 
 // sysFun is  a small syscalls table to be able to mock syscalls in job tests
 type sysFun struct {
-	signal func(c *exec.Cmd, s os.Signal) error
-	start  func(c *exec.Cmd) error
-	wait   func(c *exec.Cmd) error
+	signal  func(c *exec.Cmd, s os.Signal) error
+	start   func(c *exec.Cmd) error
+	wait    func(c *exec.Cmd) error
+	mount   func(source, target, fstype string, flags uintptr, data string) error
+	unmount func(target string, flags int) error
 }
 
 // defSysFun is the default value for jobs sysFun table
 var defSysFun = sysFun{
-	signal: signalCommand,
-	wait:   waitCommand,
-	start:  startCommand,
+	signal:  signalCommand,
+	wait:    waitCommand,
+	start:   startCommand,
+	mount:   mountFs,
+	unmount: unmountFs,
 }
 
 // appFs is a wrapper around FS operations. for mocks.
@@ -3,7 +3,9 @@ package job
 import (
 	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -15,6 +17,7 @@ import (
 
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
 )
 
 var lg = zerolog.New(os.Stdout).With().Logger()
@@ -33,7 +36,7 @@ func TestHappyPathShimExec(t *testing.T) {
 	var cmdJDir string
 
 	j, err := New("ls", []string{"/tmp", "/var"}, Shim("/bin/shim"),
-		dir(jDir), cgroup(cgOutDir),
+		BaseDir(jDir), cgroup(cgOutDir),
 		cmdStart(func(c *exec.Cmd) error {
 			cmd = c.Path
 			args = c.Args
@@ -52,6 +55,7 @@ func TestHappyPathShimExec(t *testing.T) {
 		"--cgroup=" + cgDir,
 		fmt.Sprintf("--uid=%d", uid),
 		fmt.Sprintf("--gid=%d", gid),
+		fmt.Sprintf("--hostname=%s", j.ID),
 		"--", "/tmp", "/var"}, args)
 
 }
@@ -71,7 +75,7 @@ func TestHappyPathStatus(t *testing.T) {
 			waitWG.Wait()
 			return nil
 		}),
-		dir(jDir), cgroup(cgDir))
+		BaseDir(jDir), cgroup(cgDir))
 
 	assert.NoError(t, err)
 	assert.NotNil(t, j)
@@ -103,7 +107,7 @@ func TestHappyPathNoUidGid(t *testing.T) {
 			cmdJDir = c.Dir
 			return nil
 		}),
-		dir(jDir), cgroup(cgOutDir))
+		BaseDir(jDir), cgroup(cgOutDir))
 
 	assert.NoError(t, err)
 	assert.NotNil(t, j)
@@ -115,6 +119,7 @@ func TestHappyPathNoUidGid(t *testing.T) {
 		"--cgroup=" + cgDir,
 		fmt.Sprintf("--uid=%d", uid),
 		fmt.Sprintf("--gid=%d", gid),
+		fmt.Sprintf("--hostname=%s", j.ID),
 		"--", "/tmp", "/var"}, args)
 
 }
@@ -127,13 +132,44 @@ func defWait(c *exec.Cmd) error {
 	return nil
 }
 
+// waitTestEnd is a cmdWait mock option, keeping the job active until the test ends.
+// Once the job ends, its cgroup directory is removed.
+func waitTestEnd(t *testing.T) Option {
+	end := make(chan struct{})
+	t.Cleanup(func() { close(end) })
+
+	return cmdWait(func(c *exec.Cmd) error {
+		<-end
+		return nil
+	})
+}
+
+// fakeBlockDevs creates a fake /sys/block directory with a virtual device, and the given disks.
+func fakeBlockDevs(t *testing.T, disks map[string]string) {
+	sysDir := t.TempDir()
+
+	assert.NoError(t, os.MkdirAll(filepath.Join(sysDir, "loop0"), 0700))
+	assert.NoError(t, os.WriteFile(filepath.Join(sysDir, "loop0", "dev"), []byte("7:0\n"), 0600))
+
+	for name, dev := range disks {
+		assert.NoError(t, os.MkdirAll(filepath.Join(sysDir, name, "device"), 0700))
+		assert.NoError(t, os.WriteFile(filepath.Join(sysDir, name, "dev"), []byte(dev+"\n"), 0600))
+	}
+
+	old := sysBlockPath
+	sysBlockPath = sysDir
+	t.Cleanup(func() { sysBlockPath = old })
+}
+
 func TestCgroupConfig(t *testing.T) {
 	cgDir := t.TempDir()
 	jDir := t.TempDir()
 
+	fakeBlockDevs(t, map[string]string{"sda": "8:0", "vda": "252:0"})
+
 	j, err := New("ls", []string{"/tmp", "/var"}, Shim("/bin/true"),
-		dir(jDir), cgroup(cgDir),
-		cmdStart(defStart), cmdWait(defWait),
+		BaseDir(jDir), cgroup(cgDir),
+		cmdStart(defStart), waitTestEnd(t),
 		Log(lg), CPU(3.14), Mem(27), IO(34))
 
 	assert.NoError(t, err)
@@ -153,10 +189,74 @@ func TestCgroupConfig(t *testing.T) {
 	ioCg, err := os.ReadFile(filepath.Join(cgDir, "inner", "io.max"))
 	assert.NoError(t, err)
 
+	lines := 0
 	s := bufio.NewScanner(bytes.NewReader(ioCg))
 	for s.Scan() {
 		ss := strings.SplitN(s.Text(), " ", 2)
 		assert.Equal(t, "rbps=34 wbps=34", ss[1])
+		lines++
+	}
+	assert.Equal(t, 2, lines)
+}
+
+func TestControllers(t *testing.T) {
+	cgDir := t.TempDir()
+
+	_, err := New("ls", nil, Shim("/bin/true"),
+		BaseDir(t.TempDir()), cgroup(cgDir),
+		cmdStart(defStart), waitTestEnd(t),
+		Controllers("cpu", "pids"), CPU(1))
+	assert.NoError(t, err)
+
+	data, err := os.ReadFile(filepath.Join(cgDir, "cgroup.subtree_control"))
+	assert.NoError(t, err)
+	assert.Equal(t, "+cpu +pids\n", string(data))
+
+	for _, opts := range [][]Option{
+		{Controllers("cpu"), Mem(1 << 20)},
+		{Controllers("memory"), IOWeight(100)},
+		{Controllers("cpu", "blkio")},
+	} {
+		_, err = New("ls", nil, append(opts, Shim("/bin/true"), BaseDir(t.TempDir()), cgroup(t.TempDir()))...)
+		assert.ErrorIs(t, err, ErrInvalidLimits)
+	}
+}
+
+func TestDeviceIOConfig(t *testing.T) {
+	cgDir := t.TempDir()
+	jDir := t.TempDir()
+
+	fakeBlockDevs(t, map[string]string{"sda": "8:0", "sdb": "8:16"})
+
+	j, err := New("ls", nil, Shim("/bin/true"),
+		BaseDir(jDir), cgroup(cgDir),
+		cmdStart(defStart), waitTestEnd(t),
+		Log(lg), IO(100), IOWeight(50),
+		DeviceIO(DeviceIOLimit{Device: "8:16", WriteBPS: 10, ReadIOPS: 5}),
+		DeviceIO(DeviceIOLimit{Device: "9:1", WriteIOPS: 7}),
+		DeviceIO(DeviceIOLimit{Device: AllDevices, ReadBPS: 200}))
+
+	assert.NoError(t, err)
+	assert.NotNil(t, j)
+
+	ioCg, err := os.ReadFile(filepath.Join(cgDir, "inner", "io.max"))
+	assert.NoError(t, err)
+	assert.Equal(t, "8:0 rbps=200 wbps=100\n"+
+		"8:16 rbps=200 wbps=10 riops=5\n"+
+		"9:1 rbps=200 wiops=7\n", string(ioCg))
+
+	weight, err := os.ReadFile(filepath.Join(cgDir, "inner", "io.weight"))
+	assert.NoError(t, err)
+	assert.Equal(t, "default 50\n", string(weight))
+
+	// paths outside /dev are not looked up, and the errors don't tell what exists
+	for _, dev := range []string{"/dev/no-such-device", "/dev/null", "/etc/passwd", "/dev/../etc/passwd", "sda"} {
+		_, err = New("ls", nil, Shim("/bin/true"),
+			BaseDir(jDir), cgroup(t.TempDir()),
+			cmdStart(defStart), cmdWait(defWait),
+			DeviceIO(DeviceIOLimit{Device: dev, ReadBPS: 1}))
+		assert.ErrorIs(t, err, ErrInvalidLimits, dev)
+		assert.EqualError(t, err, fmt.Sprintf("failed to configure IO limits: invalid limits: invalid block device %q", dev), dev)
 	}
 }
 
@@ -169,7 +269,7 @@ func TestStop(t *testing.T) {
 
 	var s os.Signal
 	j, err := New("ls", []string{"/tmp", "/var"}, Shim("/bin/shim"),
-		dir(jDir), cgroup(cgDir),
+		BaseDir(jDir), cgroup(cgDir),
 		cmdStart(defStart),
 		cmdWait(func(c *exec.Cmd) error {
 			jend.Wait()
@@ -216,7 +316,7 @@ func TestGracefulStop(t *testing.T) {
 			s = ts
 			return nil
 		}),
-		dir(jDir), cgroup(cgDir), Log(lg))
+		BaseDir(jDir), cgroup(cgDir), Log(lg))
 	assert.NoError(t, err)
 	assert.NotNil(t, j)
 
@@ -250,7 +350,7 @@ func TestLogs(t *testing.T) {
 		cmdSignal(func(c *exec.Cmd, ts os.Signal) error {
 			return nil
 		}),
-		Log(lg), dir(jDir), cgroup(cgDir))
+		Log(lg), BaseDir(jDir), cgroup(cgDir))
 	assert.NoError(t, err)
 	assert.NotNil(t, j)
 
@@ -279,3 +379,665 @@ func TestLogs(t *testing.T) {
 	err = j.Cleanup()
 	assert.NoError(t, err)
 }
+
+func TestMemoryConfig(t *testing.T) {
+	cgDir := t.TempDir()
+	jDir := t.TempDir()
+
+	j, err := New("ls", nil, Shim("/bin/true"),
+		BaseDir(jDir), cgroup(cgDir),
+		cmdStart(defStart), waitTestEnd(t),
+		Log(lg), MemMin(1), MemLow(2), MemHigh(3), Mem(4), Swap(5))
+
+	assert.NoError(t, err)
+	assert.NotNil(t, j)
+
+	for file, value := range map[string]string{
+		"memory.min":      "1\n",
+		"memory.low":      "2\n",
+		"memory.high":     "3\n",
+		"memory.max":      "4\n",
+		"memory.swap.max": "5\n",
+	} {
+		data, err := os.ReadFile(filepath.Join(cgDir, "inner", file))
+		assert.NoError(t, err)
+		assert.Equal(t, value, string(data), file)
+	}
+
+	// swap may be disabled
+	cgDir = t.TempDir()
+	_, err = New("ls", nil, Shim("/bin/true"),
+		BaseDir(jDir), cgroup(cgDir),
+		cmdStart(defStart), waitTestEnd(t),
+		Log(lg), Swap(0))
+	assert.NoError(t, err)
+
+	data, err := os.ReadFile(filepath.Join(cgDir, "inner", "memory.swap.max"))
+	assert.NoError(t, err)
+	assert.Equal(t, "0\n", string(data))
+}
+
+func TestInvalidMemoryLimits(t *testing.T) {
+	for _, opts := range [][]Option{
+		{MemHigh(10), Mem(5)},
+		{MemLow(10), MemHigh(5)},
+		{MemMin(10), Mem(5)},
+		{MemMin(10), MemLow(5)},
+		{Swap(-1)},
+	} {
+		opts = append(opts, Shim("/bin/true"), BaseDir(t.TempDir()), cgroup(t.TempDir()),
+			cmdStart(defStart), cmdWait(defWait))
+
+		j, err := New("ls", nil, opts...)
+		assert.ErrorIs(t, err, ErrInvalidLimits)
+		assert.Nil(t, j)
+	}
+}
+
+func TestPressure(t *testing.T) {
+	cgDir := t.TempDir()
+	jDir := t.TempDir()
+
+	psi := "some avg10=1.50 avg60=0.25 avg300=0.00 total=1200\n" +
+		"full avg10=0.50 avg60=0.00 avg300=0.00 total=300\n"
+
+	assert.NoError(t, os.MkdirAll(filepath.Join(cgDir, "inner"), 0700))
+	for _, r := range PressureResources {
+		assert.NoError(t, os.WriteFile(filepath.Join(cgDir, "inner", r+".pressure"), []byte(psi), 0600))
+	}
+
+	var jend sync.WaitGroup
+	jend.Add(1)
+
+	j, err := New("ls", nil, Shim("/bin/true"),
+		BaseDir(jDir), cgroup(cgDir),
+		cmdStart(defStart),
+		cmdWait(func(c *exec.Cmd) error {
+			jend.Wait()
+			return nil
+		}),
+		Log(lg), Trigger(PressureTrigger{Resource: "memory", Stall: 150 * time.Millisecond, Window: time.Second}))
+	assert.NoError(t, err)
+	assert.NotNil(t, j)
+
+	trigger, err := os.ReadFile(filepath.Join(cgDir, "inner", "memory.pressure"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(trigger), "some 150000 1000000\x00")
+
+	d := j.Details()
+	assert.Equal(t, StatusActive, d.Status)
+	assert.Len(t, d.Pressure, len(PressureResources))
+	assert.Equal(t, PressureAvg{Avg10: 1.5, Avg60: 0.25, Total: 1200 * time.Microsecond}, d.Pressure[0].Some)
+	assert.Equal(t, PressureAvg{Avg10: 0.5, Total: 300 * time.Microsecond}, d.Pressure[0].Full)
+
+	// only the last events are kept
+	for i := 0; i < maxPressureEvents+10; i++ {
+		j.pressureEvent(PressureTrigger{Resource: "memory", Stall: time.Duration(i)})
+	}
+	d = j.Details()
+	assert.Len(t, d.PressureEvents, maxPressureEvents)
+	assert.Equal(t, time.Duration(10), d.PressureEvents[0].Trigger.Stall)
+
+	jend.Done()
+	j.Wait()
+
+	assert.Empty(t, j.Details().Pressure)
+
+	_, err = New("ls", nil, Shim("/bin/true"),
+		BaseDir(jDir), cgroup(t.TempDir()),
+		cmdStart(defStart), cmdWait(defWait),
+		Trigger(PressureTrigger{Resource: "memory", Stall: 2 * time.Second, Window: time.Second}))
+	assert.ErrorIs(t, err, ErrInvalidTrigger)
+}
+
+func TestRlimits(t *testing.T) {
+	var args []string
+
+	limits, err := ParseRlimits("nofile=1024:4096,core=0,stack=unlimited")
+	assert.NoError(t, err)
+	assert.Equal(t, []Rlimit{
+		{Resource: "nofile", Soft: 1024, Hard: 4096},
+		{Resource: "core", Soft: 0, Hard: 0},
+		{Resource: "stack", Soft: RlimInfinity, Hard: RlimInfinity},
+	}, limits)
+
+	j, err := New("ls", nil, Shim("/bin/shim"),
+		BaseDir(t.TempDir()), cgroup(t.TempDir()),
+		cmdStart(func(c *exec.Cmd) error {
+			args = c.Args
+			return nil
+		}),
+		Rlimits(limits...))
+	assert.NoError(t, err)
+	assert.NotNil(t, j)
+
+	assert.Contains(t, args, "--rlimits=nofile=1024:4096,core=0:0,stack=unlimited:unlimited")
+
+	for _, s := range []string{"nofile=10:5", "nosuch=1", "nofile", "nofile=x"} {
+		_, err := ParseRlimits(s)
+		assert.ErrorIs(t, err, ErrInvalidRlimit, s)
+	}
+}
+
+func TestVolumes(t *testing.T) {
+	var args []string
+
+	mounts, err := ParseMounts("/srv/data:/data:ro,/srv/cache:/var/cache:rw")
+	assert.NoError(t, err)
+	assert.Equal(t, []Mount{
+		{Source: "/srv/data", Target: "/data", ReadOnly: true},
+		{Source: "/srv/cache", Target: "/var/cache"},
+	}, mounts)
+
+	opts := []Option{Shim("/bin/shim"),
+		BaseDir(t.TempDir()), cgroup(t.TempDir()),
+		cmdStart(func(c *exec.Cmd) error {
+			args = c.Args
+			return nil
+		})}
+	for _, m := range mounts {
+		opts = append(opts, Volume(m))
+	}
+
+	j, err := New("ls", nil, opts...)
+	assert.NoError(t, err)
+	assert.NotNil(t, j)
+
+	assert.Contains(t, args, "--volumes=/srv/data:/data:ro,/srv/cache:/var/cache:rw")
+
+	for _, s := range []string{"/srv:data:ro", "/srv:/data", "/srv:/data:rx", "/srv:/:ro",
+		"/srv:/proc/1:ro", "/srv:/work:rw", "/srv/../etc:/data:ro", "/srv:/etc:rw", "/srv:/usr/bin:ro",
+		"/srv:/lib:rw"} {
+		_, err := ParseMounts(s)
+		assert.ErrorIs(t, err, ErrInvalidMount, s)
+	}
+
+	_, err = New("ls", nil, Shim("/bin/shim"), BaseDir(t.TempDir()), cgroup(t.TempDir()),
+		Volume(Mount{Source: "/srv", Target: "/dev/sda"}))
+	assert.ErrorIs(t, err, ErrInvalidMount)
+}
+
+func TestDiskLimit(t *testing.T) {
+	var mounted, unmounted []string
+	var data string
+	mounts := mountFun(
+		func(source, target, fstype string, flags uintptr, d string) error {
+			mounted = append(mounted, target)
+			data = d
+			return nil
+		},
+		func(target string, flags int) error {
+			unmounted = append(unmounted, target)
+			return nil
+		})
+
+	j, err := New("ls", nil, Shim("/bin/true"),
+		BaseDir(t.TempDir()), cgroup(t.TempDir()),
+		cmdStart(defStart), waitTestEnd(t),
+		Log(lg), UID(1000), GID(1000), Disk(1<<20), mounts)
+	assert.NoError(t, err)
+	assert.NotNil(t, j)
+
+	assert.Equal(t, []string{j.workDir}, mounted)
+	assert.Equal(t, "size=1048576,mode=0700,uid=1000,gid=1000", data)
+	assert.Empty(t, unmounted)
+	assert.Equal(t, int64(1<<20), j.Details().DiskLimitBytes)
+
+	// the working dir is unmounted, if the job fails to start
+	mounted = nil
+	_, err = New("ls", nil, Shim("/bin/true"),
+		BaseDir(t.TempDir()), cgroup(t.TempDir()),
+		cmdStart(func(c *exec.Cmd) error { return errors.New("failed") }),
+		Log(lg), Disk(1<<20), mounts)
+	assert.Error(t, err)
+	assert.Len(t, mounted, 1)
+	assert.Equal(t, mounted, unmounted)
+
+	_, err = New("ls", nil, Shim("/bin/true"), BaseDir(t.TempDir()), cgroup(t.TempDir()), Disk(-1))
+	assert.ErrorIs(t, err, ErrInvalidLimits)
+}
+
+func TestDiskUsage(t *testing.T) {
+	j, err := New("ls", nil, Shim("/bin/true"),
+		BaseDir(t.TempDir()), cgroup(t.TempDir()),
+		cmdStart(defStart), waitTestEnd(t), Log(lg))
+	assert.NoError(t, err)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(j.workDir, "a"), make([]byte, 100), 0600))
+	assert.NoError(t, os.MkdirAll(filepath.Join(j.workDir, "b"), 0700))
+	assert.NoError(t, os.WriteFile(filepath.Join(j.workDir, "b", "c"), make([]byte, 20), 0600))
+
+	d := j.Details()
+	assert.Equal(t, int64(120), d.DiskUsageBytes)
+	assert.Equal(t, int64(0), d.DiskLimitBytes)
+
+	// the size is cached for a while
+	assert.NoError(t, os.WriteFile(filepath.Join(j.workDir, "d"), make([]byte, 10), 0600))
+	assert.Equal(t, int64(120), j.Details().DiskUsageBytes)
+}
+
+// fakeNetwork records Network calls
+type fakeNetwork struct {
+	lock      sync.Mutex
+	pid       int
+	detached  bool
+	attachErr error
+}
+
+func (n *fakeNetwork) Attach(pid int) error {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.pid = pid
+	return n.attachErr
+}
+
+func (n *fakeNetwork) Detach() error {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.detached = true
+	return nil
+}
+
+func (n *fakeNetwork) Address() string {
+	return "10.88.0.2"
+}
+
+func (n *fakeNetwork) Egress() []string {
+	return []string{"allow 10.0.0.0/8"}
+}
+
+func TestNetwork(t *testing.T) {
+	var args []string
+	var attr *syscall.SysProcAttr
+	start := cmdStart(func(c *exec.Cmd) error {
+		args = c.Args
+		attr = c.SysProcAttr
+		c.Process = &os.Process{Pid: 1234}
+		return nil
+	})
+
+	end := make(chan struct{})
+	n := &fakeNetwork{}
+	j, err := New("ls", nil, Shim("/bin/shim"),
+		BaseDir(t.TempDir()), cgroup(t.TempDir()), start,
+		cmdWait(func(c *exec.Cmd) error {
+			<-end
+			return nil
+		}),
+		Net(NetBridge, n))
+	assert.NoError(t, err)
+
+	assert.Contains(t, args, "--net=bridge")
+	assert.NotZero(t, attr.Unshareflags&syscall.CLONE_NEWNET)
+	assert.Equal(t, 1234, n.pid)
+
+	d := j.Details()
+	assert.Equal(t, NetBridge, d.Network)
+	assert.Equal(t, "10.88.0.2", d.Address)
+	assert.Equal(t, []string{"allow 10.0.0.0/8"}, d.Egress)
+
+	close(end)
+	j.Wait()
+	n.lock.Lock()
+	assert.True(t, n.detached)
+	n.lock.Unlock()
+
+	// host network
+	_, err = New("ls", nil, Shim("/bin/shim"),
+		BaseDir(t.TempDir()), cgroup(t.TempDir()), start, waitTestEnd(t),
+		Net(NetHost, nil))
+	assert.NoError(t, err)
+	assert.Contains(t, args, "--net=host")
+	assert.Zero(t, attr.Unshareflags&syscall.CLONE_NEWNET)
+
+	// failed to attach
+	n = &fakeNetwork{attachErr: errors.New("no bridge")}
+	_, err = New("ls", nil, Shim("/bin/shim"),
+		BaseDir(t.TempDir()), cgroup(t.TempDir()), start, cmdWait(defWait),
+		Net(NetBridge, n))
+	assert.Error(t, err)
+	assert.True(t, n.detached)
+
+	for _, opt := range []Option{Net(NetBridge, nil), Net("nosuch", nil)} {
+		_, err = New("ls", nil, Shim("/bin/shim"), BaseDir(t.TempDir()), cgroup(t.TempDir()), opt)
+		assert.ErrorIs(t, err, ErrInvalidNetwork)
+	}
+}
+
+func TestUserNS(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("requires root to chown the working dir")
+	}
+
+	var args []string
+	var attr *syscall.SysProcAttr
+	cgDir := t.TempDir()
+
+	j, err := New("ls", nil, Shim("/bin/shim"),
+		BaseDir(t.TempDir()), cgroup(cgDir),
+		cmdStart(func(c *exec.Cmd) error {
+			args = c.Args
+			attr = c.SysProcAttr
+			c.Process = &os.Process{Pid: 1234}
+			return nil
+		}), waitTestEnd(t),
+		UID(1000), GID(1000), UserNS(IDRange{HostID: 100000, Size: 65536}))
+	assert.NoError(t, err)
+
+	assert.Contains(t, args, "--userns")
+	assert.Contains(t, args, "--uid=0")
+	assert.Contains(t, args, "--gid=0")
+
+	assert.NotZero(t, attr.Cloneflags&syscall.CLONE_NEWUSER)
+	assert.Equal(t, []syscall.SysProcIDMap{{ContainerID: 0, HostID: 100000, Size: 65536}}, attr.UidMappings)
+	assert.Equal(t, []syscall.SysProcIDMap{{ContainerID: 0, HostID: 100000, Size: 65536}}, attr.GidMappings)
+
+	// the server adds the shim to the cgroup
+	data, err := os.ReadFile(filepath.Join(cgDir, "inner", "cgroup.procs"))
+	assert.NoError(t, err)
+	assert.Equal(t, "1234", strings.TrimSpace(string(data)))
+
+	fi, err := os.Stat(j.workDir)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(100000), fi.Sys().(*syscall.Stat_t).Uid)
+
+	for _, r := range []IDRange{{HostID: 0, Size: 65536}, {HostID: 100000}, {HostID: 1<<32 - 65536, Size: 65536}} {
+		_, err = New("ls", nil, Shim("/bin/shim"), BaseDir(t.TempDir()), cgroup(t.TempDir()), UserNS(r))
+		assert.ErrorIs(t, err, ErrInvalidIDRange, r)
+	}
+}
+
+func TestNamespaces(t *testing.T) {
+	var args []string
+	var attr *syscall.SysProcAttr
+	start := cmdStart(func(c *exec.Cmd) error {
+		args = c.Args
+		attr = c.SysProcAttr
+		return nil
+	})
+
+	j, err := New("ls", nil, Shim("/bin/shim"),
+		BaseDir(t.TempDir()), cgroup(t.TempDir()), start, waitTestEnd(t))
+	assert.NoError(t, err)
+
+	assert.Contains(t, args, fmt.Sprintf("--hostname=%s", j.ID))
+	assert.Equal(t, uintptr(syscall.CLONE_NEWPID|syscall.CLONE_NEWUTS|syscall.CLONE_NEWIPC), attr.Cloneflags)
+	d := j.Details()
+	assert.Equal(t, []Namespace{NsMount, NsPID, NsNet, NsUTS, NsIPC}, d.Namespaces)
+	assert.Equal(t, string(j.ID), d.Hostname)
+
+	j, err = New("ls", nil, Shim("/bin/shim"),
+		BaseDir(t.TempDir()), cgroup(t.TempDir()), start, waitTestEnd(t),
+		Namespaces(NsUTS), Hostname("worker-1.local"), Net(NetHost, nil))
+	assert.NoError(t, err)
+
+	assert.Contains(t, args, "--hostname=worker-1.local")
+	assert.Equal(t, uintptr(syscall.CLONE_NEWUTS), attr.Cloneflags)
+	assert.Equal(t, []Namespace{NsMount, NsUTS}, j.Details().Namespaces)
+
+	// shares the host UTS namespace
+	_, err = New("ls", nil, Shim("/bin/shim"),
+		BaseDir(t.TempDir()), cgroup(t.TempDir()), start, waitTestEnd(t),
+		Namespaces())
+	assert.NoError(t, err)
+	assert.NotContains(t, strings.Join(args, " "), "--hostname")
+	assert.Zero(t, attr.Cloneflags)
+
+	for _, opts := range [][]Option{
+		{Namespaces(NsPID), Hostname("worker")},
+		{Hostname("-worker")},
+		{Namespaces(NsNet)},
+	} {
+		_, err = New("ls", nil, append(opts, Shim("/bin/shim"), BaseDir(t.TempDir()), cgroup(t.TempDir()))...)
+		assert.ErrorIs(t, err, ErrInvalidNamespace)
+	}
+
+	ns, err := ParseNamespaces("pid,ipc")
+	assert.NoError(t, err)
+	assert.Equal(t, []Namespace{NsPID, NsIPC}, ns)
+
+	_, err = ParseNamespaces("pid,mnt")
+	assert.ErrorIs(t, err, ErrInvalidNamespace)
+}
+
+func TestExec(t *testing.T) {
+	var args []string
+
+	j, err := New("sleep", []string{"100"}, Shim("/bin/shim"),
+		BaseDir(t.TempDir()), cgroup(t.TempDir()),
+		cmdStart(func(c *exec.Cmd) error {
+			args = c.Args
+			c.Process = &os.Process{Pid: 4242}
+			return nil
+		}), waitTestEnd(t),
+		UID(1000), GID(1000))
+	assert.NoError(t, err)
+
+	_, err = j.Exec("ps", []string{"-ef"}, nil, io.Discard, io.Discard)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"/bin/shim", "--mode=exec", "--cmd=ps",
+		"--target=4242",
+		"--cgroup=" + j.cgroupInner,
+		"--namespaces=mnt,pid,net,uts,ipc",
+		"--uid=1000",
+		"--gid=1000",
+		"--", "-ef"}, args)
+
+	// the command stays in the host user namespace, with the host IDs and no capabilities
+	j, err = New("sleep", []string{"100"}, Shim("/bin/shim"),
+		BaseDir(t.TempDir()), cgroup(t.TempDir()),
+		cmdStart(func(c *exec.Cmd) error {
+			args = c.Args
+			c.Process = &os.Process{Pid: 4243}
+			return nil
+		}), waitTestEnd(t),
+		UID(0), GID(0), UserNS(IDRange{HostID: 100000, Size: 65536}), Caps(Capability(unix.CAP_NET_BIND_SERVICE)))
+	assert.NoError(t, err)
+
+	_, err = j.Exec("ps", nil, nil, io.Discard, io.Discard)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"/bin/shim", "--mode=exec", "--cmd=ps",
+		"--target=4243",
+		"--cgroup=" + j.cgroupInner,
+		"--namespaces=mnt,pid,net,uts,ipc",
+		"--uid=100000",
+		"--gid=100000"}, args)
+}
+
+func TestCloseOnExec(t *testing.T) {
+	fd, err := syscall.Open("/proc/self/exe", syscall.O_RDONLY, 0)
+	assert.NoError(t, err)
+	defer func() { _ = syscall.Close(fd) }()
+
+	assert.NoError(t, closeOnExec())
+
+	flags, _, errno := syscall.Syscall(syscall.SYS_FCNTL, uintptr(fd), syscall.F_GETFD, 0)
+	assert.Zero(t, errno)
+	assert.Equal(t, uintptr(syscall.FD_CLOEXEC), flags&syscall.FD_CLOEXEC)
+}
+
+func TestExecNotRunning(t *testing.T) {
+	j, err := New("ls", nil, Shim("/bin/shim"),
+		BaseDir(t.TempDir()), cgroup(t.TempDir()),
+		cmdStart(defStart), cmdWait(defWait))
+	assert.NoError(t, err)
+
+	j.Wait()
+
+	_, err = j.Exec("ps", nil, nil, io.Discard, io.Discard)
+	assert.ErrorIs(t, err, ErrNotRunning)
+}
+
+// fakeProc creates a fake procfs process entry.
+func fakeProc(t *testing.T, dir string, pid int, stat, cmdline, status string) {
+	pDir := filepath.Join(dir, fmt.Sprint(pid))
+	assert.NoError(t, os.MkdirAll(pDir, 0700))
+	assert.NoError(t, os.WriteFile(filepath.Join(pDir, "stat"), []byte(stat), 0600))
+	assert.NoError(t, os.WriteFile(filepath.Join(pDir, "cmdline"), []byte(cmdline), 0600))
+	assert.NoError(t, os.WriteFile(filepath.Join(pDir, "status"), []byte(status), 0600))
+}
+
+func TestProcesses(t *testing.T) {
+	pDir := t.TempDir()
+	old := procPath
+	procPath = pDir
+	t.Cleanup(func() { procPath = old })
+
+	fakeProc(t, pDir, 100, "100 (sh) S 90 100 100 0 -1 4194560 100 0 0 0 150 50 0 0 20 0 1 0 1000 2400000 200 18446744073709551615",
+		"sh\x00-c\x00sleep 100 &\x00", "Name:\tsh\nPid:\t100\nNSpid:\t100\t1\n")
+	fakeProc(t, pDir, 102, "102 (my (odd) cmd) Z 1 100 100 0 -1 4194560 100 0 0 0 1 2 0 0 20 0 1 0 1000 0 0 18446744073709551615",
+		"", "Name:\tmy (odd) cmd\nNSpid:\t102\t3\n")
+
+	j, err := New("sh", []string{"-c", "sleep 100 &"}, Shim("/bin/shim"),
+		BaseDir(t.TempDir()), cgroup(t.TempDir()),
+		cmdStart(defStart), waitTestEnd(t))
+	assert.NoError(t, err)
+
+	// 101 has exited
+	assert.NoError(t, os.WriteFile(filepath.Join(j.cgroupInner, "cgroup.procs"), []byte("100\n101\n102\n"), 0600))
+
+	procs, err := j.Processes()
+	assert.NoError(t, err)
+
+	assert.Equal(t, []ProcessInfo{
+		{PID: 100, NsPID: 1, Cmdline: []string{"sh", "-c", "sleep 100 &"}, State: "S",
+			CPUTime: 2 * time.Second, RSS: 200 * int64(os.Getpagesize())},
+		{PID: 102, NsPID: 3, Cmdline: []string{"[my (odd) cmd]"}, State: "Z",
+			CPUTime: 30 * time.Millisecond},
+	}, procs)
+}
+
+// runShell is a cmdStart mock option, running script instead of the shim, in the host namespaces.
+func runShell(script string) Option {
+	return cmdStart(func(c *exec.Cmd) error {
+		c.Path = "/bin/sh"
+		c.Args = []string{"sh", "-c", script}
+		c.SysProcAttr = nil
+		return c.Start()
+	})
+}
+
+// readOutput reads r until the end of the job output.
+func readOutput(t *testing.T, r io.ReadCloser) string {
+	defer func() { _ = r.Close() }()
+
+	var out bytes.Buffer
+	data := make([]byte, 3)
+	for {
+		n, err := r.Read(data)
+		out.Write(data[:n])
+		if errors.Is(err, ErrEOFJobDone) {
+			return out.String()
+		}
+		if !errors.Is(err, io.EOF) {
+			assert.NoError(t, err)
+		}
+		if n == 0 {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+func TestRestartOnFailure(t *testing.T) {
+	j, err := New("sh", nil,
+		BaseDir(t.TempDir()), cgroup(t.TempDir()),
+		runShell("echo run; exit 3"),
+		Restart(RestartPolicy{Mode: RestartOnFailure, MaxRetries: 2, Backoff: MinRestartBackoff}))
+	assert.NoError(t, err)
+
+	j.Wait()
+
+	d := j.Details()
+	assert.Equal(t, StatusEnded, d.Status)
+	assert.Equal(t, 3, d.ExitCode)
+	assert.True(t, d.NextRestart.IsZero())
+	assert.Len(t, d.Attempts, 3)
+	for i, a := range d.Attempts {
+		assert.Equal(t, 3, a.ExitCode)
+		assert.Equal(t, int64(4*i), a.LogOffset)
+		assert.Equal(t, int64(4), a.LogSize)
+		assert.False(t, a.Ended.Before(a.Started))
+	}
+	// exponential backoff
+	assert.GreaterOrEqual(t, d.Attempts[2].Started.Sub(d.Attempts[1].Ended), 2*MinRestartBackoff)
+
+	r, err := j.Logs()
+	assert.NoError(t, err)
+	assert.Equal(t, "run\nrun\nrun\n", readOutput(t, r))
+
+	r, err = j.AttemptLogs(2)
+	assert.NoError(t, err)
+	assert.Equal(t, "run\n", readOutput(t, r))
+
+	_, err = j.AttemptLogs(4)
+	assert.ErrorIs(t, err, ErrNoAttempt)
+}
+
+func TestRestartOnSuccess(t *testing.T) {
+	j, err := New("sh", nil,
+		BaseDir(t.TempDir()), cgroup(t.TempDir()),
+		runShell("exit 0"),
+		Restart(RestartPolicy{Mode: RestartOnFailure}))
+	assert.NoError(t, err)
+
+	j.Wait()
+
+	d := j.Details()
+	assert.Equal(t, StatusEnded, d.Status)
+	assert.Len(t, d.Attempts, 1)
+}
+
+func TestEnv(t *testing.T) {
+	j, err := New("sh", nil,
+		BaseDir(t.TempDir()), cgroup(t.TempDir()),
+		runShell("echo $JOB_ARRAY_INDEX"),
+		Env("JOB_ARRAY_INDEX=7"))
+	assert.NoError(t, err)
+
+	j.Wait()
+
+	r, err := j.Logs()
+	assert.NoError(t, err)
+	assert.Equal(t, "7\n", readOutput(t, r))
+}
+
+func TestStopPendingRestart(t *testing.T) {
+	j, err := New("sh", nil,
+		BaseDir(t.TempDir()), cgroup(t.TempDir()),
+		runShell("exit 0"),
+		Restart(RestartPolicy{Mode: RestartAlways, Backoff: time.Hour}))
+	assert.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		return !j.Details().NextRestart.IsZero()
+	}, 5*time.Second, 10*time.Millisecond)
+
+	st, _ := j.Status()
+	assert.Equal(t, StatusActive, st)
+
+	_, err = j.Exec("ps", nil, nil, io.Discard, io.Discard)
+	assert.ErrorIs(t, err, ErrNotRunning)
+
+	assert.NoError(t, j.InitStop(time.Second))
+	j.Wait()
+
+	d := j.Details()
+	assert.Equal(t, StatusStopped, d.Status)
+	assert.True(t, d.NextRestart.IsZero())
+	assert.Len(t, d.Attempts, 1)
+}
+
+func TestRestartPolicyValidate(t *testing.T) {
+	for _, p := range []RestartPolicy{
+		{Mode: "sometimes"},
+		{Mode: RestartAlways, MaxRetries: -1},
+		{Mode: RestartAlways, Backoff: time.Millisecond},
+	} {
+		assert.ErrorIs(t, p.Validate(), ErrInvalidRestartPolicy, p)
+	}
+
+	assert.Equal(t, 4*time.Second, RestartPolicy{}.delay(3))
+	assert.Equal(t, 5*time.Second, RestartPolicy{MaxBackoff: 5 * time.Second}.delay(10))
+}
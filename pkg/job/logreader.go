@@ -18,18 +18,28 @@ type outputReader struct {
 	lock    *sync.WaitGroup
 	counter *int32
 	done    chan struct{}
+
+	// current position, and the end of the output segment. valid once done is closed. nil to read all the output
+	pos int64
+	end *int64
 }
 
 // Read reads at most len(b) bytes into b, returns the number of read bytes.
 func (r *outputReader) Read(b []byte) (int, error) {
 	n, err := r.f.Read(b)
-	if err != io.EOF {
-		return n, err
-	}
+	r.pos += int64(n)
 
 	select {
 	case <-r.done:
-		return n, ErrEOFJobDone
+		// the output after the segment end belongs to the next attempts
+		if r.end != nil && r.pos >= *r.end {
+			n -= int(r.pos - *r.end)
+			r.pos = *r.end
+			return n, ErrEOFJobDone
+		}
+		if err == io.EOF {
+			return n, ErrEOFJobDone
+		}
 	default:
 	}
 
@@ -0,0 +1,123 @@
+//go:build linux
+
+package job
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// ErrInvalidMount means the volume mount is malformed.
+var ErrInvalidMount = errors.New("invalid mount")
+
+// Mount is a host path bind-mounted into the job mount namespace.
+type Mount struct {
+	// Source is the host path
+	Source string
+	// Target is the absolute path inside the job
+	Target string
+	// ReadOnly makes the mount read-only
+	ReadOnly bool
+}
+
+// reservedTargets are the job paths volumes cannot be mounted to: the job own mounts, and the system
+// binaries, libraries and configuration.
+var reservedTargets = []string{"/", "/proc", "/dev", "/sys", JobWorkDir,
+	"/etc", "/usr", "/bin", "/sbin", "/lib", "/lib32", "/lib64", "/libx32", "/boot"}
+
+// String formats the mount as SOURCE:TARGET:ro|rw.
+func (m Mount) String() string {
+	mode := "rw"
+	if m.ReadOnly {
+		mode = "ro"
+	}
+	return m.Source + ":" + m.Target + ":" + mode
+}
+
+// Validate checks both paths are absolute and clean, and target is not a reserved path.
+func (m Mount) Validate() error {
+	for _, p := range []string{m.Source, m.Target} {
+		if !filepath.IsAbs(p) || filepath.Clean(p) != p {
+			return fmt.Errorf("%w: path must be absolute and clean: %q", ErrInvalidMount, p)
+		}
+		if strings.ContainsAny(p, ":,") {
+			return fmt.Errorf("%w: path must not contain ':' or ',': %q", ErrInvalidMount, p)
+		}
+	}
+
+	for _, r := range reservedTargets {
+		if m.Target == r || (r != "/" && strings.HasPrefix(m.Target, r+"/")) {
+			return fmt.Errorf("%w: reserved target %q", ErrInvalidMount, m.Target)
+		}
+	}
+
+	return nil
+}
+
+// ParseMounts parses a comma-separated list of SOURCE:TARGET:ro|rw mounts.
+func ParseMounts(s string) ([]Mount, error) {
+	var rt []Mount
+	if s == "" {
+		return rt, nil
+	}
+
+	for _, part := range strings.Split(s, ",") {
+		fields := strings.Split(part, ":")
+		if len(fields) != 3 || (fields[2] != "ro" && fields[2] != "rw") {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidMount, part)
+		}
+
+		m := Mount{Source: fields[0], Target: fields[1], ReadOnly: fields[2] == "ro"}
+		if err := m.Validate(); err != nil {
+			return nil, err
+		}
+		rt = append(rt, m)
+	}
+
+	return rt, nil
+}
+
+// FormatMounts formats mounts as a comma-separated list, suitable for ParseMounts.
+func FormatMounts(mounts []Mount) string {
+	var parts []string
+	for _, m := range mounts {
+		parts = append(parts, m.String())
+	}
+	return strings.Join(parts, ",")
+}
+
+// createMountPoints makes sure mount targets exist under root.
+func createMountPoints(root string, mounts []Mount) error {
+	for _, m := range mounts {
+		if err := os.MkdirAll(filepath.Join(root, m.Target), 0755); err != nil {
+			return fmt.Errorf("failed to create mount point %q: %w", m.Target, err)
+		}
+	}
+	return nil
+}
+
+// mountVolumes bind-mounts the volumes under root, nosuid and nodev. Mount points must exist.
+func mountVolumes(root string, mounts []Mount) error {
+	for _, m := range mounts {
+		target := filepath.Join(root, m.Target)
+
+		if err := unix.Mount(m.Source, target, "", unix.MS_BIND, ""); err != nil {
+			return fmt.Errorf("failed to mount %q: %w", m.Target, err)
+		}
+
+		// bind mount flags are only applied on remount
+		flags := uintptr(unix.MS_NOSUID | unix.MS_NODEV)
+		if m.ReadOnly {
+			flags |= unix.MS_RDONLY
+		}
+		if err := remount(target, flags); err != nil {
+			return fmt.Errorf("failed to remount %q: %w", m.Target, err)
+		}
+	}
+	return nil
+}
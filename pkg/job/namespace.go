@@ -1,11 +1,226 @@
 package job
 
-import "syscall"
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// ErrInvalidNamespace means the job namespace set or hostname is invalid.
+var ErrInvalidNamespace = errors.New("invalid namespace")
+
+// Namespace is a Linux namespace type, named as in lsns(8).
+type Namespace string
+
+const (
+	NsMount = Namespace("mnt")
+	NsPID   = Namespace("pid")
+	NsNet   = Namespace("net")
+	NsUTS   = Namespace("uts")
+	NsIPC   = Namespace("ipc")
+	NsUser  = Namespace("user")
+)
+
+// namespaceFlags are the namespaces which may be turned on and off per job. The mount namespace is
+// always created, network and user ones are defined by the network mode and the user namespace options.
+var namespaceFlags = map[Namespace]uintptr{
+	NsPID: syscall.CLONE_NEWPID,
+	NsUTS: syscall.CLONE_NEWUTS,
+	NsIPC: syscall.CLONE_NEWIPC,
+}
+
+// DefaultNamespaces are the optional namespaces a job gets unless configured otherwise.
+var DefaultNamespaces = []Namespace{NsPID, NsUTS, NsIPC}
+
+// ParseNamespaces parses a comma-separated list of optional namespaces.
+func ParseNamespaces(s string) ([]Namespace, error) {
+	rt := []Namespace{}
+	if s == "" {
+		return rt, nil
+	}
+
+	for _, part := range strings.Split(s, ",") {
+		ns := Namespace(part)
+		if _, ok := namespaceFlags[ns]; !ok {
+			return nil, fmt.Errorf("%w: %q is not configurable", ErrInvalidNamespace, part)
+		}
+		rt = append(rt, ns)
+	}
+
+	return rt, nil
+}
+
+// hasNamespace checks namespace ns is in the list.
+func hasNamespace(list []Namespace, ns Namespace) bool {
+	for _, n := range list {
+		if n == ns {
+			return true
+		}
+	}
+	return false
+}
+
+// hostnameRe matches RFC 1123 host names.
+var hostnameRe = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$`)
+
+// validateHostname checks the job hostname is valid, and fits utsname.
+func validateHostname(name string) error {
+	if len(name) > 64 || !hostnameRe.MatchString(name) {
+		return fmt.Errorf("%w: invalid hostname %q", ErrInvalidNamespace, name)
+	}
+	return nil
+}
+
+// JobWorkDir is where the job working directory is mounted inside the job root filesystem.
+const JobWorkDir = "/work"
+
+// devices are the host device nodes available in the job /dev when the job has its own root FS.
+var devices = []string{"null", "zero", "full", "random", "urandom", "tty"}
 
 // remountProc remounts /proc directory to reflect PID namespace switch in a process.
 func remountProc() error {
-	if err := syscall.Unmount("/proc", syscall.MNT_DETACH); err != nil {
+	// mounts inherited from the parent user namespace are locked, mount over them instead
+	if err := syscall.Unmount("/proc", syscall.MNT_DETACH); err != nil && err != syscall.EINVAL && err != syscall.EPERM {
 		return err
 	}
 	return syscall.Mount("proc", "/proc", "proc", 0, "")
 }
+
+// lockedFlags returns the flags of the mount at path, which must be kept on remount.
+// A user namespace can't clear them on the mounts inherited from the parent namespace.
+func lockedFlags(path string) (uintptr, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+
+	var rt uintptr
+	for stFlag, msFlag := range map[int64]uintptr{
+		unix.ST_NOSUID:     unix.MS_NOSUID,
+		unix.ST_NODEV:      unix.MS_NODEV,
+		unix.ST_NOEXEC:     unix.MS_NOEXEC,
+		unix.ST_NOATIME:    unix.MS_NOATIME,
+		unix.ST_NODIRATIME: unix.MS_NODIRATIME,
+		unix.ST_RELATIME:   unix.MS_RELATIME,
+	} {
+		if st.Flags&stFlag != 0 {
+			rt |= msFlag
+		}
+	}
+	return rt, nil
+}
+
+// remountReadOnly makes the bind mount at path read-only, adding flags.
+func remountReadOnly(path string, flags uintptr) error {
+	return remount(path, unix.MS_RDONLY|flags)
+}
+
+// remount remounts bind mount path with flags, keeping the flags locked by the mount namespace.
+func remount(path string, flags uintptr) error {
+	locked, err := lockedFlags(path)
+	if err != nil {
+		return err
+	}
+	return unix.Mount("", path, "", unix.MS_BIND|unix.MS_REMOUNT|locked|flags, "")
+}
+
+// pivotRoot makes rootfs the root filesystem of the current mount namespace.
+// The root FS is read-only, with job working dir workDir mounted to JobWorkDir, fresh /proc,
+// a minimal /dev, an empty /tmp, and volumes. The host filesystem is detached.
+func pivotRoot(rootfs, workDir string, volumes []Mount) error {
+	// pivot_root requires the new root to be a mount point
+	if err := unix.Mount(rootfs, rootfs, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+		return fmt.Errorf("failed to bind root fs: %w", err)
+	}
+
+	// the only chance to create volume mount points, before the root becomes read-only
+	if err := createMountPoints(rootfs, volumes); err != nil {
+		return err
+	}
+
+	// images are shared by jobs, do not let them change it
+	if err := remountReadOnly(rootfs, 0); err != nil {
+		return fmt.Errorf("failed to make root fs read-only: %w", err)
+	}
+
+	if err := unix.Mount(workDir, filepath.Join(rootfs, JobWorkDir), "", unix.MS_BIND, ""); err != nil {
+		return fmt.Errorf("failed to mount working dir: %w", err)
+	}
+
+	procFlags := uintptr(unix.MS_NOSUID | unix.MS_NODEV | unix.MS_NOEXEC)
+	if err := unix.Mount("proc", filepath.Join(rootfs, "proc"), "proc", procFlags, ""); err != nil {
+		return fmt.Errorf("failed to mount /proc: %w", err)
+	}
+
+	if err := unix.Mount("tmpfs", filepath.Join(rootfs, "tmp"), "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "mode=1777"); err != nil {
+		return fmt.Errorf("failed to mount /tmp: %w", err)
+	}
+
+	if err := setupDev(filepath.Join(rootfs, "dev")); err != nil {
+		return fmt.Errorf("failed to setup /dev: %w", err)
+	}
+
+	if err := mountVolumes(rootfs, volumes); err != nil {
+		return err
+	}
+
+	if err := os.Chdir(rootfs); err != nil {
+		return err
+	}
+
+	// put the old root on top of the new one, and detach it. no need for a put_old directory
+	if err := unix.PivotRoot(".", "."); err != nil {
+		return fmt.Errorf("failed to pivot root: %w", err)
+	}
+
+	if err := unix.Unmount(".", unix.MNT_DETACH); err != nil {
+		return fmt.Errorf("failed to detach host root: %w", err)
+	}
+
+	return os.Chdir(JobWorkDir)
+}
+
+// setupDev creates a minimal /dev in dir: a few host device nodes, and /dev/shm.
+func setupDev(dir string) error {
+	if err := unix.Mount("tmpfs", dir, "tmpfs", unix.MS_NOSUID|unix.MS_NOEXEC, "mode=755"); err != nil {
+		return err
+	}
+
+	for _, d := range devices {
+		node := filepath.Join(dir, d)
+		f, err := os.OpenFile(node, os.O_CREATE|os.O_WRONLY, 0666)
+		if err != nil {
+			return err
+		}
+		_ = f.Close()
+
+		if err := unix.Mount(filepath.Join("/dev", d), node, "", unix.MS_BIND, ""); err != nil {
+			return fmt.Errorf("failed to mount %s: %w", d, err)
+		}
+	}
+
+	links := map[string]string{
+		"fd":     "/proc/self/fd",
+		"stdin":  "/proc/self/fd/0",
+		"stdout": "/proc/self/fd/1",
+		"stderr": "/proc/self/fd/2",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+
+	shm := filepath.Join(dir, "shm")
+	if err := os.Mkdir(shm, 01777); err != nil {
+		return err
+	}
+
+	return unix.Mount("shm", shm, "tmpfs", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, "mode=1777")
+}
@@ -0,0 +1,140 @@
+//go:build linux
+
+package job
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// ErrInvalidNetwork means the network mode is unknown, or cannot be used.
+var ErrInvalidNetwork = errors.New("invalid network")
+
+// NetMode is the job network mode.
+type NetMode string
+
+const (
+	// NetNone is an isolated network namespace with the loopback interface only
+	NetNone = NetMode("none")
+	// NetHost is the host network namespace
+	NetHost = NetMode("host")
+	// NetBridge is an isolated network namespace, connected to the host bridge
+	NetBridge = NetMode("bridge")
+)
+
+// procReady is the message the shim waits for before starting the job command, if the server
+// has to finish the job process setup: in NetBridge mode, or in a user namespace.
+const procReady = "ready"
+
+// ParseNetMode parses the network mode name. Empty name means NetNone.
+func ParseNetMode(s string) (NetMode, error) {
+	switch m := NetMode(s); m {
+	case "":
+		return NetNone, nil
+	case NetNone, NetHost, NetBridge:
+		return m, nil
+	default:
+		return "", fmt.Errorf("%w: unknown mode %q", ErrInvalidNetwork, s)
+	}
+}
+
+// Network connects the job network namespace to the host network. Used in NetBridge mode.
+type Network interface {
+	// Attach configures the network namespace of process pid
+	Attach(pid int) error
+	// Detach releases the host resources allocated for the job
+	Detach() error
+	// Address is the job IP address
+	Address() string
+	// Egress describes the outbound traffic policy of the job
+	Egress() []string
+}
+
+// prepareProc finishes the started job process setup, and lets the shim continue: adds the process
+// to the job cgroup if it's in a user namespace, and connects it to the network in NetBridge mode.
+func (j *Job) prepareProc(ready *os.File) error {
+	defer func() { _ = ready.Close() }()
+
+	if j.userNS == nil && j.netMode != NetBridge {
+		return nil
+	}
+
+	if j.userNS != nil {
+		// the shim has no permissions to do it in its own user namespace
+		if err := addPidToCgroup(j.cmd.Process.Pid, j.cgroupInner); err != nil {
+			return err
+		}
+	}
+
+	if j.netMode == NetBridge {
+		if err := j.network.Attach(j.cmd.Process.Pid); err != nil {
+			return fmt.Errorf("failed to attach network: %w", err)
+		}
+	}
+
+	if _, err := ready.WriteString(procReady); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// detachNetwork releases the job network resources.
+func (j *Job) detachNetwork() {
+	if j.netMode != NetBridge {
+		return
+	}
+
+	if err := j.network.Detach(); err != nil {
+		j.log.Warn().Err(err).Msg("failed to detach network")
+	}
+}
+
+// WaitReady is intended to be called from the shim process, before starting the job command.
+// Blocks until the server has finished the process setup, if needed. Closes f in any case.
+func WaitReady(cfg ProcConfig, f *os.File) error {
+	defer func() { _ = f.Close() }()
+
+	if !cfg.UserNS && cfg.Network != NetBridge {
+		return nil
+	}
+
+	msg, err := io.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	if string(msg) != procReady {
+		return fmt.Errorf("the process setup is not finished")
+	}
+	return nil
+}
+
+// setupLoopback brings the loopback interface of the current network namespace up.
+func setupLoopback() error {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+
+	defer func() { _ = unix.Close(fd) }()
+
+	ifr, err := unix.NewIfreq("lo")
+	if err != nil {
+		return err
+	}
+
+	if err := unix.IoctlIfreq(fd, unix.SIOCGIFFLAGS, ifr); err != nil {
+		return fmt.Errorf("failed to get loopback flags: %w", err)
+	}
+
+	ifr.SetUint16(ifr.Uint16() | unix.IFF_UP)
+	if err := unix.IoctlIfreq(fd, unix.SIOCSIFFLAGS, ifr); err != nil {
+		return fmt.Errorf("failed to bring loopback up: %w", err)
+	}
+
+	return nil
+}
@@ -9,6 +9,13 @@ import (
 
 type Option func(j *Job)
 
+// JobID sets the job ID. A new unique ID is generated if not set.
+func JobID(id ID) Option {
+	return func(j *Job) {
+		j.ID = id
+	}
+}
+
 // Shim is an option to set shim process binary path used to start the job.
 func Shim(path string) Option {
 	return func(j *Job) {
@@ -16,6 +23,98 @@ func Shim(path string) Option {
 	}
 }
 
+// BaseDir is an option to set the directory where job directories are created. /tmp/jobs by default.
+func BaseDir(path string) Option {
+	return func(j *Job) {
+		j.baseJobDir = path
+	}
+}
+
+// Controllers is an option to set cgroup controllers enabled for the job. DefaultControllers if not used.
+// The controllers of the requested limits are required.
+func Controllers(c ...string) Option {
+	return func(j *Job) {
+		j.controllers = append([]string{}, c...)
+	}
+}
+
+// RootFS is an option to run the job in its own root filesystem, located in directory dir.
+func RootFS(dir string) Option {
+	return func(j *Job) {
+		j.rootFS = dir
+	}
+}
+
+// Volume is an option to bind-mount a host path into the job. May be used multiple times.
+func Volume(m Mount) Option {
+	return func(j *Job) {
+		j.volumes = append(j.volumes, m)
+	}
+}
+
+// Net is an option to set the job network mode. NetBridge mode requires network n
+// to connect the job to the host.
+func Net(mode NetMode, n Network) Option {
+	return func(j *Job) {
+		j.netMode = mode
+		j.network = n
+	}
+}
+
+// UserNS is an option to run the job as root in its own user namespace, mapped to host IDs r.
+// UID and GID options are ignored.
+func UserNS(r IDRange) Option {
+	return func(j *Job) {
+		j.userNS = &r
+	}
+}
+
+// Seccomp is an option to filter the job syscalls with profile name, loaded from file path.
+// The built-in profile is used if path is empty.
+func Seccomp(name, path string) Option {
+	return func(j *Job) {
+		j.seccomp = name
+		j.seccompPath = path
+	}
+}
+
+// Caps is an option to keep capabilities c in the job. All the others are dropped.
+func Caps(c ...Capability) Option {
+	return func(j *Job) {
+		j.caps = append(j.caps, c...)
+	}
+}
+
+// Namespaces is an option to set the optional namespaces of the job: pid, uts, ipc.
+// The ones not listed are shared with the host. DefaultNamespaces if not used.
+func Namespaces(ns ...Namespace) Option {
+	return func(j *Job) {
+		j.namespaces = append([]Namespace{}, ns...)
+	}
+}
+
+// Hostname is an option to set the job hostname. Requires uts namespace. The job ID by default.
+func Hostname(name string) Option {
+	return func(j *Job) {
+		j.hostname = name
+	}
+}
+
+// Env is an option to add environment variables to the job command, KEY=VALUE each.
+// The command inherits the server environment otherwise.
+func Env(vars ...string) Option {
+	return func(j *Job) {
+		j.env = append(j.env, vars...)
+	}
+}
+
+// Restart sets the job restart policy.
+func Restart(p RestartPolicy) Option {
+	return func(j *Job) {
+		j.restart = p
+	}
+}
+
 // Cpu is an option to limit job CPU usage. Fractional, may be >1.
 func CPU(cpu float32) Option {
 	return func(j *Job) {
@@ -30,6 +129,41 @@ func Mem(bytes int64) Option {
 	}
 }
 
+// Disk is an option to cap the size of the job working directory.
+func Disk(bytes int64) Option {
+	return func(j *Job) {
+		j.limits.MaxDiskBytes = bytes
+	}
+}
+
+// MemHigh is an option to throttle the job when its RAM usage goes above the limit.
+func MemHigh(bytes int64) Option {
+	return func(j *Job) {
+		j.limits.HighRAMBytes = bytes
+	}
+}
+
+// MemLow is an option to set best-effort RAM protection of the job.
+func MemLow(bytes int64) Option {
+	return func(j *Job) {
+		j.limits.LowRAMBytes = bytes
+	}
+}
+
+// MemMin is an option to set hard RAM protection of the job.
+func MemMin(bytes int64) Option {
+	return func(j *Job) {
+		j.limits.MinRAMBytes = bytes
+	}
+}
+
+// Swap is an option to limit job swap usage. 0 disables swap.
+func Swap(bytes int64) Option {
+	return func(j *Job) {
+		j.limits.MaxSwapBytes = &bytes
+	}
+}
+
 // IO is an option to limit job IO rate.
 func IO(bytes int64) Option {
 	return func(j *Job) {
@@ -37,6 +171,34 @@ func IO(bytes int64) Option {
 	}
 }
 
+// DeviceIO is an option to limit job IO rate on a block device. May be used multiple times.
+func DeviceIO(l DeviceIOLimit) Option {
+	return func(j *Job) {
+		j.limits.Devices = append(j.limits.Devices, l)
+	}
+}
+
+// IOWeight is an option to set job proportional IO share.
+func IOWeight(w int) Option {
+	return func(j *Job) {
+		j.limits.IOWeight = w
+	}
+}
+
+// Trigger is an option to watch job Pressure Stall Information. May be used multiple times.
+func Trigger(t PressureTrigger) Option {
+	return func(j *Job) {
+		j.pressureTriggers = append(j.pressureTriggers, t)
+	}
+}
+
+// Rlimits is an option to set POSIX resource limits of the job process.
+func Rlimits(limits ...Rlimit) Option {
+	return func(j *Job) {
+		j.rlimits = append(j.rlimits, limits...)
+	}
+}
+
 // UID is an option to set job process UID.
 func UID(id int) Option {
 	return func(j *Job) {
@@ -58,13 +220,6 @@ func cgroup(path string) Option {
 	}
 }
 
-// dir is an option to set base job dir.
-func dir(path string) Option {
-	return func(j *Job) {
-		j.baseJobDir = path
-	}
-}
-
 // cmdStart is an option to mock start operation
 func cmdStart(start func(c *exec.Cmd) error) Option {
 	return func(j *Job) {
@@ -86,6 +241,15 @@ func cmdSignal(signal func(c *exec.Cmd, s os.Signal) error) Option {
 	}
 }
 
+// mountFun is an option to mock mount and unmount operations
+func mountFun(mount func(source, target, fstype string, flags uintptr, data string) error,
+	unmount func(target string, flags int) error) Option {
+	return func(j *Job) {
+		j.syscalls.mount = mount
+		j.syscalls.unmount = unmount
+	}
+}
+
 // Log is an option to set job logger.
 func Log(l zerolog.Logger) Option {
 	return func(j *Job) {
@@ -15,11 +15,64 @@ func TestUidOption(t *testing.T) {
 
 	j, err := New("ls", []string{"/tmp", "/var"},
 		cmdStart(defStart), cmdWait(defWait),
-		dir(jDir),
+		BaseDir(jDir),
 		cgroup(t.TempDir()), UID(222))
 	assert.NoError(t, err)
 
 	assert.Equal(t, 222, j.ids.UID)
 }
 
+func TestRootFSOption(t *testing.T) {
+	appFs = afero.NewMemMapFs()
+
+	j, err := New("ls", nil,
+		cmdStart(defStart), cmdWait(defWait),
+		BaseDir(t.TempDir()),
+		cgroup(t.TempDir()), RootFS("/images/debian"))
+	assert.NoError(t, err)
+
+	assert.Equal(t, "/images/debian", j.rootFS)
+	assert.Contains(t, j.cmdArgs(), "--rootfs=/images/debian")
+}
+
+func TestSeccompOption(t *testing.T) {
+	appFs = afero.NewMemMapFs()
+
+	j, err := New("ls", nil,
+		cmdStart(defStart), cmdWait(defWait),
+		BaseDir(t.TempDir()),
+		cgroup(t.TempDir()), Seccomp("default", ""))
+	assert.NoError(t, err)
+
+	assert.Contains(t, j.cmdArgs(), "--seccomp=default")
+	assert.Equal(t, "default", j.Details().Seccomp)
+
+	j, err = New("ls", nil,
+		cmdStart(defStart), cmdWait(defWait),
+		BaseDir(t.TempDir()),
+		cgroup(t.TempDir()), Seccomp("strict", "/etc/jobs/strict.json"))
+	assert.NoError(t, err)
+
+	assert.Contains(t, j.cmdArgs(), "--seccomp=/etc/jobs/strict.json")
+}
+
+func TestCapsOption(t *testing.T) {
+	appFs = afero.NewMemMapFs()
+
+	caps, err := ParseCaps("net_raw,CAP_NET_BIND_SERVICE")
+	assert.NoError(t, err)
+
+	j, err := New("ls", nil,
+		cmdStart(defStart), cmdWait(defWait),
+		BaseDir(t.TempDir()),
+		cgroup(t.TempDir()), Caps(caps...))
+	assert.NoError(t, err)
+
+	assert.Contains(t, j.cmdArgs(), "--caps=CAP_NET_BIND_SERVICE,CAP_NET_RAW")
+	assert.Equal(t, caps, j.Details().Caps)
+
+	_, err = ParseCaps("NET_BIND_SERVICE,FLY")
+	assert.ErrorIs(t, err, ErrInvalidCapability)
+}
+
 //TODO add tests for other options
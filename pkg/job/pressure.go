@@ -0,0 +1,254 @@
+//go:build linux
+
+package job
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// PressureResources is the list of resources with Pressure Stall Information available.
+var PressureResources = []string{"cpu", "memory", "io"}
+
+// ErrInvalidTrigger means the pressure trigger cannot be registered.
+var ErrInvalidTrigger = errors.New("invalid pressure trigger")
+
+// pressureStopTimeout is the graceful stop timeout used when a pressure trigger stops the job.
+const pressureStopTimeout = 30 * time.Second
+
+// maxPressureEvents is the number of the last fired triggers kept.
+const maxPressureEvents = 100
+
+// PressureAvg is a single PSI line: the share of time tasks were stalled on a resource.
+type PressureAvg struct {
+	// Avg10 is the stall percentage over the last 10 seconds
+	Avg10 float64
+	// Avg60 is the stall percentage over the last 60 seconds
+	Avg60 float64
+	// Avg300 is the stall percentage over the last 300 seconds
+	Avg300 float64
+	// Total is the total stall time
+	Total time.Duration
+}
+
+// Pressure is PSI of a single resource.
+type Pressure struct {
+	// Resource is cpu, memory or io
+	Resource string
+	// Some is the time at least some tasks were stalled
+	Some PressureAvg
+	// Full is the time all non-idle tasks were stalled
+	Full PressureAvg
+}
+
+// PressureTrigger defines a PSI threshold: Stall time within Window.
+type PressureTrigger struct {
+	// Resource is cpu, memory or io
+	Resource string
+	// Full selects 'full' stall time instead of 'some'
+	Full bool
+	// Stall is the stall time threshold
+	Stall time.Duration
+	// Window is the time window to measure the stall time in
+	Window time.Duration
+	// Stop makes the job to stop gracefully when the trigger fires
+	Stop bool
+}
+
+// PressureEvent is a record of a fired pressure trigger.
+type PressureEvent struct {
+	Trigger PressureTrigger
+	Time    time.Time
+}
+
+// String formats the trigger the way the kernel expects it in *.pressure files.
+func (t PressureTrigger) String() string {
+	kind := "some"
+	if t.Full {
+		kind = "full"
+	}
+	return fmt.Sprintf("%s %d %d", kind, t.Stall.Microseconds(), t.Window.Microseconds())
+}
+
+// Validate checks the trigger is acceptable by the kernel.
+func (t PressureTrigger) Validate() error {
+	if !isPressureResource(t.Resource) {
+		return fmt.Errorf("%w: unknown resource %q", ErrInvalidTrigger, t.Resource)
+	}
+	if t.Window < 500*time.Millisecond || t.Window > 10*time.Second {
+		return fmt.Errorf("%w: window must be in range 500ms-10s", ErrInvalidTrigger)
+	}
+	if t.Stall <= 0 || t.Stall > t.Window {
+		return fmt.Errorf("%w: stall time must be positive and not exceed the window", ErrInvalidTrigger)
+	}
+	return nil
+}
+
+// isPressureResource checks if PSI is available for resource r.
+func isPressureResource(r string) bool {
+	for _, pr := range PressureResources {
+		if pr == r {
+			return true
+		}
+	}
+	return false
+}
+
+// readPressure reads PSI of resource from the job cgroup.
+func (j *Job) readPressure(resource string) (Pressure, error) {
+	rt := Pressure{Resource: resource}
+
+	f, err := os.Open(filepath.Join(j.cgroupInner, resource+".pressure"))
+	if err != nil {
+		return rt, fmt.Errorf("failed to read pressure: %w", err)
+	}
+
+	defer func() { _ = f.Close() }()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		parts := strings.Fields(s.Text())
+		if len(parts) == 0 {
+			continue
+		}
+
+		var avg *PressureAvg
+		switch parts[0] {
+		case "some":
+			avg = &rt.Some
+		case "full":
+			avg = &rt.Full
+		default:
+			continue
+		}
+
+		for _, p := range parts[1:] {
+			k, v, ok := strings.Cut(p, "=")
+			if !ok {
+				continue
+			}
+			switch k {
+			case "avg10":
+				avg.Avg10, err = strconv.ParseFloat(v, 64)
+			case "avg60":
+				avg.Avg60, err = strconv.ParseFloat(v, 64)
+			case "avg300":
+				avg.Avg300, err = strconv.ParseFloat(v, 64)
+			case "total":
+				var us int64
+				us, err = strconv.ParseInt(v, 10, 64)
+				avg.Total = time.Duration(us) * time.Microsecond
+			}
+			if err != nil {
+				return rt, fmt.Errorf("unexpected pressure format: %q", s.Text())
+			}
+		}
+	}
+
+	return rt, s.Err()
+}
+
+// pressure returns PSI of all resources of the job, while the job cgroup exists.
+func (j *Job) pressure() []Pressure {
+	// supposed to be called under j.stateLock
+	st := j.handler.status()
+	if st != StatusActive && st != StatusStopping {
+		return nil
+	}
+
+	var rt []Pressure
+	for _, r := range PressureResources {
+		p, err := j.readPressure(r)
+		if err != nil {
+			j.log.Debug().Err(err).Str("resource", r).Msg("no pressure info")
+			continue
+		}
+		rt = append(rt, p)
+	}
+	return rt
+}
+
+// registerTrigger installs PSI trigger t to the job cgroup, returning the file to poll.
+func (j *Job) registerTrigger(t PressureTrigger) (*os.File, error) {
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(filepath.Join(j.cgroupInner, t.Resource+".pressure"), os.O_RDWR|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register pressure trigger: %w", err)
+	}
+
+	// the kernel expects a null-terminated string
+	if _, err := f.WriteString(t.String() + "\x00"); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("failed to register pressure trigger %q: %w", t, err)
+	}
+
+	return f, nil
+}
+
+// watchPressure waits for PSI events of trigger t, until the job ends.
+func (j *Job) watchPressure(f *os.File, t PressureTrigger) {
+	defer func() { _ = f.Close() }()
+
+	fds := []unix.PollFd{{Fd: int32(f.Fd()), Events: unix.POLLPRI}}
+
+	for {
+		select {
+		case <-j.done:
+			return
+		default:
+		}
+
+		n, err := unix.Poll(fds, 1000)
+		if err != nil {
+			if err == unix.EINTR {
+				continue
+			}
+			j.log.Warn().Err(err).Msg("failed to watch pressure")
+			return
+		}
+
+		if n == 0 {
+			continue
+		}
+
+		if fds[0].Revents&unix.POLLERR != 0 {
+			// the cgroup is gone
+			return
+		}
+
+		if fds[0].Revents&unix.POLLPRI != 0 {
+			j.pressureEvent(t)
+		}
+	}
+}
+
+// pressureEvent records the fired trigger t, dropping the oldest record over maxPressureEvents,
+// and stops the job if requested.
+func (j *Job) pressureEvent(t PressureTrigger) {
+	j.stateLock.Lock()
+	j.pressureEvents = append(j.pressureEvents, PressureEvent{Trigger: t, Time: time.Now()})
+	if n := len(j.pressureEvents); n > maxPressureEvents {
+		j.pressureEvents = append(j.pressureEvents[:0], j.pressureEvents[n-maxPressureEvents:]...)
+	}
+	j.stateLock.Unlock()
+
+	j.log.Warn().Str("resource", t.Resource).Str("trigger", t.String()).Msg("pressure trigger fired")
+
+	if t.Stop {
+		if err := j.InitStop(pressureStopTimeout); err != nil {
+			j.log.Debug().Err(err).Msg("failed to stop the job on pressure")
+		}
+	}
+}
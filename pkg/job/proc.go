@@ -0,0 +1,101 @@
+//go:build linux
+
+package job
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// ProcConfig is the job process setup, done by the shim process before the job command is executed.
+type ProcConfig struct {
+	// Cgroup is the path to the cgroup to add the process to
+	Cgroup string
+	// IDs are UID/GID of the job process
+	IDs ExecIdentity
+	// Rlimits are POSIX resource limits of the job process
+	Rlimits []Rlimit
+	// RootFS is the job root filesystem directory. The host root is used if empty
+	RootFS string
+	// Volumes are host paths to bind-mount into the job
+	Volumes []Mount
+	// Network is the job network mode
+	Network NetMode
+	// UserNS is set if the process is in its own user namespace. The server adds it to the cgroup
+	UserNS bool
+	// Seccomp is the syscall filtering profile file, or the built-in profile name. No filtering if empty.
+	// The shim installs it right before executing the job command
+	Seccomp string
+	// Caps are the capabilities the job command keeps. All the others are dropped
+	Caps []Capability
+	// Hostname is set in the job UTS namespace, if not empty
+	Hostname string
+}
+
+// SetupProc is intended to be called from shim process, adding the process to required cgroup
+// and configuring /proc to make tools like top and ps work
+func SetupProc(cfg ProcConfig) error {
+	// must be done while the host cgroup FS is visible
+	if !cfg.UserNS {
+		if err := addPidToCgroup(os.Getpid(), cfg.Cgroup); err != nil {
+			return err
+		}
+	}
+
+	if cfg.RootFS != "" {
+		// the shim is started in the job working dir
+		wd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		if err := pivotRoot(cfg.RootFS, wd, cfg.Volumes); err != nil {
+			return err
+		}
+	} else {
+		if err := remountProc(); err != nil {
+			return err
+		}
+		// no way to create mount points in the host FS, they must exist
+		if err := mountVolumes("/", cfg.Volumes); err != nil {
+			return err
+		}
+	}
+
+	if cfg.Network != NetHost {
+		if err := setupLoopback(); err != nil {
+			return err
+		}
+	}
+
+	if cfg.Hostname != "" {
+		if err := unix.Sethostname([]byte(cfg.Hostname)); err != nil {
+			return fmt.Errorf("failed to set hostname: %w", err)
+		}
+	}
+
+	// without a PID namespace, orphans would be re-parented to the host init
+	if err := unix.Prctl(unix.PR_SET_CHILD_SUBREAPER, 1, 0, 0, 0); err != nil {
+		return err
+	}
+
+	// must be done before dropping privileges, to be able to raise hard limits
+	if err := setupRlimits(cfg.Rlimits); err != nil {
+		return err
+	}
+
+	if err := dropCaps(cfg.Caps); err != nil {
+		return err
+	}
+
+	if err := setupIDs(cfg.IDs); err != nil {
+		return err
+	}
+
+	if err := raiseCaps(cfg.Caps); err != nil {
+		return err
+	}
+
+	return nil
+}
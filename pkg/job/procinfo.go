@@ -0,0 +1,160 @@
+//go:build linux
+
+package job
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clockTicks is USER_HZ, the unit of process CPU times in /proc/PID/stat
+const clockTicks = 100
+
+// procPath is the procfs mount point. Overridden in tests.
+var procPath = "/proc"
+
+// ProcessInfo describes a process in the job cgroup.
+type ProcessInfo struct {
+	// PID is the process ID in the host PID namespace
+	PID int
+	// NsPID is the process ID in the job PID namespace. Same as PID, if the job shares the host one
+	NsPID int
+	// Cmdline is the process command line. For a process without one, it's the command name in brackets
+	Cmdline []string
+	// State is the process state letter, as in ps(1): R, S, D, Z etc.
+	State string
+	// CPUTime is the user + system CPU time of the process
+	CPUTime time.Duration
+	// RSS is the process resident set size in bytes
+	RSS int64
+}
+
+// Processes lists the processes in the job cgroup: the shim, the job command and all its descendants,
+// including re-parented ones, and commands executed in the job.
+func (j *Job) Processes() ([]ProcessInfo, error) {
+	j.stateLock.Lock()
+	defer j.stateLock.Unlock()
+
+	if st := j.handler.status(); st != StatusActive && st != StatusStopping {
+		return nil, ErrNotRunning
+	}
+
+	if j.restartTimer != nil {
+		// waiting for a restart, there's no process
+		return nil, ErrNotRunning
+	}
+
+	pids, err := readCgroupProcs(j.cgroupInner)
+	if err != nil {
+		return nil, err
+	}
+
+	rt := make([]ProcessInfo, 0, len(pids))
+	for _, pid := range pids {
+		p, err := readProcess(pid)
+		if errors.Is(err, fs.ErrNotExist) {
+			// the process has exited since cgroup.procs was read
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		rt = append(rt, p)
+	}
+
+	return rt, nil
+}
+
+// readCgroupProcs returns the PIDs of cgroup cg.
+func readCgroupProcs(cg string) ([]int, error) {
+	data, err := os.ReadFile(filepath.Join(cg, "cgroup.procs"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cgroup processes: %w", err)
+	}
+
+	var rt []int
+	for _, f := range strings.Fields(string(data)) {
+		pid, err := strconv.Atoi(f)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected cgroup.procs format: %q", f)
+		}
+		rt = append(rt, pid)
+	}
+	return rt, nil
+}
+
+// readProcess reads process pid details from procfs.
+func readProcess(pid int) (ProcessInfo, error) {
+	rt := ProcessInfo{PID: pid, NsPID: pid}
+	dir := filepath.Join(procPath, strconv.Itoa(pid))
+
+	stat, err := os.ReadFile(filepath.Join(dir, "stat"))
+	if err != nil {
+		return rt, err
+	}
+
+	// the command name is in parentheses, and may contain spaces and parentheses itself
+	s := string(stat)
+	open, end := strings.IndexByte(s, '('), strings.LastIndexByte(s, ')')
+	if open < 0 || end < open {
+		return rt, fmt.Errorf("unexpected %s/stat format", dir)
+	}
+	comm := s[open+1 : end]
+
+	// fields, starting with the 3rd one: state
+	fields := strings.Fields(s[end+1:])
+	if len(fields) < 22 {
+		return rt, fmt.Errorf("unexpected %s/stat format", dir)
+	}
+	rt.State = fields[0]
+
+	var n [3]int64
+	for i, f := range []string{fields[11], fields[12], fields[21]} {
+		if n[i], err = strconv.ParseInt(f, 10, 64); err != nil {
+			return rt, fmt.Errorf("unexpected %s/stat format: %w", dir, err)
+		}
+	}
+	utime, stime, rss := n[0], n[1], n[2]
+	rt.CPUTime = time.Duration(utime+stime) * time.Second / clockTicks
+	rt.RSS = rss * int64(os.Getpagesize())
+
+	cmdline, err := os.ReadFile(filepath.Join(dir, "cmdline"))
+	if err != nil {
+		return rt, err
+	}
+	if args := strings.Split(strings.TrimRight(string(cmdline), "\x00"), "\x00"); args[0] != "" {
+		rt.Cmdline = args
+	} else {
+		rt.Cmdline = []string{"[" + comm + "]"}
+	}
+
+	status, err := os.Open(filepath.Join(dir, "status"))
+	if err != nil {
+		return rt, err
+	}
+	defer func() { _ = status.Close() }()
+
+	sc := bufio.NewScanner(status)
+	for sc.Scan() {
+		if !strings.HasPrefix(sc.Text(), "NSpid:") {
+			continue
+		}
+		v := strings.TrimPrefix(sc.Text(), "NSpid:")
+		// the last one is the innermost namespace
+		if ids := strings.Fields(v); len(ids) > 0 {
+			if rt.NsPID, err = strconv.Atoi(ids[len(ids)-1]); err != nil {
+				return rt, fmt.Errorf("unexpected %s/status format: %w", dir, err)
+			}
+		}
+		break
+	}
+
+	return rt, sc.Err()
+}
@@ -0,0 +1,201 @@
+//go:build linux
+
+package job
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrInvalidRestartPolicy means the restart policy is not valid
+var ErrInvalidRestartPolicy = errors.New("invalid restart policy")
+
+// ErrNoAttempt means the job has no such attempt
+var ErrNoAttempt = errors.New("no such attempt")
+
+// RestartMode defines when the job command is restarted
+type RestartMode string
+
+const (
+	// RestartNever means the job ends with its command. The default
+	RestartNever = RestartMode("never")
+	// RestartOnFailure restarts the command if it exits with a non-zero code, or is killed
+	RestartOnFailure = RestartMode("on-failure")
+	// RestartAlways restarts the command whenever it exits, until the job is stopped
+	RestartAlways = RestartMode("always")
+)
+
+// DefaultRestartBackoff is the delay before the first restart
+const DefaultRestartBackoff = time.Second
+
+// MinRestartBackoff is the min delay before a restart, so that a crashing command doesn't spin
+const MinRestartBackoff = 100 * time.Millisecond
+
+// DefaultMaxRestartBackoff caps the exponential restart backoff
+const DefaultMaxRestartBackoff = 5 * time.Minute
+
+// RestartPolicy defines if and when the job command is restarted. Each run of the command is
+// an attempt, with its own exit code and output segment.
+type RestartPolicy struct {
+	// Mode is when to restart. RestartNever if empty
+	Mode RestartMode
+	// MaxRetries is the max number of restarts. 0 means no limit
+	MaxRetries int
+	// Backoff is the delay before the first restart, doubled for each next one. DefaultRestartBackoff if 0
+	Backoff time.Duration
+	// MaxBackoff caps the restart delay. DefaultMaxRestartBackoff if 0
+	MaxBackoff time.Duration
+}
+
+// Validate checks if the policy is valid.
+func (p RestartPolicy) Validate() error {
+	switch p.Mode {
+	case "", RestartNever, RestartOnFailure, RestartAlways:
+	default:
+		return fmt.Errorf("%w: unknown mode %q", ErrInvalidRestartPolicy, p.Mode)
+	}
+
+	if p.MaxRetries < 0 || p.Backoff < 0 || p.MaxBackoff < 0 {
+		return fmt.Errorf("%w: negative value", ErrInvalidRestartPolicy)
+	}
+
+	if p.Backoff != 0 && p.Backoff < MinRestartBackoff || p.MaxBackoff != 0 && p.MaxBackoff < MinRestartBackoff {
+		return fmt.Errorf("%w: backoff is less than %v", ErrInvalidRestartPolicy, MinRestartBackoff)
+	}
+	return nil
+}
+
+// delay returns the backoff before restart n, starting with 1.
+func (p RestartPolicy) delay(n int) time.Duration {
+	d, max := p.Backoff, p.MaxBackoff
+	if d == 0 {
+		d = DefaultRestartBackoff
+	}
+	if max == 0 {
+		max = DefaultMaxRestartBackoff
+	}
+
+	for i := 1; i < n && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
+
+// Attempt is a run of the job command.
+type Attempt struct {
+	// Started is when the process was started
+	Started time.Time
+	// Ended is when the process exited. Zero while it's running
+	Ended time.Time
+	// ExitCode is the process exit code, once it has exited
+	ExitCode int
+	// Error is why the process failed to start, if it did
+	Error string
+	// LogOffset is where the attempt output starts in the job output
+	LogOffset int64
+	// LogSize is the attempt output size, once the process has exited
+	LogSize int64
+}
+
+// attempt is the internal attempt record.
+type attempt struct {
+	Attempt
+	// closed when the attempt has ended. LogSize is final after that
+	done chan struct{}
+	// end of the attempt output, valid once done is closed
+	logEnd int64
+}
+
+// restartDue checks if the job command has to be restarted after the last attempt.
+func (j *Job) restartDue() bool {
+	// supposed to be called under j.stateLock
+	switch j.restart.Mode {
+	case RestartAlways:
+	case RestartOnFailure:
+		if j.exitCode == 0 {
+			return false
+		}
+	default:
+		return false
+	}
+
+	retries := len(j.attempts) - 1
+	return j.restart.MaxRetries == 0 || retries < j.restart.MaxRetries
+}
+
+// attemptEnded records the end of the last attempt, and either schedules the next one, or finishes the job.
+func (j *Job) attemptEnded(exitCode int) {
+	// supposed to be called under j.stateLock
+	j.exitCode = exitCode
+
+	a := j.attempts[len(j.attempts)-1]
+	a.Ended = time.Now()
+	a.ExitCode = exitCode
+	a.logEnd = j.outputSize()
+	a.LogSize = a.logEnd - a.LogOffset
+	close(a.done)
+
+	if j.handler.status() == StatusActive && j.restartDue() {
+		d := j.restart.delay(len(j.attempts))
+		j.log.Info().Int("exit_code", exitCode).Dur("delay", d).Msg("job command will be restarted")
+
+		j.nextRestart = time.Now().Add(d)
+		j.restartTimer = time.AfterFunc(d, j.restartProc)
+		return
+	}
+
+	j.finish()
+}
+
+// restartProc starts the next attempt of the job command, unless the restart has been cancelled.
+func (j *Job) restartProc() {
+	j.stateLock.Lock()
+	defer j.stateLock.Unlock()
+
+	if j.restartTimer == nil {
+		return
+	}
+	j.restartTimer = nil
+	j.nextRestart = time.Time{}
+
+	j.log.Info().Int("attempt", len(j.attempts)+1).Msg("restarting job command")
+
+	if err := j.startProc(); err != nil {
+		j.log.Warn().Err(err).Msg("failed to restart job command")
+
+		j.attempts = append(j.attempts, &attempt{
+			Attempt: Attempt{Started: time.Now(), Error: err.Error(), LogOffset: j.outputSize()},
+			done:    make(chan struct{}),
+		})
+		j.attemptEnded(-1)
+	}
+}
+
+// cancelRestart cancels the pending restart, if any, and finishes the job. Returns true if it was pending.
+func (j *Job) cancelRestart() bool {
+	// supposed to be called under j.stateLock
+	if j.restartTimer == nil {
+		return false
+	}
+
+	j.restartTimer.Stop()
+	j.restartTimer = nil
+	j.nextRestart = time.Time{}
+
+	j.finish()
+	return true
+}
+
+// attemptsInfo returns the attempts history.
+func (j *Job) attemptsInfo() []Attempt {
+	// supposed to be called under j.stateLock
+	rt := make([]Attempt, 0, len(j.attempts))
+	for _, a := range j.attempts {
+		rt = append(rt, a.Attempt)
+	}
+	return rt
+}
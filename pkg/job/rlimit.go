@@ -0,0 +1,164 @@
+//go:build linux
+
+package job
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// ErrInvalidRlimit means the resource limit is unknown or malformed.
+var ErrInvalidRlimit = errors.New("invalid rlimit")
+
+// RlimInfinity is the value of unlimited resource.
+const RlimInfinity = uint64(math.MaxUint64)
+
+// rlimitResources maps supported resource names to RLIMIT_* values.
+var rlimitResources = map[string]int{
+	"nofile": syscall.RLIMIT_NOFILE,
+	"core":   syscall.RLIMIT_CORE,
+	"stack":  syscall.RLIMIT_STACK,
+	"fsize":  syscall.RLIMIT_FSIZE,
+	"cpu":    syscall.RLIMIT_CPU,
+}
+
+// RlimitResources returns names of supported resources.
+func RlimitResources() []string {
+	var rt []string
+	for r := range rlimitResources {
+		rt = append(rt, r)
+	}
+	sort.Strings(rt)
+	return rt
+}
+
+// Rlimit is a POSIX resource limit of the job process.
+type Rlimit struct {
+	// Resource is one of nofile, core, stack, fsize, cpu
+	Resource string
+	// Soft is the soft limit
+	Soft uint64
+	// Hard is the hard limit
+	Hard uint64
+}
+
+// String formats the limit as RESOURCE=SOFT:HARD.
+func (r Rlimit) String() string {
+	return r.Resource + "=" + rlimitValue(r.Soft) + ":" + rlimitValue(r.Hard)
+}
+
+// Validate checks the resource is supported, and soft limit does not exceed the hard one.
+func (r Rlimit) Validate() error {
+	if _, ok := rlimitResources[r.Resource]; !ok {
+		return fmt.Errorf("%w: unknown resource %q", ErrInvalidRlimit, r.Resource)
+	}
+	if r.Soft > r.Hard {
+		return fmt.Errorf("%w: %s soft limit exceeds hard limit", ErrInvalidRlimit, r.Resource)
+	}
+	return nil
+}
+
+// rlimitValue formats a single limit value.
+func rlimitValue(v uint64) string {
+	if v == RlimInfinity {
+		return "unlimited"
+	}
+	return strconv.FormatUint(v, 10)
+}
+
+// parseRlimitValue parses a single limit value, a number or 'unlimited'.
+func parseRlimitValue(s string) (uint64, error) {
+	if s == "unlimited" {
+		return RlimInfinity, nil
+	}
+	v, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidRlimit, s)
+	}
+	return v, nil
+}
+
+// ParseRlimit parses the limit of resource given as SOFT:HARD or as a single value used for both.
+func ParseRlimit(resource, value string) (Rlimit, error) {
+	rt := Rlimit{Resource: resource}
+
+	soft, hard, ok := strings.Cut(value, ":")
+	if !ok {
+		hard = soft
+	}
+
+	var err error
+	if rt.Soft, err = parseRlimitValue(soft); err != nil {
+		return rt, err
+	}
+	if rt.Hard, err = parseRlimitValue(hard); err != nil {
+		return rt, err
+	}
+
+	return rt, rt.Validate()
+}
+
+// ParseRlimits parses a comma-separated list of RESOURCE=SOFT:HARD limits.
+func ParseRlimits(s string) ([]Rlimit, error) {
+	var rt []Rlimit
+	if s == "" {
+		return rt, nil
+	}
+
+	for _, part := range strings.Split(s, ",") {
+		res, val, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidRlimit, part)
+		}
+		r, err := ParseRlimit(res, val)
+		if err != nil {
+			return nil, err
+		}
+		rt = append(rt, r)
+	}
+
+	return rt, nil
+}
+
+// FormatRlimits formats limits as a comma-separated list, suitable for ParseRlimits.
+func FormatRlimits(limits []Rlimit) string {
+	var parts []string
+	for _, r := range limits {
+		parts = append(parts, r.String())
+	}
+	return strings.Join(parts, ",")
+}
+
+// CurrentRlimit returns the resource limit of the current process.
+func CurrentRlimit(resource string) (Rlimit, error) {
+	res, ok := rlimitResources[resource]
+	if !ok {
+		return Rlimit{}, fmt.Errorf("%w: unknown resource %q", ErrInvalidRlimit, resource)
+	}
+
+	var l syscall.Rlimit
+	if err := syscall.Getrlimit(res, &l); err != nil {
+		return Rlimit{}, err
+	}
+
+	return Rlimit{Resource: resource, Soft: l.Cur, Hard: l.Max}, nil
+}
+
+// setupRlimits applies the resource limits to the current process.
+func setupRlimits(limits []Rlimit) error {
+	for _, r := range limits {
+		res, ok := rlimitResources[r.Resource]
+		if !ok {
+			return fmt.Errorf("%w: unknown resource %q", ErrInvalidRlimit, r.Resource)
+		}
+		if err := syscall.Setrlimit(res, &syscall.Rlimit{Cur: r.Soft, Max: r.Hard}); err != nil {
+			return fmt.Errorf("failed to set %s limit: %w", r.Resource, err)
+		}
+	}
+	return nil
+}
@@ -25,8 +25,8 @@ func (a activeHandler) gracefulStop(j *Job, to time.Duration) error {
 }
 
 // logs returns a new concurrent reader object to get the job output
-func (a activeHandler) logs(j *Job) (io.ReadCloser, error) {
-	return j.logsReader()
+func (a activeHandler) logs(j *Job, at *attempt) (io.ReadCloser, error) {
+	return j.logsReader(at)
 }
 
 // forceStop ends the job process immediately, sending SIGKILL
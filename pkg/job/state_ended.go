@@ -27,8 +27,8 @@ func (e endedHandler) cleanup(j *Job) error {
 }
 
 // logs returns a new concurrent reader object to get the job output
-func (e endedHandler) logs(j *Job) (io.ReadCloser, error) {
-	return j.logsReader()
+func (e endedHandler) logs(j *Job, at *attempt) (io.ReadCloser, error) {
+	return j.logsReader(at)
 }
 
 // exited process end event. send internally, when the job's j.cmd.Wait() call returns
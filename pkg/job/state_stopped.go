@@ -27,8 +27,8 @@ func (s stoppedHandler) cleanup(j *Job) error {
 }
 
 // logs returns a new concurrent reader object to get the job output
-func (s stoppedHandler) logs(j *Job) (io.ReadCloser, error) {
-	return j.logsReader()
+func (s stoppedHandler) logs(j *Job, at *attempt) (io.ReadCloser, error) {
+	return j.logsReader(at)
 }
 
 // exited process end event. send internally, when the job's j.cmd.Wait() call returns
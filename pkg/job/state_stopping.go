@@ -31,8 +31,8 @@ func (s stoppingHandler) cleanup(j *Job) error {
 }
 
 // logs returns a new concurrent reader object to get the job output
-func (s stoppingHandler) logs(j *Job) (io.ReadCloser, error) {
-	return j.logsReader()
+func (s stoppingHandler) logs(j *Job, at *attempt) (io.ReadCloser, error) {
+	return j.logsReader(at)
 }
 
 // exited process end event. send internally, when the job's j.cmd.Wait() call returns
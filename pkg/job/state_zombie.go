@@ -31,7 +31,7 @@ func (z zombieHandler) cleanup(*Job) error {
 }
 
 // logs returns a new concurrent reader object to get the job output
-func (z zombieHandler) logs(*Job) (io.ReadCloser, error) {
+func (z zombieHandler) logs(*Job, *attempt) (io.ReadCloser, error) {
 	// should never happen
 	return nil, fmt.Errorf("job is removed")
 }
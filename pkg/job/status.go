@@ -1,5 +1,7 @@
 package job
 
+import "time"
+
 // Status is job status
 type Status int
 
@@ -15,6 +17,8 @@ const (
 
 	// StatusRemoved means the jobs has removed. Usually should NOT be client visible anywhere.
 	StatusRemoved = Status(4)
+	// StatusQueued means the job is waiting for the server capacity to start.
+	StatusQueued = Status(5)
 )
 
 // String implements Stringer interface for Status.
@@ -30,10 +34,104 @@ func (s Status) String() string {
 		return "STOPPING"
 	case StatusStopped:
 		return "STOPPED"
+	case StatusQueued:
+		return "QUEUED"
 	default:
 		return "UNKNOWN"
 	}
 }
 
+// Details is a snapshot of the job state.
 type Details struct {
+	// Status is the current job status
+	Status Status
+	// ExitCode is the job process exit code, if the job is ended or stopped. 0 otherwise
+	ExitCode int
+	// Command is the job command with arguments
+	Command []string
+	// Pressure is the current PSI of the job. Available only while the job is running
+	Pressure []Pressure
+	// PressureEvents is the list of the last fired pressure triggers, the oldest first
+	PressureEvents []PressureEvent
+	// DiskUsageBytes is the size of the job working directory
+	DiskUsageBytes int64
+	// DiskLimitBytes is the working directory size limit. 0 means no limit
+	DiskLimitBytes int64
+	// Network is the job network mode
+	Network NetMode
+	// Address is the job IP address in NetBridge mode, while the job is running
+	Address string
+	// Egress is the outbound traffic policy in NetBridge mode
+	Egress []string
+	// IDs are the job process UID/GID. In a user namespace, it's the IDs inside
+	IDs ExecIdentity
+	// Seccomp is the syscall filtering profile name. Empty if unconfined
+	Seccomp string
+	// Caps are the effective capabilities of the job command
+	Caps []Capability
+	// Namespaces are the namespaces the job doesn't share with the host
+	Namespaces []Namespace
+	// Hostname is the job hostname, if it has its own UTS namespace
+	Hostname string
+	// Restart is the job restart policy
+	Restart RestartPolicy
+	// Attempts are the runs of the job command, the last one is the current
+	Attempts []Attempt
+	// NextRestart is when the job command is restarted. Zero, if no restart is pending
+	NextRestart time.Time
+	// QueuePosition is the job position in the queue, starting with 1, while it's StatusQueued
+	QueuePosition int
+	// Error is why a queued job failed to start, if it did
+	Error string
+	// Preemptions are the stops of the job to free the capacity for jobs with higher priorities
+	Preemptions []Preemption
+	// Schedule is the ID of the schedule that started the job, if any
+	Schedule string
+	// Array is the task summary, if it's an array job
+	Array *ArraySummary
+	// ArrayID is the array job of the task, if the job is an array task
+	ArrayID ID
+	// ArrayIndex is the index of the array task
+	ArrayIndex int
+}
+
+// ArraySummary aggregates the task states of an array job.
+type ArraySummary struct {
+	// Total is the number of tasks
+	Total int
+	// Waiting tasks are not started yet, waiting for a parallelism slot
+	Waiting int
+	// Active tasks are started, running or queued
+	Active int
+	// Succeeded tasks have ended with exit code 0
+	Succeeded int
+	// Failed tasks have exited with a non-zero code, were stopped, or failed to start
+	Failed int
+	// Cancelled tasks never start, since the array job is stopped
+	Cancelled int
+	// Tasks are the array tasks, in the index order
+	Tasks []ArrayTask
+}
+
+// ArrayTask is the state of an array task.
+type ArrayTask struct {
+	// Index is the task index
+	Index int
+	// Item is the task item, if the array has an item list
+	Item string
+	// JobID is the task job ID. The job exists once the task is started
+	JobID ID
+	// Status is the task job status. StatusQueued while waiting for a parallelism slot
+	Status Status
+	// ExitCode is the task job exit code, once it's done
+	ExitCode int
+}
+
+// Preemption records a stop of the job to free the capacity for a job with a higher priority.
+// The preempted job is queued again, and its output of the stopped run is discarded.
+type Preemption struct {
+	// At is when the job was preempted
+	At time.Time
+	// By is the job the capacity was freed for
+	By ID
 }
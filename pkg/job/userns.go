@@ -0,0 +1,51 @@
+//go:build linux
+
+package job
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+)
+
+// ErrInvalidIDRange means the user namespace ID range is malformed.
+var ErrInvalidIDRange = errors.New("invalid id range")
+
+// IDRange is a range of host UIDs and GIDs, mapped to the IDs starting from 0 in the job
+// user namespace. The job runs as root inside, i.e. as HostID outside.
+type IDRange struct {
+	// HostID is the first host ID of the range
+	HostID int
+	// Size is the number of IDs
+	Size int
+}
+
+// Validate checks the range is not empty, starts above host root, and fits in 32-bit IDs.
+func (r IDRange) Validate() error {
+	// uid_t is 32-bit, and -1 is reserved
+	if r.HostID <= 0 || r.Size <= 0 || int64(r.HostID)+int64(r.Size) > 1<<32-1 {
+		return fmt.Errorf("%w: %d+%d", ErrInvalidIDRange, r.HostID, r.Size)
+	}
+	return nil
+}
+
+// hostIDs returns the job identity as seen by the host.
+func (j *Job) hostIDs() ExecIdentity {
+	if j.userNS == nil {
+		return j.ids
+	}
+	return ExecIdentity{UID: j.userNS.HostID, GID: j.userNS.HostID}
+}
+
+// setupUserNS configures the job process to run in a new user namespace.
+func (j *Job) setupUserNS(attr *syscall.SysProcAttr) {
+	if j.userNS == nil {
+		return
+	}
+
+	attr.Cloneflags |= syscall.CLONE_NEWUSER
+	attr.UidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: j.userNS.HostID, Size: j.userNS.Size}}
+	attr.GidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: j.userNS.HostID, Size: j.userNS.Size}}
+	// setupIDs drops supplementary groups
+	attr.GidMappingsEnableSetgroups = true
+}
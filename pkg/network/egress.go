@@ -0,0 +1,210 @@
+package network
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidRule means the egress rule is malformed.
+var ErrInvalidRule = errors.New("invalid egress rule")
+
+// ErrEgressNotAllowed means the requested egress policy exceeds the server ceiling.
+var ErrEgressNotAllowed = errors.New("egress is not allowed")
+
+// nftTable is the nftables table with the egress policy, in the job network namespace.
+const nftTable = "inet jobs"
+
+// Rule matches outbound traffic by destination.
+type Rule struct {
+	// CIDR is the destination IPv4 network
+	CIDR *net.IPNet
+	// Port is the destination port. 0 matches any port
+	Port uint16
+	// Protocol is tcp or udp. Empty matches any protocol
+	Protocol string
+}
+
+// ParseRule parses a rule in [PROTOCOL:]CIDR[:PORT] format, e.g. tcp:10.0.0.0/8:443.
+// An address without a mask is a single host.
+func ParseRule(s string) (Rule, error) {
+	var rt Rule
+
+	parts := strings.Split(s, ":")
+	if len(parts) > 0 && (parts[0] == "tcp" || parts[0] == "udp") {
+		rt.Protocol = parts[0]
+		parts = parts[1:]
+	}
+
+	if len(parts) == 0 || len(parts) > 2 {
+		return rt, fmt.Errorf("%w: %q", ErrInvalidRule, s)
+	}
+
+	cidr := parts[0]
+	if !strings.Contains(cidr, "/") {
+		cidr += "/32"
+	}
+	ip, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil || ip.To4() == nil {
+		return rt, fmt.Errorf("%w: invalid IPv4 network in %q", ErrInvalidRule, s)
+	}
+	rt.CIDR = ipNet
+
+	if len(parts) == 2 {
+		p, err := strconv.ParseUint(parts[1], 10, 16)
+		if err != nil || p == 0 {
+			return rt, fmt.Errorf("%w: invalid port in %q", ErrInvalidRule, s)
+		}
+		rt.Port = uint16(p)
+	}
+
+	return rt, nil
+}
+
+// ParseRules parses a list of rules.
+func ParseRules(rules []string) ([]Rule, error) {
+	var rt []Rule
+	for _, s := range rules {
+		r, err := ParseRule(s)
+		if err != nil {
+			return nil, err
+		}
+		rt = append(rt, r)
+	}
+	return rt, nil
+}
+
+// String formats the rule the way ParseRule expects it.
+func (r Rule) String() string {
+	rt := r.CIDR.String()
+	if r.Protocol != "" {
+		rt = r.Protocol + ":" + rt
+	}
+	if r.Port != 0 {
+		rt += ":" + strconv.Itoa(int(r.Port))
+	}
+	return rt
+}
+
+// within checks all the traffic matched by r is matched by o as well.
+func (r Rule) within(o Rule) bool {
+	rOnes, _ := r.CIDR.Mask.Size()
+	oOnes, _ := o.CIDR.Mask.Size()
+	if oOnes > rOnes || !o.CIDR.Contains(r.CIDR.IP) {
+		return false
+	}
+	if o.Protocol != "" && o.Protocol != r.Protocol {
+		return false
+	}
+	return o.Port == 0 || o.Port == r.Port
+}
+
+// nft returns the nftables match expression of the rule.
+func (r Rule) nft() string {
+	rt := "ip daddr " + r.CIDR.String()
+	switch {
+	case r.Protocol != "" && r.Port != 0:
+		rt += fmt.Sprintf(" %s dport %d", r.Protocol, r.Port)
+	case r.Protocol != "":
+		rt += " meta l4proto " + r.Protocol
+	case r.Port != 0:
+		rt += fmt.Sprintf(" meta l4proto { tcp, udp } th dport %d", r.Port)
+	}
+	return rt
+}
+
+// EgressPolicy restricts outbound traffic of a job. Deny rules take precedence. If there are
+// allow rules, only the matching traffic is allowed. An empty policy allows everything.
+type EgressPolicy struct {
+	// Allow are the allowed destinations
+	Allow []Rule
+	// Deny are the denied destinations
+	Deny []Rule
+}
+
+// Empty checks if the policy has no rules.
+func (p EgressPolicy) Empty() bool {
+	return len(p.Allow) == 0 && len(p.Deny) == 0
+}
+
+// Describe returns the human-readable policy rules, in the order they're applied.
+func (p EgressPolicy) Describe() []string {
+	var rt []string
+	for _, r := range p.Deny {
+		rt = append(rt, "deny "+r.String())
+	}
+	for _, r := range p.Allow {
+		rt = append(rt, "allow "+r.String())
+	}
+	if len(p.Allow) > 0 {
+		rt = append(rt, "deny all")
+	}
+	return rt
+}
+
+// nft returns nftables commands installing the policy. Loopback and replies are always allowed.
+func (p EgressPolicy) nft() string {
+	cmds := []string{
+		"add table " + nftTable,
+		"add chain " + nftTable + " output { type filter hook output priority 0 ; policy accept ; }",
+		"add rule " + nftTable + " output oif lo accept",
+		"add rule " + nftTable + " output ct state established,related accept",
+	}
+	for _, r := range p.Deny {
+		cmds = append(cmds, "add rule "+nftTable+" output "+r.nft()+" reject")
+	}
+	for _, r := range p.Allow {
+		cmds = append(cmds, "add rule "+nftTable+" output "+r.nft()+" accept")
+	}
+	if len(p.Allow) > 0 {
+		cmds = append(cmds, "add rule "+nftTable+" output reject")
+	}
+	return strings.Join(cmds, " ; ")
+}
+
+// EgressLimits are the server-wide egress policy settings.
+type EgressLimits struct {
+	// Defaults is the policy of all jobs, the job rules are added to it
+	Defaults EgressPolicy
+	// Max is the ceiling: job allow rules must be within Max allow rules, if any.
+	// Max deny rules are always applied
+	Max EgressPolicy
+}
+
+// Resolve returns the effective policy of a job requesting req: the default rules and the job ones. req may be nil.
+func (l EgressLimits) Resolve(req *EgressPolicy) (EgressPolicy, error) {
+	var rt EgressPolicy
+	rt.Allow = append(rt.Allow, l.Defaults.Allow...)
+	rt.Deny = append(rt.Deny, l.Defaults.Deny...)
+	if req != nil {
+		rt.Allow = append(rt.Allow, req.Allow...)
+		rt.Deny = append(rt.Deny, req.Deny...)
+	}
+
+	if len(l.Max.Allow) > 0 {
+		if len(rt.Allow) == 0 {
+			rt.Allow = append(rt.Allow, l.Max.Allow...)
+		}
+		for _, r := range rt.Allow {
+			if !r.withinAny(l.Max.Allow) {
+				return EgressPolicy{}, fmt.Errorf("%w: %s", ErrEgressNotAllowed, r)
+			}
+		}
+	}
+
+	rt.Deny = append(rt.Deny, l.Max.Deny...)
+
+	return rt, nil
+}
+
+// withinAny checks the rule is within any of the rules.
+func (r Rule) withinAny(rules []Rule) bool {
+	for _, o := range rules {
+		if r.within(o) {
+			return true
+		}
+	}
+	return false
+}
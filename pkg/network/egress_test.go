@@ -0,0 +1,97 @@
+package network
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func rules(t *testing.T, s ...string) []Rule {
+	rt, err := ParseRules(s)
+	assert.NoError(t, err)
+	return rt
+}
+
+func TestParseRule(t *testing.T) {
+	for s, exp := range map[string]string{
+		"10.0.0.0/8":         "10.0.0.0/8",
+		"10.1.2.3":           "10.1.2.3/32",
+		"10.1.2.3/8":         "10.0.0.0/8",
+		"tcp:10.0.0.0/8:443": "tcp:10.0.0.0/8:443",
+		"udp:0.0.0.0/0":      "udp:0.0.0.0/0",
+		"1.1.1.1:53":         "1.1.1.1/32:53",
+	} {
+		r, err := ParseRule(s)
+		assert.NoError(t, err, s)
+		assert.Equal(t, exp, r.String(), s)
+	}
+
+	for _, s := range []string{"", "tcp", "sctp:1.1.1.1", "1.1.1.1:0", "1.1.1.1:70000", "fd00::/8", "1.1.1.1:53:1"} {
+		_, err := ParseRule(s)
+		assert.ErrorIs(t, err, ErrInvalidRule, s)
+	}
+}
+
+func TestResolveEgress(t *testing.T) {
+	l := EgressLimits{
+		Defaults: EgressPolicy{Allow: rules(t, "tcp:10.0.0.0/8:443"), Deny: rules(t, "10.2.0.0/16")},
+		Max: EgressPolicy{
+			Allow: rules(t, "10.0.0.0/8", "tcp:0.0.0.0/0:443"),
+			Deny:  rules(t, "169.254.169.254"),
+		},
+	}
+
+	p, err := l.Resolve(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"deny 10.2.0.0/16", "deny 169.254.169.254/32", "allow tcp:10.0.0.0/8:443", "deny all"}, p.Describe())
+
+	// the job rules are added to the default ones
+	p, err = l.Resolve(&EgressPolicy{Allow: rules(t, "10.1.0.0/16", "tcp:1.1.1.1:443"), Deny: rules(t, "10.1.1.1")})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"deny 10.2.0.0/16", "deny 10.1.1.1/32", "deny 169.254.169.254/32",
+		"allow tcp:10.0.0.0/8:443", "allow 10.1.0.0/16", "allow tcp:1.1.1.1/32:443", "deny all"}, p.Describe())
+
+	// deny-only request gets the ceiling allow rules, without default ones
+	l.Defaults.Allow = nil
+	p, err = l.Resolve(&EgressPolicy{Deny: rules(t, "10.1.1.1")})
+	assert.NoError(t, err)
+	assert.Equal(t, rules(t, "10.0.0.0/8", "tcp:0.0.0.0/0:443"), p.Allow)
+
+	for _, r := range []string{"0.0.0.0/0", "1.1.1.1", "udp:1.1.1.1:443", "1.1.1.1:443"} {
+		_, err = l.Resolve(&EgressPolicy{Allow: rules(t, r)})
+		assert.ErrorIs(t, err, ErrEgressNotAllowed, r)
+	}
+
+	// no ceiling
+	p, err = EgressLimits{}.Resolve(nil)
+	assert.NoError(t, err)
+	assert.True(t, p.Empty())
+}
+
+func TestEgressAttach(t *testing.T) {
+	m, err := New(Config{})
+	assert.NoError(t, err)
+
+	cmds := fakeRun(m)
+
+	e, err := m.Endpoint(nil, EgressPolicy{
+		Allow: rules(t, "tcp:10.0.0.0/8:443", "1.1.1.1:53", "udp:8.8.8.8"),
+		Deny:  rules(t, "10.1.0.0/16"),
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, e.Attach(42))
+
+	assert.Equal(t, "nsenter -t 42 -n nft "+
+		"add table inet jobs ; "+
+		"add chain inet jobs output { type filter hook output priority 0 ; policy accept ; } ; "+
+		"add rule inet jobs output oif lo accept ; "+
+		"add rule inet jobs output ct state established,related accept ; "+
+		"add rule inet jobs output ip daddr 10.1.0.0/16 reject ; "+
+		"add rule inet jobs output ip daddr 10.0.0.0/8 tcp dport 443 accept ; "+
+		"add rule inet jobs output ip daddr 1.1.1.1/32 meta l4proto { tcp, udp } th dport 53 accept ; "+
+		"add rule inet jobs output ip daddr 8.8.8.8/32 meta l4proto udp accept ; "+
+		"add rule inet jobs output reject", (*cmds)[len(*cmds)-1])
+
+	assert.Equal(t, []string{"deny 10.1.0.0/16", "allow tcp:10.0.0.0/8:443", "allow 1.1.1.1/32:53",
+		"allow udp:8.8.8.8/32", "deny all"}, e.Egress())
+}
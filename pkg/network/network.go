@@ -0,0 +1,402 @@
+// Package network connects job network namespaces to a host bridge, with IP allocation,
+// NAT and port publishing. It relies on ip, nsenter and iptables tools.
+package network
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrPortInUse means the host port is already published by another job.
+var ErrPortInUse = errors.New("port is already published")
+
+// ErrInvalidPort means the port mapping is malformed.
+var ErrInvalidPort = errors.New("invalid port")
+
+// ErrNoAddress means the subnet has no free addresses.
+var ErrNoAddress = errors.New("no free address")
+
+const (
+	defaultBridge = "jobs0"
+	defaultSubnet = "10.88.0.0/24"
+)
+
+// jobIface is the job side interface name.
+const jobIface = "eth0"
+
+// Config is the bridge network configuration.
+type Config struct {
+	// Bridge is the host bridge name. jobs0 by default
+	Bridge string
+	// Subnet is the IPv4 subnet of the jobs. The first address is the bridge one. 10.88.0.0/24 by default
+	Subnet string
+	// NAT enables masquerading of the job traffic leaving the host
+	NAT bool
+}
+
+// Port publishes a job port on the host.
+type Port struct {
+	// Host is the host port
+	Host uint16
+	// Job is the job port
+	Job uint16
+	// Protocol is tcp or udp
+	Protocol string
+}
+
+// String formats the port as HOST:JOB/PROTOCOL.
+func (p Port) String() string {
+	return fmt.Sprintf("%d:%d/%s", p.Host, p.Job, p.Protocol)
+}
+
+// Validate checks both ports are set, and the protocol is supported.
+func (p Port) Validate() error {
+	if p.Host == 0 || p.Job == 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidPort, p)
+	}
+	if p.Protocol != "tcp" && p.Protocol != "udp" {
+		return fmt.Errorf("%w: unsupported protocol %q", ErrInvalidPort, p.Protocol)
+	}
+	return nil
+}
+
+// Manager owns the host bridge, and allocates job addresses and ports.
+type Manager struct {
+	lock sync.Mutex
+
+	bridge  string
+	nat     bool
+	subnet  *net.IPNet
+	gateway net.IP
+
+	// ready is set when the bridge is configured
+	ready bool
+	// allocated host indexes in the subnet
+	addrs map[uint32]bool
+	// published host ports: PROTOCOL/PORT
+	ports map[string]bool
+
+	// run executes a command. for mocks
+	run func(name string, args ...string) error
+}
+
+// New creates a network manager. The host is not changed until the first job is attached.
+func New(cfg Config) (*Manager, error) {
+	if cfg.Bridge == "" {
+		cfg.Bridge = defaultBridge
+	}
+	if cfg.Subnet == "" {
+		cfg.Subnet = defaultSubnet
+	}
+
+	if len(cfg.Bridge) > 15 {
+		return nil, fmt.Errorf("bridge name is too long: %q", cfg.Bridge)
+	}
+
+	_, subnet, err := net.ParseCIDR(cfg.Subnet)
+	if err != nil {
+		return nil, err
+	}
+
+	ones, bits := subnet.Mask.Size()
+	if bits != 32 || ones > 30 {
+		return nil, fmt.Errorf("subnet must be IPv4, /30 or larger: %q", cfg.Subnet)
+	}
+
+	return &Manager{
+		bridge:  cfg.Bridge,
+		nat:     cfg.NAT,
+		subnet:  subnet,
+		gateway: hostIP(subnet, 1),
+		addrs:   map[uint32]bool{1: true},
+		ports:   make(map[string]bool),
+		run:     runCommand,
+	}, nil
+}
+
+// Endpoint creates a job network endpoint with published ports and egress policy.
+func (m *Manager) Endpoint(ports []Port, egress EgressPolicy) (*Endpoint, error) {
+	seen := make(map[string]bool)
+	for _, p := range ports {
+		if err := p.Validate(); err != nil {
+			return nil, err
+		}
+		k := portKey(p)
+		if seen[k] {
+			return nil, fmt.Errorf("%w: duplicate host port %d/%s", ErrInvalidPort, p.Host, p.Protocol)
+		}
+		seen[k] = true
+	}
+
+	return &Endpoint{m: m, ports: ports, egress: egress}, nil
+}
+
+// setup creates the bridge, and enables NAT if configured.
+func (m *Manager) setup() error {
+	// supposed to be called under m.lock
+	if m.ready {
+		return nil
+	}
+
+	ones, _ := m.subnet.Mask.Size()
+	gw := fmt.Sprintf("%s/%d", m.gateway, ones)
+
+	if err := m.run("ip", "link", "show", m.bridge); err != nil {
+		if err := m.run("ip", "link", "add", "name", m.bridge, "type", "bridge"); err != nil {
+			return err
+		}
+	}
+
+	for _, args := range [][]string{
+		{"addr", "replace", gw, "dev", m.bridge},
+		{"link", "set", m.bridge, "up"},
+	} {
+		if err := m.run("ip", args...); err != nil {
+			return err
+		}
+	}
+
+	rules := [][]string{
+		{"FORWARD", "-i", m.bridge, "-j", "ACCEPT"},
+		{"FORWARD", "-o", m.bridge, "-j", "ACCEPT"},
+	}
+
+	if m.nat {
+		if err := os.WriteFile("/proc/sys/net/ipv4/ip_forward", []byte("1"), 0644); err != nil {
+			return fmt.Errorf("failed to enable forwarding: %w", err)
+		}
+		rules = append(rules,
+			[]string{"-t", "nat", "POSTROUTING", "-s", m.subnet.String(), "!", "-o", m.bridge, "-j", "MASQUERADE"})
+	}
+
+	for _, r := range rules {
+		if err := m.ensureRule(r); err != nil {
+			return err
+		}
+	}
+
+	m.ready = true
+	return nil
+}
+
+// ensureRule appends an iptables rule, unless it exists. The chain name follows the optional table.
+func (m *Manager) ensureRule(rule []string) error {
+	if err := m.run("iptables", ruleArgs("-C", rule)...); err == nil {
+		return nil
+	}
+	return m.run("iptables", ruleArgs("-A", rule)...)
+}
+
+// allocate reserves a free address and the ports, returning the host index of the address.
+func (m *Manager) allocate(ports []Port) (uint32, error) {
+	// supposed to be called under m.lock
+	for _, p := range ports {
+		if m.ports[portKey(p)] {
+			return 0, fmt.Errorf("%w: %d/%s", ErrPortInUse, p.Host, p.Protocol)
+		}
+	}
+
+	ones, bits := m.subnet.Mask.Size()
+	size := uint32(1) << (bits - ones)
+
+	// skip the network and broadcast addresses
+	for i := uint32(1); i < size-1; i++ {
+		if m.addrs[i] {
+			continue
+		}
+		m.addrs[i] = true
+		for _, p := range ports {
+			m.ports[portKey(p)] = true
+		}
+		return i, nil
+	}
+
+	return 0, ErrNoAddress
+}
+
+// release frees the address and the ports.
+func (m *Manager) release(idx uint32, ports []Port) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	delete(m.addrs, idx)
+	for _, p := range ports {
+		delete(m.ports, portKey(p))
+	}
+}
+
+// Endpoint is the network of a single job. Implements job.Network.
+type Endpoint struct {
+	m      *Manager
+	ports  []Port
+	egress EgressPolicy
+
+	lock sync.Mutex
+	// host index of the job address, 0 if not attached
+	idx  uint32
+	addr net.IP
+	// host side veth name
+	veth string
+	// iptables rules added for the job
+	rules [][]string
+}
+
+// Attach connects the network namespace of process pid to the bridge, and publishes the ports.
+func (e *Endpoint) Attach(pid int) (reterr error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if e.idx != 0 {
+		return fmt.Errorf("already attached")
+	}
+
+	m := e.m
+	m.lock.Lock()
+	if err := m.setup(); err != nil {
+		m.lock.Unlock()
+		return fmt.Errorf("failed to setup bridge: %w", err)
+	}
+	idx, err := m.allocate(e.ports)
+	m.lock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	e.idx = idx
+	e.addr = hostIP(m.subnet, idx)
+	e.veth = "vjob" + strconv.FormatUint(uint64(idx), 10)
+
+	defer func() {
+		if reterr != nil {
+			e.detach()
+		}
+	}()
+
+	ones, _ := m.subnet.Mask.Size()
+	ns := []string{"-t", strconv.Itoa(pid), "-n", "ip"}
+
+	for _, c := range [][]string{
+		{"ip", "link", "add", e.veth, "type", "veth", "peer", "name", jobIface, "netns", strconv.Itoa(pid)},
+		{"ip", "link", "set", e.veth, "master", m.bridge, "up"},
+		append(append([]string{"nsenter"}, ns...), "addr", "add", fmt.Sprintf("%s/%d", e.addr, ones), "dev", jobIface),
+		append(append([]string{"nsenter"}, ns...), "link", "set", jobIface, "up"),
+		append(append([]string{"nsenter"}, ns...), "route", "add", "default", "via", m.gateway.String()),
+	} {
+		if err := m.run(c[0], c[1:]...); err != nil {
+			return err
+		}
+	}
+
+	// the job can't change the rules without CAP_NET_ADMIN. Callers must not grant it to jobs with a policy
+	if !e.egress.Empty() {
+		if err := m.run("nsenter", "-t", strconv.Itoa(pid), "-n", "nft", e.egress.nft()); err != nil {
+			return fmt.Errorf("failed to apply egress policy: %w", err)
+		}
+	}
+
+	for _, p := range e.ports {
+		to := fmt.Sprintf("%s:%d", e.addr, p.Job)
+		port := strconv.Itoa(int(p.Host))
+		for _, r := range [][]string{
+			// traffic from outside
+			{"-t", "nat", "PREROUTING", "-p", p.Protocol, "--dport", port, "-j", "DNAT", "--to-destination", to},
+			// traffic from the host itself
+			{"-t", "nat", "OUTPUT", "-p", p.Protocol, "-m", "addrtype", "--dst-type", "LOCAL",
+				"--dport", port, "-j", "DNAT", "--to-destination", to},
+		} {
+			if err := m.run("iptables", ruleArgs("-A", r)...); err != nil {
+				return err
+			}
+			e.rules = append(e.rules, r)
+		}
+	}
+
+	return nil
+}
+
+// Detach removes the port rules and the veth pair, and releases the address and the ports.
+func (e *Endpoint) Detach() error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	return e.detach()
+}
+
+// detach does all the Detach() work.
+func (e *Endpoint) detach() error {
+	// supposed to be called under e.lock
+	if e.idx == 0 {
+		return nil
+	}
+
+	var rt error
+	for _, r := range e.rules {
+		if err := e.m.run("iptables", ruleArgs("-D", r)...); err != nil {
+			rt = err
+		}
+	}
+	e.rules = nil
+
+	// the veth pair is gone with the job network namespace, but the job may still run
+	_ = e.m.run("ip", "link", "del", e.veth)
+
+	e.m.release(e.idx, e.ports)
+	e.idx = 0
+
+	return rt
+}
+
+// Address returns the job IP address, if attached.
+func (e *Endpoint) Address() string {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if e.idx == 0 {
+		return ""
+	}
+	return e.addr.String()
+}
+
+// Egress returns the job egress policy rules.
+func (e *Endpoint) Egress() []string {
+	return e.egress.Describe()
+}
+
+// hostIP returns the address with host index idx in subnet.
+func hostIP(subnet *net.IPNet, idx uint32) net.IP {
+	rt := make(net.IP, 4)
+	binary.BigEndian.PutUint32(rt, binary.BigEndian.Uint32(subnet.IP.To4())+idx)
+	return rt
+}
+
+// portKey is the key of a published host port.
+func portKey(p Port) string {
+	return p.Protocol + "/" + strconv.Itoa(int(p.Host))
+}
+
+// ruleArgs builds iptables arguments to apply action to rule: [-t TABLE] CHAIN SPEC...
+func ruleArgs(action string, rule []string) []string {
+	var rt []string
+	if len(rule) > 2 && rule[0] == "-t" {
+		rt = append(rt, rule[:2]...)
+		rule = rule[2:]
+	}
+	rt = append(rt, action)
+	return append(rt, rule...)
+}
+
+// runCommand runs a command, returning its output as a part of the error.
+func runCommand(name string, args ...string) error {
+	out, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s %s: %w: %s", name, strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
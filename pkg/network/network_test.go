@@ -0,0 +1,122 @@
+package network
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRun makes m record the commands instead of running them. Commands starting with
+// one of failing prefixes fail.
+func fakeRun(m *Manager, failing ...string) *[]string {
+	var cmds []string
+	m.run = func(name string, args ...string) error {
+		c := strings.Join(append([]string{name}, args...), " ")
+		cmds = append(cmds, c)
+		for _, f := range failing {
+			if strings.HasPrefix(c, f) {
+				return errors.New("failed")
+			}
+		}
+		return nil
+	}
+	return &cmds
+}
+
+func TestAttach(t *testing.T) {
+	m, err := New(Config{Subnet: "10.1.2.0/24"})
+	assert.NoError(t, err)
+
+	cmds := fakeRun(m)
+
+	e, err := m.Endpoint([]Port{{Host: 8080, Job: 80, Protocol: "tcp"}}, EgressPolicy{})
+	assert.NoError(t, err)
+
+	assert.NoError(t, e.Attach(42))
+	assert.Equal(t, "10.1.2.2", e.Address())
+	assert.Equal(t, []string{
+		"ip link show jobs0",
+		"ip addr replace 10.1.2.1/24 dev jobs0",
+		"ip link set jobs0 up",
+		"iptables -C FORWARD -i jobs0 -j ACCEPT",
+		"iptables -C FORWARD -o jobs0 -j ACCEPT",
+		"ip link add vjob2 type veth peer name eth0 netns 42",
+		"ip link set vjob2 master jobs0 up",
+		"nsenter -t 42 -n ip addr add 10.1.2.2/24 dev eth0",
+		"nsenter -t 42 -n ip link set eth0 up",
+		"nsenter -t 42 -n ip route add default via 10.1.2.1",
+		"iptables -t nat -A PREROUTING -p tcp --dport 8080 -j DNAT --to-destination 10.1.2.2:80",
+		"iptables -t nat -A OUTPUT -p tcp -m addrtype --dst-type LOCAL --dport 8080 -j DNAT --to-destination 10.1.2.2:80",
+	}, *cmds)
+
+	// the bridge is configured once, and the port is taken
+	*cmds = nil
+	e2, err := m.Endpoint([]Port{{Host: 8080, Job: 80, Protocol: "tcp"}}, EgressPolicy{})
+	assert.NoError(t, err)
+	assert.ErrorIs(t, e2.Attach(43), ErrPortInUse)
+	assert.Empty(t, *cmds)
+
+	e2, err = m.Endpoint([]Port{{Host: 8080, Job: 80, Protocol: "udp"}}, EgressPolicy{})
+	assert.NoError(t, err)
+	assert.NoError(t, e2.Attach(43))
+	assert.Equal(t, "10.1.2.3", e2.Address())
+
+	*cmds = nil
+	assert.NoError(t, e.Detach())
+	assert.Equal(t, "", e.Address())
+	assert.Equal(t, []string{
+		"iptables -t nat -D PREROUTING -p tcp --dport 8080 -j DNAT --to-destination 10.1.2.2:80",
+		"iptables -t nat -D OUTPUT -p tcp -m addrtype --dst-type LOCAL --dport 8080 -j DNAT --to-destination 10.1.2.2:80",
+		"ip link del vjob2",
+	}, *cmds)
+
+	// the address and the port are free again
+	e, err = m.Endpoint([]Port{{Host: 8080, Job: 81, Protocol: "tcp"}}, EgressPolicy{})
+	assert.NoError(t, err)
+	assert.NoError(t, e.Attach(44))
+	assert.Equal(t, "10.1.2.2", e.Address())
+}
+
+func TestAttachFailure(t *testing.T) {
+	m, err := New(Config{Subnet: "10.1.2.0/30"})
+	assert.NoError(t, err)
+
+	cmds := fakeRun(m, "nsenter")
+
+	e, err := m.Endpoint(nil, EgressPolicy{})
+	assert.NoError(t, err)
+	assert.Error(t, e.Attach(42))
+	assert.Equal(t, "", e.Address())
+	assert.Equal(t, "ip link del vjob2", (*cmds)[len(*cmds)-1])
+
+	// /30 has a single job address
+	fakeRun(m)
+	assert.NoError(t, e.Attach(42))
+	e2, _ := m.Endpoint(nil, EgressPolicy{})
+	assert.ErrorIs(t, e2.Attach(43), ErrNoAddress)
+}
+
+func TestInvalidConfig(t *testing.T) {
+	for _, cfg := range []Config{
+		{Subnet: "10.0.0.0/31"},
+		{Subnet: "fd00::/64"},
+		{Subnet: "bad"},
+		{Bridge: "a-very-long-bridge-name"},
+	} {
+		_, err := New(cfg)
+		assert.Error(t, err, cfg)
+	}
+
+	m, err := New(Config{})
+	assert.NoError(t, err)
+	for _, ports := range [][]Port{
+		{{Host: 0, Job: 80, Protocol: "tcp"}},
+		{{Host: 80, Job: 80, Protocol: "sctp"}},
+		{{Host: 80, Job: 80, Protocol: "tcp"}, {Host: 80, Job: 81, Protocol: "tcp"}},
+	} {
+		_, err := m.Endpoint(ports, EgressPolicy{})
+		assert.ErrorIs(t, err, ErrInvalidPort)
+	}
+}
@@ -0,0 +1,228 @@
+//go:build linux
+
+package seccomp
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// seccomp return values, see linux/seccomp.h
+const (
+	retKillProcess = 0x80000000
+	retKillThread  = 0x00000000
+	retTrap        = 0x00030000
+	retErrno       = 0x00050000
+	retLog         = 0x7ffc0000
+	retAllow       = 0x7fff0000
+)
+
+// x32SyscallBit marks x32 ABI syscalls on x86_64. They're denied.
+const x32SyscallBit = 0x40000000
+
+// struct seccomp_data offsets
+const (
+	offNr   = 0
+	offArch = 4
+	offArgs = 16
+)
+
+// maxProgLen is the max number of BPF instructions.
+const maxProgLen = 4096
+
+// instr is an instruction of a rule block. Jumps may lead to the block end, i.e. to the next rule.
+type instr struct {
+	unix.SockFilter
+	jtNext bool
+	jfNext bool
+}
+
+func stmt(code uint16, k uint32) instr {
+	return instr{SockFilter: unix.SockFilter{Code: code, K: k}}
+}
+
+func jump(code uint16, k uint32, jt, jf uint8) instr {
+	return instr{SockFilter: unix.SockFilter{Code: code, K: k, Jt: jt, Jf: jf}}
+}
+
+// next sets the jumps to the block end.
+func (i instr) next(jt, jf bool) instr {
+	i.jtNext, i.jfNext = jt, jf
+	return i
+}
+
+// ret returns the seccomp return value of action a.
+func ret(a Action, errno *uint) (uint32, error) {
+	switch a {
+	case ActAllow:
+		return retAllow, nil
+	case ActErrno:
+		e := uint32(unix.EPERM)
+		if errno != nil {
+			e = uint32(*errno)
+		}
+		return retErrno | (e & 0xffff), nil
+	case ActKill, ActKillThread:
+		return retKillThread, nil
+	case ActKillProcess:
+		return retKillProcess, nil
+	case ActTrap:
+		return retTrap, nil
+	case ActLog:
+		return retLog, nil
+	default:
+		return 0, fmt.Errorf("%w: unsupported action %q", ErrInvalidProfile, a)
+	}
+}
+
+// Compile builds the BPF program of the profile for the native architecture.
+func (p *Profile) Compile() ([]unix.SockFilter, error) {
+	def, err := ret(p.DefaultAction, p.DefaultErrnoRet)
+	if err != nil {
+		return nil, err
+	}
+
+	prog := []unix.SockFilter{
+		{Code: unix.BPF_LD | unix.BPF_W | unix.BPF_ABS, K: offArch},
+		{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, K: nativeArch, Jt: 1},
+		{Code: unix.BPF_RET | unix.BPF_K, K: retKillProcess},
+		{Code: unix.BPF_LD | unix.BPF_W | unix.BPF_ABS, K: offNr},
+	}
+
+	if nativeArch == unix.AUDIT_ARCH_X86_64 {
+		prog = append(prog,
+			unix.SockFilter{Code: unix.BPF_JMP | unix.BPF_JGE | unix.BPF_K, K: x32SyscallBit, Jf: 1},
+			unix.SockFilter{Code: unix.BPF_RET | unix.BPF_K, K: retKillProcess})
+	}
+
+	for _, s := range p.Syscalls {
+		action, err := ret(s.Action, s.ErrnoRet)
+		if err != nil {
+			return nil, err
+		}
+
+		if action == def && len(s.Args) == 0 {
+			continue
+		}
+
+		for _, name := range s.Names {
+			nr, ok := syscalls[name]
+			if !ok {
+				continue
+			}
+
+			block, err := ruleBlock(uint32(nr), s.Args, action)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			prog = append(prog, block...)
+		}
+	}
+
+	prog = append(prog, unix.SockFilter{Code: unix.BPF_RET | unix.BPF_K, K: def})
+
+	if len(prog) > maxProgLen {
+		return nil, fmt.Errorf("%w: too many rules", ErrInvalidProfile)
+	}
+
+	return prog, nil
+}
+
+// ruleBlock builds the instructions returning action for syscall nr, if the args match.
+// Otherwise, the execution goes on to the instruction after the block.
+func ruleBlock(nr uint32, args []Arg, action uint32) ([]unix.SockFilter, error) {
+	block := []instr{
+		// arg checks overwrite the accumulator
+		stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, offNr),
+		jump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, nr, 0, 0).next(false, true),
+	}
+
+	for _, a := range args {
+		checks, err := argCheck(a)
+		if err != nil {
+			return nil, err
+		}
+		block = append(block, checks...)
+	}
+
+	block = append(block, stmt(unix.BPF_RET|unix.BPF_K, action))
+
+	if len(block) > 256 {
+		return nil, fmt.Errorf("%w: too many args", ErrInvalidProfile)
+	}
+
+	rt := make([]unix.SockFilter, len(block))
+	for i, in := range block {
+		// the distance to the block end
+		d := uint8(len(block) - i - 1)
+		if in.jtNext {
+			in.Jt = d
+		}
+		if in.jfNext {
+			in.Jf = d
+		}
+		rt[i] = in.SockFilter
+	}
+
+	return rt, nil
+}
+
+// argCheck builds the instructions comparing a 64-bit syscall argument. Goes to the next
+// instruction on match, to the block end otherwise.
+func argCheck(a Arg) ([]instr, error) {
+	if a.Index > 5 {
+		return nil, fmt.Errorf("%w: invalid arg index %d", ErrInvalidProfile, a.Index)
+	}
+
+	// little endian
+	lo := uint32(offArgs + 8*a.Index)
+	hi := lo + 4
+	ld := func(off uint32) instr { return stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, off) }
+	j := func(op uint16, k uint32, jt, jf uint8) instr { return jump(unix.BPF_JMP|op|unix.BPF_K, k, jt, jf) }
+
+	vlo, vhi := uint32(a.Value), uint32(a.Value>>32)
+
+	switch a.Op {
+	case OpEqual:
+		return []instr{
+			ld(lo), j(unix.BPF_JEQ, vlo, 0, 0).next(false, true),
+			ld(hi), j(unix.BPF_JEQ, vhi, 0, 0).next(false, true),
+		}, nil
+	case OpNotEqual:
+		return []instr{
+			ld(lo), j(unix.BPF_JEQ, vlo, 0, 2),
+			ld(hi), j(unix.BPF_JEQ, vhi, 0, 0).next(true, false),
+		}, nil
+	case OpMaskedEqual:
+		and := func(k uint32) instr { return stmt(unix.BPF_ALU|unix.BPF_AND|unix.BPF_K, k) }
+		mlo, mhi := vlo, vhi
+		vlo, vhi = uint32(a.ValueTwo), uint32(a.ValueTwo>>32)
+		return []instr{
+			ld(lo), and(mlo), j(unix.BPF_JEQ, vlo, 0, 0).next(false, true),
+			ld(hi), and(mhi), j(unix.BPF_JEQ, vhi, 0, 0).next(false, true),
+		}, nil
+	case OpGreater, OpGreaterEqual:
+		loOp := uint16(unix.BPF_JGT)
+		if a.Op == OpGreaterEqual {
+			loOp = unix.BPF_JGE
+		}
+		return []instr{
+			// high word greater: match. equal: compare the low word. less: no match
+			ld(hi), j(unix.BPF_JGT, vhi, 3, 0), j(unix.BPF_JEQ, vhi, 0, 0).next(false, true),
+			ld(lo), j(loOp, vlo, 0, 0).next(false, true),
+		}, nil
+	case OpLess, OpLessEqual:
+		loOp := uint16(unix.BPF_JGE)
+		if a.Op == OpLessEqual {
+			loOp = unix.BPF_JGT
+		}
+		return []instr{
+			// high word less: match. equal: compare the low word. greater: no match
+			ld(hi), j(unix.BPF_JGE, vhi, 0, 3), j(unix.BPF_JEQ, vhi, 0, 0).next(false, true),
+			ld(lo), j(loOp, vlo, 0, 0).next(true, false),
+		}, nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported operator %q", ErrInvalidProfile, a.Op)
+	}
+}
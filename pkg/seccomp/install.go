@@ -0,0 +1,47 @@
+//go:build linux
+
+package seccomp
+
+import (
+	"fmt"
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// seccomp(2) operation and flags, see linux/seccomp.h
+const (
+	setModeFilter   = 1
+	filterFlagTsync = 1
+)
+
+// Install sets no_new_privs, and applies the profile to all threads of the current process.
+// The filter is inherited by the child processes.
+func Install(p *Profile) error {
+	filter, err := p.Compile()
+	if err != nil {
+		return err
+	}
+
+	// no_new_privs is per-thread, make sure seccomp is called from the same one
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("failed to set no_new_privs: %w", err)
+	}
+
+	prog := unix.SockFprog{
+		Len:    uint16(len(filter)),
+		Filter: &filter[0],
+	}
+
+	// TSYNC propagates the filter and no_new_privs to all the threads
+	_, _, errno := unix.Syscall(unix.SYS_SECCOMP, setModeFilter, filterFlagTsync, uintptr(unsafe.Pointer(&prog)))
+	if errno != 0 {
+		return fmt.Errorf("failed to install seccomp filter: %w", errno)
+	}
+
+	return nil
+}
@@ -0,0 +1,100 @@
+//go:build ignore
+
+// mksyscalls generates syscall name tables from golang.org/x/sys/unix zsysnum files.
+//
+//	go run mksyscalls.go
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/format"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// arches maps GOARCH to the audit arch constant of x/sys/unix.
+var arches = map[string]string{
+	"amd64": "AUDIT_ARCH_X86_64",
+	"arm64": "AUDIT_ARCH_AARCH64",
+}
+
+// aliases are the kernel names of syscalls, named differently in x/sys.
+var aliases = map[string]map[string]string{
+	"arm64": {"fstatat": "newfstatat"},
+}
+
+var sysRe = regexp.MustCompile(`^\s+SYS_(\w+)\s+=\s+(\d+)$`)
+
+func main() {
+	out, err := exec.Command("go", "list", "-m", "-f", "{{.Dir}}", "golang.org/x/sys").Output()
+	if err != nil {
+		fail(err)
+	}
+	dir := filepath.Join(strings.TrimSpace(string(out)), "unix")
+
+	for arch, auditArch := range arches {
+		if err := generate(dir, arch, auditArch); err != nil {
+			fail(err)
+		}
+	}
+}
+
+func generate(dir, arch, auditArch string) error {
+	f, err := os.Open(filepath.Join(dir, "zsysnum_linux_"+arch+".go"))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	nums := make(map[string]string)
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		m := sysRe.FindStringSubmatch(s.Text())
+		if m == nil {
+			continue
+		}
+		name := strings.ToLower(m[1])
+		if a, ok := aliases[arch][name]; ok {
+			name = a
+		}
+		nums[name] = m[2]
+	}
+	if err := s.Err(); err != nil {
+		return err
+	}
+
+	var names []string
+	for n := range nums {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by mksyscalls.go; DO NOT EDIT.\n\n")
+	fmt.Fprintf(&b, "//go:build linux && %s\n\n", arch)
+	fmt.Fprintf(&b, "package seccomp\n\nimport \"golang.org/x/sys/unix\"\n\n")
+	fmt.Fprintf(&b, "// nativeArch is the audit arch of the syscalls.\nconst nativeArch = unix.%s\n\n", auditArch)
+	fmt.Fprintf(&b, "// syscalls maps syscall names to numbers.\nvar syscalls = map[string]int{\n")
+	for _, n := range names {
+		fmt.Fprintf(&b, "\t%q: %s,\n", n, nums[n])
+	}
+	fmt.Fprintf(&b, "}\n")
+
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile("zsyscalls_linux_"+arch+".go", src, 0644)
+}
+
+func fail(err error) {
+	_, _ = fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
@@ -0,0 +1,135 @@
+//go:build linux
+
+//go:generate go run mksyscalls.go
+
+// Package seccomp compiles OCI-style seccomp profiles to BPF, and installs them.
+package seccomp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ErrInvalidProfile means the profile is malformed, or uses unsupported features.
+var ErrInvalidProfile = errors.New("invalid seccomp profile")
+
+// DefaultProfile is the name of the built-in profile.
+const DefaultProfile = "default"
+
+// Action is a seccomp action, e.g. SCMP_ACT_ALLOW.
+type Action string
+
+const (
+	ActAllow       = Action("SCMP_ACT_ALLOW")
+	ActErrno       = Action("SCMP_ACT_ERRNO")
+	ActKill        = Action("SCMP_ACT_KILL")
+	ActKillThread  = Action("SCMP_ACT_KILL_THREAD")
+	ActKillProcess = Action("SCMP_ACT_KILL_PROCESS")
+	ActTrap        = Action("SCMP_ACT_TRAP")
+	ActLog         = Action("SCMP_ACT_LOG")
+)
+
+// Operator compares a syscall argument, e.g. SCMP_CMP_EQ.
+type Operator string
+
+const (
+	OpEqual        = Operator("SCMP_CMP_EQ")
+	OpNotEqual     = Operator("SCMP_CMP_NE")
+	OpLess         = Operator("SCMP_CMP_LT")
+	OpLessEqual    = Operator("SCMP_CMP_LE")
+	OpGreater      = Operator("SCMP_CMP_GT")
+	OpGreaterEqual = Operator("SCMP_CMP_GE")
+	OpMaskedEqual  = Operator("SCMP_CMP_MASKED_EQ")
+)
+
+// Profile is a seccomp profile in OCI runtime spec format. Only the native architecture is
+// supported, the architectures list is ignored.
+type Profile struct {
+	// DefaultAction applies to the syscalls not matching any rule
+	DefaultAction Action `json:"defaultAction"`
+	// DefaultErrnoRet is the errno of the default SCMP_ACT_ERRNO action. EPERM if not set
+	DefaultErrnoRet *uint `json:"defaultErrnoRet,omitempty"`
+	// Architectures are ignored
+	Architectures []string `json:"architectures,omitempty"`
+	// Syscalls are the rules, the first matching one applies
+	Syscalls []Syscall `json:"syscalls,omitempty"`
+}
+
+// Syscall is a profile rule.
+type Syscall struct {
+	// Names are the syscall names. Names unknown on the architecture are ignored
+	Names []string `json:"names"`
+	// Action applies to the matching syscalls
+	Action Action `json:"action"`
+	// ErrnoRet is the errno of SCMP_ACT_ERRNO action. EPERM if not set
+	ErrnoRet *uint `json:"errnoRet,omitempty"`
+	// Args are the conditions on syscall arguments, all must match
+	Args []Arg `json:"args,omitempty"`
+}
+
+// Arg is a condition on a syscall argument.
+type Arg struct {
+	// Index is the argument index, 0-5
+	Index uint `json:"index"`
+	// Value is compared with the argument. The mask for SCMP_CMP_MASKED_EQ
+	Value uint64 `json:"value"`
+	// ValueTwo is the value for SCMP_CMP_MASKED_EQ
+	ValueTwo uint64 `json:"valueTwo,omitempty"`
+	// Op is the comparison operator
+	Op Operator `json:"op"`
+}
+
+// Load reads a profile from a JSON file, and makes sure it compiles.
+func Load(path string) (*Profile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rt Profile
+	if err := json.Unmarshal(data, &rt); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidProfile, err)
+	}
+
+	if _, err := rt.Compile(); err != nil {
+		return nil, err
+	}
+
+	return &rt, nil
+}
+
+// LoadNamed returns the built-in profile if name is DefaultProfile, or loads the profile from file name.
+func LoadNamed(name string) (*Profile, error) {
+	if name == DefaultProfile {
+		return Default(), nil
+	}
+	return Load(name)
+}
+
+// defaultDenied are the syscalls denied by the default profile: the ones changing the system
+// state, escaping the namespaces, or exposing the kernel attack surface.
+var defaultDenied = []string{
+	"acct", "add_key", "bpf", "clock_adjtime", "clock_settime", "create_module", "delete_module",
+	"finit_module", "fsconfig", "fsmount", "fsopen", "fspick", "get_kernel_syms", "get_mempolicy",
+	"init_module", "ioperm", "iopl", "kcmp", "kexec_file_load", "kexec_load", "keyctl",
+	"lookup_dcookie", "mbind", "mount", "mount_setattr", "move_mount", "move_pages",
+	"name_to_handle_at", "nfsservctl", "open_by_handle_at", "open_tree", "perf_event_open",
+	"pivot_root", "process_vm_readv", "process_vm_writev", "ptrace", "query_module", "quotactl",
+	"reboot", "request_key", "set_mempolicy", "setns", "settimeofday", "stime", "swapoff",
+	"swapon", "sysfs", "syslog", "_sysctl", "umount", "umount2", "unshare", "uselib",
+	"userfaultfd", "ustat", "vhangup", "vm86", "vm86old",
+}
+
+// Default returns the built-in profile: everything is allowed except for the dangerous syscalls,
+// which fail with EPERM.
+func Default() *Profile {
+	return &Profile{
+		DefaultAction: ActAllow,
+		Syscalls: []Syscall{{
+			Names:  defaultDenied,
+			Action: ActErrno,
+		}},
+	}
+}
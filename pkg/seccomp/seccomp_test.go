@@ -0,0 +1,166 @@
+//go:build linux
+
+package seccomp
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+// eval runs the program against struct seccomp_data. Supports the instructions Compile emits only
+func eval(t *testing.T, prog []unix.SockFilter, arch uint32, nr int, args ...uint64) uint32 {
+	data := make([]byte, 64)
+	binary.LittleEndian.PutUint32(data[offNr:], uint32(nr))
+	binary.LittleEndian.PutUint32(data[offArch:], arch)
+	for i, a := range args {
+		binary.LittleEndian.PutUint64(data[offArgs+8*i:], a)
+	}
+
+	var acc uint32
+	for pc := 0; pc < len(prog); pc++ {
+		in := prog[pc]
+		switch in.Code {
+		case unix.BPF_LD | unix.BPF_W | unix.BPF_ABS:
+			acc = binary.LittleEndian.Uint32(data[in.K:])
+		case unix.BPF_ALU | unix.BPF_AND | unix.BPF_K:
+			acc &= in.K
+		case unix.BPF_RET | unix.BPF_K:
+			return in.K
+		case unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, unix.BPF_JMP | unix.BPF_JGT | unix.BPF_K, unix.BPF_JMP | unix.BPF_JGE | unix.BPF_K:
+			var ok bool
+			switch in.Code & 0xf0 {
+			case unix.BPF_JEQ:
+				ok = acc == in.K
+			case unix.BPF_JGT:
+				ok = acc > in.K
+			case unix.BPF_JGE:
+				ok = acc >= in.K
+			}
+			if ok {
+				pc += int(in.Jt)
+			} else {
+				pc += int(in.Jf)
+			}
+		default:
+			t.Fatalf("unexpected instruction %#v", in)
+		}
+	}
+
+	t.Fatal("no return")
+	return 0
+}
+
+func TestDefault(t *testing.T) {
+	prog, err := Default().Compile()
+	assert.NoError(t, err)
+
+	assert.Equal(t, uint32(retErrno|uint32(unix.EPERM)), eval(t, prog, nativeArch, syscalls["mount"]))
+	assert.Equal(t, uint32(retErrno|uint32(unix.EPERM)), eval(t, prog, nativeArch, syscalls["ptrace"]))
+	assert.Equal(t, uint32(retAllow), eval(t, prog, nativeArch, syscalls["read"]))
+	assert.Equal(t, uint32(retKillProcess), eval(t, prog, nativeArch^1, syscalls["read"]))
+}
+
+func TestArgs(t *testing.T) {
+	errno := uint(unix.EACCES)
+	p := Profile{DefaultAction: ActAllow}
+
+	for _, tc := range []struct {
+		arg     Arg
+		val     uint64
+		matches bool
+	}{
+		{Arg{Op: OpEqual, Value: 1 << 33}, 1 << 33, true},
+		{Arg{Op: OpEqual, Value: 1 << 33}, 1, false},
+		{Arg{Op: OpNotEqual, Value: 5}, 5, false},
+		{Arg{Op: OpNotEqual, Value: 5}, 5 | 1<<32, true},
+		{Arg{Op: OpMaskedEqual, Value: 0xff00, ValueTwo: 0x1200}, 0x1234, true},
+		{Arg{Op: OpMaskedEqual, Value: 0xff00, ValueTwo: 0x1200}, 0x2234, false},
+		{Arg{Op: OpGreater, Value: 1 << 32}, 1<<32 + 1, true},
+		{Arg{Op: OpGreater, Value: 1 << 32}, 1 << 32, false},
+		{Arg{Op: OpGreater, Value: 10}, 1 << 32, true},
+		{Arg{Op: OpGreaterEqual, Value: 10}, 10, true},
+		{Arg{Op: OpGreaterEqual, Value: 10}, 9, false},
+		{Arg{Op: OpLess, Value: 1 << 32}, 5, true},
+		{Arg{Op: OpLess, Value: 5}, 5, false},
+		{Arg{Op: OpLess, Value: 5}, 1<<32 + 1, false},
+		{Arg{Op: OpLessEqual, Value: 5}, 5, true},
+		{Arg{Op: OpLessEqual, Value: 5}, 6, false},
+	} {
+		tc.arg.Index = 1
+		p.Syscalls = []Syscall{{Names: []string{"socket"}, Action: ActErrno, ErrnoRet: &errno, Args: []Arg{tc.arg}}}
+		prog, err := p.Compile()
+		assert.NoError(t, err)
+
+		exp := uint32(retAllow)
+		if tc.matches {
+			exp = retErrno | uint32(errno)
+		}
+		assert.Equal(t, exp, eval(t, prog, nativeArch, syscalls["socket"], 0, tc.val), "%v %d", tc.arg, tc.val)
+		assert.Equal(t, uint32(retAllow), eval(t, prog, nativeArch, syscalls["read"], 0, tc.val))
+	}
+}
+
+func TestAllowList(t *testing.T) {
+	p := Profile{
+		DefaultAction: ActKillProcess,
+		Syscalls: []Syscall{
+			{Names: []string{"read", "write", "no_such_syscall"}, Action: ActAllow},
+			{Names: []string{"kill"}, Action: ActLog},
+		},
+	}
+
+	prog, err := p.Compile()
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(retAllow), eval(t, prog, nativeArch, syscalls["write"]))
+	assert.Equal(t, uint32(retLog), eval(t, prog, nativeArch, syscalls["kill"]))
+	assert.Equal(t, uint32(retKillProcess), eval(t, prog, nativeArch, syscalls["mount"]))
+}
+
+func TestInvalidProfile(t *testing.T) {
+	for _, p := range []Profile{
+		{DefaultAction: "SCMP_ACT_TRACE"},
+		{DefaultAction: ActAllow, Syscalls: []Syscall{{Names: []string{"read"}, Action: "allow"}}},
+		{DefaultAction: ActAllow, Syscalls: []Syscall{{Names: []string{"read"}, Action: ActErrno, Args: []Arg{{Index: 6, Op: OpEqual}}}}},
+		{DefaultAction: ActAllow, Syscalls: []Syscall{{Names: []string{"read"}, Action: ActErrno, Args: []Arg{{Op: "SCMP_CMP_XX"}}}}},
+	} {
+		_, err := p.Compile()
+		assert.ErrorIs(t, err, ErrInvalidProfile)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "profile.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`{
+		"defaultAction": "SCMP_ACT_ERRNO",
+		"defaultErrnoRet": 38,
+		"architectures": ["SCMP_ARCH_X86_64", "SCMP_ARCH_AARCH64"],
+		"syscalls": [
+			{"names": ["read", "write"], "action": "SCMP_ACT_ALLOW"},
+			{"names": ["personality"], "action": "SCMP_ACT_ALLOW", "args": [{"index": 0, "value": 8, "op": "SCMP_CMP_EQ"}]}
+		]
+	}`), 0600))
+
+	p, err := Load(path)
+	assert.NoError(t, err)
+
+	prog, err := p.Compile()
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(retErrno|38), eval(t, prog, nativeArch, syscalls["mount"]))
+	assert.Equal(t, uint32(retAllow), eval(t, prog, nativeArch, syscalls["personality"], 8))
+	assert.Equal(t, uint32(retErrno|38), eval(t, prog, nativeArch, syscalls["personality"], 9))
+
+	invalid := filepath.Join(dir, "invalid.json")
+	assert.NoError(t, os.WriteFile(invalid, []byte(`{"defaultAction": `), 0600))
+	_, err = Load(invalid)
+	assert.ErrorIs(t, err, ErrInvalidProfile)
+
+	_, err = Load(filepath.Join(dir, "none.json"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ilyazz/jobs/pkg/acl"
+	pb "github.com/ilyazz/jobs/pkg/api/grpc/jobs/v1"
+	"github.com/ilyazz/jobs/pkg/job"
+	"github.com/ilyazz/jobs/pkg/supervisor"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxArrayTasks is the max number of tasks of an array job
+const maxArrayTasks = 10000
+
+// startArray starts array job req on behalf of user cid. The task job is checked as a single job is,
+// and the tasks that may run at the same time must fit the client quota. Returns gRPC errors
+func (j *JobServer) startArray(cid string, req *pb.StartRequest) (job.ID, error) {
+	arr, err := toArray(req.Array)
+	if err != nil {
+		return "", status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	spec, err := j.toSpec(cid, req)
+	if err != nil {
+		return "", err
+	}
+	if spec.Network == job.NetBridge {
+		return "", status.Error(codes.InvalidArgument, "array jobs don't support bridge network mode")
+	}
+
+	release := j.quotas.acquire(cid)
+	defer release()
+
+	running := len(arr.Indexes)
+	if arr.Parallelism > 0 && arr.Parallelism < running {
+		running = arr.Parallelism
+	}
+	usage := j.jobs.Usage(cid)
+	if err := j.quotas.check(cid, usage, spec, running); err != nil {
+		return "", status.Error(codes.ResourceExhausted, err.Error())
+	}
+	if err := j.makeRoom(cid, usage); err != nil {
+		return "", status.Error(codes.ResourceExhausted, err.Error())
+	}
+	spec.Owner = cid
+
+	if err := j.connect(cid, &spec, req); err != nil {
+		return "", err
+	}
+
+	id, tasks, err := j.jobs.StartArray(spec, arr)
+	switch {
+	case errors.Is(err, supervisor.ErrInvalidArray):
+		return "", status.Error(codes.InvalidArgument, err.Error())
+	case err != nil:
+		return "", status.Error(codes.Internal, err.Error())
+	}
+
+	_ = j.auth.SetOwner(acl.ObjectID(id), acl.UserID(cid))
+	for _, t := range tasks {
+		_ = j.auth.SetOwner(acl.ObjectID(t), acl.UserID(cid))
+	}
+	return id, nil
+}
+
+// toArray converts the array job tasks from PB to internal format
+func toArray(a *pb.ArrayRequest) (supervisor.Array, error) {
+	set := 0
+	for _, ok := range []bool{a.Count != 0, len(a.Indexes) > 0, len(a.Items) > 0} {
+		if ok {
+			set++
+		}
+	}
+	if set != 1 {
+		return supervisor.Array{}, fmt.Errorf("array job requires one of task count, indexes or items")
+	}
+
+	rt := supervisor.Array{Items: a.Items, Parallelism: int(a.Parallelism)}
+	n := int(a.Count)
+	if len(a.Items) > 0 {
+		n = len(a.Items)
+	}
+	switch {
+	case n < 0:
+		return rt, fmt.Errorf("negative task count")
+	case n > maxArrayTasks, len(a.Indexes) > maxArrayTasks:
+		return rt, fmt.Errorf("array job exceeds %d tasks", maxArrayTasks)
+	}
+
+	for _, i := range a.Indexes {
+		rt.Indexes = append(rt.Indexes, int(i))
+	}
+	for i := 0; i < n; i++ {
+		rt.Indexes = append(rt.Indexes, i)
+	}
+	return rt, nil
+}
+
+// fromArraySummary converts the array job task states from internal format to PB
+func fromArraySummary(s *job.ArraySummary) *pb.ArraySummary {
+	if s == nil {
+		return nil
+	}
+
+	rt := &pb.ArraySummary{
+		Total:     int32(s.Total),
+		Waiting:   int32(s.Waiting),
+		Active:    int32(s.Active),
+		Succeeded: int32(s.Succeeded),
+		Failed:    int32(s.Failed),
+		Cancelled: int32(s.Cancelled),
+	}
+	for _, t := range s.Tasks {
+		rt.Tasks = append(rt.Tasks, &pb.ArrayTask{
+			Index:    int32(t.Index),
+			Item:     t.Item,
+			JobId:    string(t.JobID),
+			Status:   fromJobStatus(t.Status),
+			ExitCode: int32(t.ExitCode),
+		})
+	}
+	return rt
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/ilyazz/jobs/pkg/job"
+)
+
+// capabilityPolicy defines the capabilities jobs may keep, and who may request them.
+type capabilityPolicy struct {
+	// users are the users allowed to request the capability. '*' matches all users
+	users map[job.Capability][]string
+}
+
+// newCapabilityPolicy checks the configured capability names.
+func newCapabilityPolicy(cfg map[string][]string) (*capabilityPolicy, error) {
+	rt := &capabilityPolicy{users: make(map[job.Capability][]string)}
+
+	for name, users := range cfg {
+		c, err := job.ParseCapability(name)
+		if err != nil {
+			return nil, err
+		}
+		rt.users[c] = append(rt.users[c], users...)
+	}
+
+	return rt, nil
+}
+
+// resolve checks user uid may request the capabilities, and returns them.
+func (p *capabilityPolicy) resolve(uid string, req []string) ([]job.Capability, error) {
+	var rt []job.Capability
+	seen := make(map[job.Capability]bool)
+
+	for _, name := range req {
+		c, err := job.ParseCapability(name)
+		if err != nil {
+			return nil, err
+		}
+
+		if !allowed(p.users[c], uid) {
+			return nil, fmt.Errorf("capability %s is not allowed", c)
+		}
+
+		if !seen[c] {
+			seen[c] = true
+			rt = append(rt, c)
+		}
+	}
+
+	return rt, nil
+}
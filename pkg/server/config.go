@@ -4,6 +4,7 @@ import (
 	"flag"
 	"os"
 	"os/user"
+	"time"
 
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
@@ -36,8 +37,222 @@ type Config struct {
 		// GID is group id
 		GID string `mapstructure:"gid"`
 	} `mapstructure:"ids"`
+	// Identities are the UIDs/GIDs clients may run jobs with: client ID -> identities. '*' matches
+	// all clients. Clients without a mapping run jobs with IDs
+	Identities map[string]IdentityConfig `mapstructure:"identities"`
 	// Address is the server address
 	Address string `mapstructure:"address"`
+	// Images are named root filesystems for jobs: NAME -> PATH. PATH is a directory or a tarball
+	// (.tar, .tar.gz, .tgz) located under WorkRoot. Relative paths are resolved against WorkRoot
+	Images map[string]string `mapstructure:"images"`
+	// Rlimits are POSIX resource limits of job processes. Values are SOFT:HARD, a single value
+	// for both, or 'unlimited'. Resources are nofile, core, stack, fsize, cpu
+	Rlimits struct {
+		// Defaults are applied if a job doesn't request the resource. core is 0 unless configured
+		Defaults map[string]string `mapstructure:"defaults"`
+		// Max are the highest values jobs may request. The server's own hard limits if not configured
+		Max map[string]string `mapstructure:"max"`
+	} `mapstructure:"rlimits"`
+	// Volumes are named host paths jobs may bind-mount: NAME -> volume
+	Volumes map[string]VolumeConfig `mapstructure:"volumes"`
+	// UserNS makes jobs run as root in their own user namespaces, each mapped to its own range
+	// of host IDs. IDs config is ignored then
+	UserNS struct {
+		// Enabled turns user namespaces on
+		Enabled bool `mapstructure:"enabled"`
+		// Base is the first host ID of the ranges. Must not overlap with the host users
+		Base int `mapstructure:"base"`
+		// Size is the number of IDs in a range. 65536 by default
+		Size int `mapstructure:"size"`
+		// Count is the number of ranges, i.e. max number of jobs. 1000 by default
+		Count int `mapstructure:"count"`
+	} `mapstructure:"userns"`
+	// Network is the bridge network of jobs
+	Network struct {
+		// Bridge is the host bridge name. jobs0 by default
+		Bridge string `mapstructure:"bridge"`
+		// Subnet is the IPv4 subnet of jobs. 10.88.0.0/24 by default
+		Subnet string `mapstructure:"subnet"`
+		// NAT enables masquerading of the job traffic leaving the host
+		NAT bool `mapstructure:"nat"`
+		// Ports are the host ports bridge jobs may publish
+		Ports struct {
+			// Min is the lowest host port all users may publish. 1024 by default
+			Min uint16 `mapstructure:"min"`
+			// Max is the highest host port all users may publish. 65535 by default
+			Max uint16 `mapstructure:"max"`
+			// Allow are the host ports outside the range users may publish: PORT -> users. '*' matches all users
+			Allow map[string][]string `mapstructure:"allow"`
+		} `mapstructure:"ports"`
+		// Egress is the outbound traffic policy of bridge jobs. Rules are [PROTOCOL:]CIDR[:PORT]
+		Egress struct {
+			// Defaults is the policy of all jobs, the job rules are added to it
+			Defaults EgressConfig `mapstructure:"defaults"`
+			// Max allow rules bound the ones jobs may request. Max deny rules are always applied
+			Max EgressConfig `mapstructure:"max"`
+		} `mapstructure:"egress"`
+	} `mapstructure:"network"`
+	// Seccomp are the syscall filtering profiles of jobs
+	Seccomp struct {
+		// Default is the profile of jobs not requesting one: 'default', 'unconfined' or a profile name.
+		// The built-in 'default' profile if empty
+		Default string `mapstructure:"default"`
+		// Profiles are admin-defined OCI-style JSON profiles: NAME -> profile
+		Profiles map[string]SeccompConfig `mapstructure:"profiles"`
+		// Unconfined are the users who may run jobs without filtering. '*' matches all users
+		Unconfined []string `mapstructure:"unconfined"`
+	} `mapstructure:"seccomp"`
+	// Capabilities are the capabilities jobs may request to keep: CAPABILITY -> users. '*' matches
+	// all users. Jobs have no capabilities unless requested
+	Capabilities map[string][]string `mapstructure:"capabilities"`
+	// Profiles are named isolation settings jobs may run with: NAME -> profile. A 'default' profile
+	// with the built-in settings is added, unless configured
+	Profiles map[string]ProfileConfig `mapstructure:"profiles"`
+	// DefaultProfile is the profile of jobs not requesting one, allowed to all users. 'default' if not set
+	DefaultProfile string `mapstructure:"defaultProfile"`
+	// Queue limits the jobs running at the same time. Jobs that don't fit wait in the queue.
+	// No limits if not set
+	Queue struct {
+		// MaxJobs is the max number of running jobs
+		MaxJobs int `mapstructure:"maxJobs"`
+		// CPU is the total CPU limit of running jobs. Jobs without a CPU limit count as 0
+		CPU float32 `mapstructure:"cpu"`
+		// Memory is the total memory limit of running jobs, in bytes. Jobs without a memory limit count as 0
+		Memory int64 `mapstructure:"memory"`
+		// Order is the queue order: fifo or priority. fifo by default
+		Order string `mapstructure:"order"`
+		// PriorityClasses are the named priorities clients may request: NAME -> class. Require priority order
+		PriorityClasses map[string]PriorityClassConfig `mapstructure:"priorityClasses"`
+	} `mapstructure:"queue"`
+	// SchedulesFile is where the job schedules are persisted. workroot/schedules.json by default.
+	// Schedules are kept in memory only if neither is set
+	SchedulesFile string `mapstructure:"schedulesFile"`
+	// Quotas limit what the jobs of each client may hold: client ID -> quota. '*' is the quota of
+	// clients not listed. No limits if not set
+	Quotas map[string]QuotaConfig `mapstructure:"quotas"`
+	// Retention limits the completed jobs kept. The oldest jobs over the limits are removed in the background.
+	// No limits if not set, the jobs are kept until removed by the clients
+	Retention struct {
+		// TTL is how long a completed job is kept, unless the job sets its own, e.g. 24h
+		TTL time.Duration `mapstructure:"ttl"`
+		// MaxRetainedJobs is the max number of completed jobs of a client
+		MaxRetainedJobs int `mapstructure:"maxRetainedJobs"`
+		// MaxLogBytes is the max total output size of the completed jobs
+		MaxLogBytes int64 `mapstructure:"maxLogBytes"`
+		// Interval is how often the expired jobs are removed. 1m by default
+		Interval time.Duration `mapstructure:"interval"`
+	} `mapstructure:"retention"`
+}
+
+// PriorityClassConfig is a named queue priority
+type PriorityClassConfig struct {
+	// Priority is the queue priority of the jobs, higher first. 0 by default, may be negative
+	Priority int `mapstructure:"priority"`
+	// Preempt allows the jobs to stop the running jobs with lower priorities, if they don't fit the capacity.
+	// The preempted jobs are queued again
+	Preempt bool `mapstructure:"preempt"`
+	// Users may request the class. '*' matches all users
+	Users []string `mapstructure:"users"`
+}
+
+// QuotaConfig limits what the jobs of a client may hold. 0 means no limit
+type QuotaConfig struct {
+	// ActiveJobs is the max number of running and queued jobs
+	ActiveJobs int `mapstructure:"activeJobs"`
+	// CPU is the max total CPU limit of the active jobs. Jobs must set a CPU limit then
+	CPU float32 `mapstructure:"cpu"`
+	// Memory is the max total memory limit of the active jobs, in bytes. Jobs must set a memory limit then
+	Memory int64 `mapstructure:"memory"`
+	// RetainedJobs is the max number of completed jobs not removed yet. The oldest ones are removed to start new jobs
+	RetainedJobs int `mapstructure:"retainedJobs"`
+}
+
+// ProfileConfig is a named set of isolation settings
+type ProfileConfig struct {
+	// Namespaces are the optional job namespaces: pid, uts, ipc. All of them if not set
+	Namespaces []string `mapstructure:"namespaces"`
+	// HostNetwork allows jobs to share the server network
+	HostNetwork bool `mapstructure:"hostNetwork"`
+	// Controllers are the cgroup controllers enabled for jobs. io, cpu and memory if not set
+	Controllers []string `mapstructure:"controllers"`
+	// Limits are the limits of jobs not requesting them
+	Limits LimitsConfig `mapstructure:"limits"`
+	// BaseDir is where job directories are created. WORKROOT/jobs, or /tmp/jobs without WorkRoot, if not set
+	BaseDir string `mapstructure:"basedir"`
+	// Shim is the shim binary, accepting the server shim mode flags. The server binary if not set
+	Shim string `mapstructure:"shim"`
+	// Users may run jobs with the profile. '*' matches all users
+	Users []string `mapstructure:"users"`
+}
+
+// LimitsConfig are job resource limits. Zero means no limit, unless noted
+type LimitsConfig struct {
+	// CPU is the number of CPUs, fractional
+	CPU float32 `mapstructure:"cpu"`
+	// Memory is the RAM limit, bytes
+	Memory int64 `mapstructure:"memory"`
+	// MemoryHigh is the RAM throttling limit, bytes
+	MemoryHigh int64 `mapstructure:"memoryHigh"`
+	// MemoryLow is the best-effort RAM protection, bytes
+	MemoryLow int64 `mapstructure:"memoryLow"`
+	// MemoryMin is the hard RAM protection, bytes
+	MemoryMin int64 `mapstructure:"memoryMin"`
+	// Swap is the swap limit, bytes. No limit if not set, 0 disables swap
+	Swap *int64 `mapstructure:"swap"`
+	// IO is the disk IO rate limit, bytes per second
+	IO int64 `mapstructure:"io"`
+	// Devices are the per-device IO limits
+	Devices []DeviceLimitConfig `mapstructure:"devices"`
+	// IOWeight is the proportional IO share, 1-10000
+	IOWeight int `mapstructure:"ioWeight"`
+	// Disk is the working directory size limit, bytes
+	Disk int64 `mapstructure:"disk"`
+}
+
+// DeviceLimitConfig are IO limits of a block device. Zero means no limit
+type DeviceLimitConfig struct {
+	// Device is a path under /dev, major:minor, or '*' for all disks
+	Device string `mapstructure:"device"`
+	// ReadBPS is the read rate limit, bytes per second
+	ReadBPS int64 `mapstructure:"readBps"`
+	// WriteBPS is the write rate limit, bytes per second
+	WriteBPS int64 `mapstructure:"writeBps"`
+	// ReadIOPS is the read operations per second limit
+	ReadIOPS int64 `mapstructure:"readIops"`
+	// WriteIOPS is the write operations per second limit
+	WriteIOPS int64 `mapstructure:"writeIops"`
+}
+
+// IdentityConfig is a set of UIDs and GIDs a client may run jobs with
+type IdentityConfig struct {
+	// UIDs are user names or numeric IDs. The first one is the default
+	UIDs []string `mapstructure:"uids"`
+	// GIDs are group names or numeric IDs. The first one is the default
+	GIDs []string `mapstructure:"gids"`
+}
+
+// EgressConfig is an outbound traffic policy
+type EgressConfig struct {
+	// Allow are the allowed destinations
+	Allow []string `mapstructure:"allow"`
+	// Deny are the denied destinations
+	Deny []string `mapstructure:"deny"`
+}
+
+// SeccompConfig is a syscall filtering profile jobs may use
+type SeccompConfig struct {
+	// Path is the profile JSON file
+	Path string `mapstructure:"path"`
+	// Users may run jobs with the profile. '*' matches all users
+	Users []string `mapstructure:"users"`
+}
+
+// VolumeConfig is a host path jobs may bind-mount
+type VolumeConfig struct {
+	// Path is the absolute host path
+	Path string `mapstructure:"path"`
+	// Users are the modes users may mount the volume with: USER -> ro|rw. '*' matches all users
+	Users map[string]string `mapstructure:"users"`
 }
 
 // FindConfig ties to find server config
@@ -70,6 +285,14 @@ func FindConfig(file string) (*Config, error) {
 		conf.TLS.ReloadSec = 30
 	}
 
+	if conf.UserNS.Size <= 0 {
+		conf.UserNS.Size = 65536
+	}
+
+	if conf.UserNS.Count <= 0 {
+		conf.UserNS.Count = 1000
+	}
+
 	if f := pflag.Lookup("uid"); f != nil && f.Changed {
 		conf.IDs.UID = f.Value.String()
 	}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"errors"
+	"os"
+	"sync"
+
+	pb "github.com/ilyazz/jobs/pkg/api/grpc/jobs/v1"
+	"github.com/ilyazz/jobs/pkg/job"
+	"github.com/ilyazz/jobs/pkg/supervisor"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// execOutput sends the command output to the Exec stream.
+type execOutput struct {
+	// lock serializes stdout and stderr sends
+	lock   *sync.Mutex
+	stream pb.JobService_ExecServer
+	stderr bool
+}
+
+// Write sends a chunk of output.
+func (o execOutput) Write(p []byte) (int, error) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	data := append([]byte(nil), p...)
+	rsp := &pb.ExecResponse{Output: &pb.ExecResponse_Stdout{Stdout: data}}
+	if o.stderr {
+		rsp.Output = &pb.ExecResponse_Stderr{Stderr: data}
+	}
+
+	if err := o.stream.Send(rsp); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Exec implements API Exec method. The command is killed if the client goes away
+func (j *JobServer) Exec(stream pb.JobService_ExecServer) error {
+	cid, ok := authID(stream.Context())
+	if !ok {
+		return status.Error(codes.Unauthenticated, "invalid client ID")
+	}
+
+	req, err := stream.Recv()
+	if err != nil {
+		return status.Error(codes.Canceled, "no command received")
+	}
+
+	start := req.GetStart()
+	if start == nil || start.Command == "" {
+		return status.Error(codes.InvalidArgument, "the first message must set the command")
+	}
+
+	if !j.hasFullAccess(cid, start.JobId) {
+		log.Info().Str("client", cid).Str("job", start.JobId).Msg("no access")
+		return status.Error(codes.NotFound, "job not found")
+	}
+
+	// a pipe, not a reader, so that waiting for the command doesn't wait for the client input
+	stdin, input, err := os.Pipe()
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	var lock sync.Mutex
+	p, err := j.jobs.Exec(start.JobId, start.Command, start.Args, stdin,
+		execOutput{lock: &lock, stream: stream}, execOutput{lock: &lock, stream: stream, stderr: true})
+	// the command has its own copy
+	_ = stdin.Close()
+
+	switch {
+	case errors.Is(err, supervisor.ErrNotFound):
+		_ = input.Close()
+		return status.Error(codes.NotFound, "job not found")
+	case errors.Is(err, job.ErrNotRunning), errors.Is(err, supervisor.ErrArrayJob):
+		_ = input.Close()
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case err != nil:
+		_ = input.Close()
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	go func() {
+		defer func() {
+			_ = input.Close()
+		}()
+
+		for {
+			req, err := stream.Recv()
+			if err != nil {
+				return
+			}
+
+			switch in := req.Input.(type) {
+			case *pb.ExecRequest_Stdin:
+				if _, err := input.Write(in.Stdin); err != nil {
+					return
+				}
+			case *pb.ExecRequest_CloseStdin:
+				return
+			}
+		}
+	}()
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-stream.Context().Done():
+			if err := p.Kill(); err != nil {
+				log.Warn().Err(err).Str("job", start.JobId).Msg("failed to kill exec process")
+			}
+		case <-done:
+		}
+	}()
+
+	code, err := p.Wait()
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	return stream.Send(&pb.ExecResponse{Output: &pb.ExecResponse_ExitCode{ExitCode: int32(code)}})
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"fmt"
+	"os/user"
+	"strconv"
+
+	"github.com/ilyazz/jobs/pkg/job"
+)
+
+// identityPolicy maps client IDs to the UIDs and GIDs their jobs may run with.
+type identityPolicy struct {
+	// def is the identity of the jobs of clients without a mapping
+	def job.ExecIdentity
+	// users are the allowed identities: client ID -> identities. The first UID and GID are the defaults
+	users map[string]allowedIDs
+}
+
+// allowedIDs are UIDs and GIDs a client may run jobs with.
+type allowedIDs struct {
+	uids []int
+	gids []int
+}
+
+// newIdentityPolicy resolves the configured user and group names.
+func newIdentityPolicy(def job.ExecIdentity, cfg map[string]IdentityConfig) (*identityPolicy, error) {
+	rt := &identityPolicy{def: def, users: make(map[string]allowedIDs)}
+
+	for cid, ic := range cfg {
+		if len(ic.UIDs) == 0 || len(ic.GIDs) == 0 {
+			return nil, fmt.Errorf("identity %q: uids and gids are required", cid)
+		}
+
+		var ids allowedIDs
+		for _, u := range ic.UIDs {
+			id, err := lookupUID(u)
+			if err != nil {
+				return nil, fmt.Errorf("identity %q: %w", cid, err)
+			}
+			ids.uids = append(ids.uids, id)
+		}
+		for _, g := range ic.GIDs {
+			id, err := lookupGID(g)
+			if err != nil {
+				return nil, fmt.Errorf("identity %q: %w", cid, err)
+			}
+			ids.gids = append(ids.gids, id)
+		}
+
+		rt.users[cid] = ids
+	}
+
+	return rt, nil
+}
+
+// resolve returns the identity to run the job of client cid with. runAsUser and runAsGroup
+// are names or numeric IDs, the client defaults are used if empty.
+func (p *identityPolicy) resolve(cid, runAsUser, runAsGroup string) (job.ExecIdentity, error) {
+	allowed, ok := p.users[cid]
+	if !ok {
+		allowed, ok = p.users[anyUser]
+	}
+	if !ok {
+		allowed = allowedIDs{uids: []int{p.def.UID}, gids: []int{p.def.GID}}
+	}
+
+	rt := job.ExecIdentity{UID: allowed.uids[0], GID: allowed.gids[0]}
+
+	if runAsUser != "" {
+		id, err := lookupUID(runAsUser)
+		if err != nil {
+			return rt, err
+		}
+		if !contains(allowed.uids, id) {
+			return rt, fmt.Errorf("not allowed to run as user %q", runAsUser)
+		}
+		rt.UID = id
+	}
+
+	if runAsGroup != "" {
+		id, err := lookupGID(runAsGroup)
+		if err != nil {
+			return rt, err
+		}
+		if !contains(allowed.gids, id) {
+			return rt, fmt.Errorf("not allowed to run as group %q", runAsGroup)
+		}
+		rt.GID = id
+	}
+
+	return rt, nil
+}
+
+// lookupUID resolves a user name or a numeric UID.
+func lookupUID(s string) (int, error) {
+	if id, err := strconv.Atoi(s); err == nil && id >= 0 {
+		return id, nil
+	}
+	u, err := user.Lookup(s)
+	if err != nil {
+		return 0, fmt.Errorf("unknown user %q", s)
+	}
+	return strconv.Atoi(u.Uid)
+}
+
+// lookupGID resolves a group name or a numeric GID.
+func lookupGID(s string) (int, error) {
+	if id, err := strconv.Atoi(s); err == nil && id >= 0 {
+		return id, nil
+	}
+	g, err := user.LookupGroup(s)
+	if err != nil {
+		return 0, fmt.Errorf("unknown group %q", s)
+	}
+	return strconv.Atoi(g.Gid)
+}
+
+// contains checks if ids contain id.
+func contains(ids []int, id int) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,203 @@
+package server
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ilyazz/jobs/pkg/acl"
+	pb "github.com/ilyazz/jobs/pkg/api/grpc/jobs/v1"
+	"github.com/ilyazz/jobs/pkg/supervisor"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// StartPipeline implements API StartPipeline method. Each step job is checked as the Start method does,
+// and the steps together must fit the client quota, at the pipeline start
+func (j *JobServer) StartPipeline(ctx context.Context, req *pb.StartPipelineRequest) (*pb.StartPipelineResponse, error) {
+	cid, ok := authID(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "invalid client ID")
+	}
+
+	release := j.quotas.acquire(cid)
+	defer release()
+
+	usage := j.jobs.Usage(cid)
+
+	steps := make([]supervisor.Step, 0, len(req.Steps))
+	for _, st := range req.Steps {
+		if st.Job == nil {
+			return nil, status.Errorf(codes.InvalidArgument, "step %q has no job", st.Name)
+		}
+		if st.Job.Array != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "step %q is an array job", st.Name)
+		}
+
+		spec, err := j.toSpec(cid, st.Job)
+		if err != nil {
+			return nil, err
+		}
+		if err := j.quotas.check(cid, usage, spec, 1); err != nil {
+			return nil, status.Errorf(codes.ResourceExhausted, "step %q: %v", st.Name, err)
+		}
+		// the steps may run at the same time, each is charged as an active job
+		usage = charge(usage, spec, 1)
+		spec.Owner = cid
+
+		steps = append(steps, supervisor.Step{Name: st.Name, Spec: spec, DependsOn: toDependencies(st.DependsOn)})
+	}
+	if err := j.makeRoom(cid, usage); err != nil {
+		return nil, status.Error(codes.ResourceExhausted, err.Error())
+	}
+
+	// the endpoints are allocated last, and released if the pipeline doesn't start
+	for i, st := range req.Steps {
+		if err := j.connect(cid, &steps[i].Spec, st.Job); err != nil {
+			disconnect(steps)
+			return nil, err
+		}
+	}
+
+	id, d, err := j.jobs.StartPipeline(steps)
+	switch {
+	case errors.Is(err, supervisor.ErrInvalidPipeline):
+		disconnect(steps)
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	case err != nil:
+		disconnect(steps)
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	_ = j.auth.SetOwner(acl.ObjectID(id), acl.UserID(cid))
+	for _, st := range d.Steps {
+		_ = j.auth.SetOwner(acl.ObjectID(st.JobID), acl.UserID(cid))
+	}
+
+	return &pb.StartPipelineResponse{
+		PipelineId: string(id),
+		Details:    fromPipelineDetails(d),
+	}, nil
+}
+
+// InspectPipeline implements API InspectPipeline method
+func (j *JobServer) InspectPipeline(ctx context.Context, req *pb.InspectPipelineRequest) (*pb.InspectPipelineResponse, error) {
+	cid, ok := authID(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "invalid client ID")
+	}
+
+	if !j.hasReadAccess(cid, req.PipelineId) {
+		log.Info().Str("client", cid).Str("pipeline", req.PipelineId).Msg("no access")
+		return nil, status.Error(codes.NotFound, "pipeline not found")
+	}
+
+	d, err := j.jobs.InspectPipeline(supervisor.PipelineID(req.PipelineId))
+	switch {
+	case errors.Is(err, supervisor.ErrPipelineNotFound):
+		return nil, status.Error(codes.NotFound, "pipeline not found")
+	case err != nil:
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &pb.InspectPipelineResponse{Details: fromPipelineDetails(d)}, nil
+}
+
+// StopPipeline implements API StopPipeline method
+func (j *JobServer) StopPipeline(ctx context.Context, req *pb.StopPipelineRequest) (*pb.StopPipelineResponse, error) {
+	cid, ok := authID(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "invalid client ID")
+	}
+
+	if !j.hasFullAccess(cid, req.PipelineId) {
+		log.Info().Str("client", cid).Str("pipeline", req.PipelineId).Msg("no access")
+		return nil, status.Error(codes.NotFound, "pipeline not found")
+	}
+
+	err := j.jobs.StopPipeline(supervisor.PipelineID(req.PipelineId))
+	switch {
+	case errors.Is(err, supervisor.ErrPipelineNotFound):
+		return nil, status.Error(codes.NotFound, "pipeline not found")
+	case err != nil:
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &pb.StopPipelineResponse{}, nil
+}
+
+// disconnect releases the network endpoints of the steps that never start.
+func disconnect(steps []supervisor.Step) {
+	for _, st := range steps {
+		if st.Spec.Endpoint == nil {
+			continue
+		}
+		if err := st.Spec.Endpoint.Detach(); err != nil {
+			log.Warn().Err(err).Str("step", st.Name).Msg("failed to release the network endpoint")
+		}
+	}
+}
+
+// toDependencies converts the step dependencies from PB to internal format
+func toDependencies(deps []*pb.Dependency) []supervisor.Dependency {
+	rt := make([]supervisor.Dependency, 0, len(deps))
+	for _, d := range deps {
+		c := supervisor.OnSuccess
+		switch d.Condition {
+		case pb.Condition_CONDITION_FAILURE:
+			c = supervisor.OnFailure
+		case pb.Condition_CONDITION_ALWAYS:
+			c = supervisor.Always
+		}
+		rt = append(rt, supervisor.Dependency{Step: d.Step, Condition: c})
+	}
+	return rt
+}
+
+// fromPipelineDetails converts the pipeline details from internal format to PB
+func fromPipelineDetails(d supervisor.PipelineDetails) *pb.PipelineDetails {
+	rt := &pb.PipelineDetails{Status: fromPipelineStatus(d.Status)}
+	for _, st := range d.Steps {
+		rt.Steps = append(rt.Steps, &pb.StepDetails{
+			Name:  st.Name,
+			JobId: string(st.JobID),
+			State: fromStepState(st.State),
+			Error: st.Error,
+		})
+	}
+	return rt
+}
+
+// fromPipelineStatus converts the pipeline status from internal format to PB
+func fromPipelineStatus(s supervisor.PipelineStatus) pb.PipelineStatus {
+	switch s {
+	case supervisor.PipelineRunning:
+		return pb.PipelineStatus_PIPELINE_STATUS_RUNNING
+	case supervisor.PipelineSucceeded:
+		return pb.PipelineStatus_PIPELINE_STATUS_SUCCEEDED
+	case supervisor.PipelineFailed:
+		return pb.PipelineStatus_PIPELINE_STATUS_FAILED
+	case supervisor.PipelineCancelled:
+		return pb.PipelineStatus_PIPELINE_STATUS_CANCELLED
+	default:
+		return pb.PipelineStatus_PIPELINE_STATUS_UNSPECIFIED
+	}
+}
+
+// fromStepState converts the pipeline step state from internal format to PB
+func fromStepState(s supervisor.StepState) pb.StepState {
+	switch s {
+	case supervisor.StepWaiting:
+		return pb.StepState_STEP_STATE_WAITING
+	case supervisor.StepStarted:
+		return pb.StepState_STEP_STATE_STARTED
+	case supervisor.StepSucceeded:
+		return pb.StepState_STEP_STATE_SUCCEEDED
+	case supervisor.StepFailed:
+		return pb.StepState_STEP_STATE_FAILED
+	case supervisor.StepSkipped:
+		return pb.StepState_STEP_STATE_SKIPPED
+	default:
+		return pb.StepState_STEP_STATE_UNSPECIFIED
+	}
+}
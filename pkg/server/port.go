@@ -0,0 +1,60 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/ilyazz/jobs/pkg/network"
+)
+
+const (
+	// defaultMinPort is the lowest host port jobs may publish by default, the first unprivileged one
+	defaultMinPort = 1024
+	// defaultMaxPort is the highest host port jobs may publish by default
+	defaultMaxPort = 65535
+)
+
+// portPolicy defines the host ports jobs may publish, and who may publish them.
+type portPolicy struct {
+	// min and max bound the host ports all users may publish
+	min, max uint16
+	// users are the users allowed to publish a host port outside the range. '*' matches all users
+	users map[uint16][]string
+}
+
+// newPortPolicy checks the configured port range, and the ports allowed outside it.
+func newPortPolicy(min, max uint16, allow map[string][]string) (*portPolicy, error) {
+	if min == 0 {
+		min = defaultMinPort
+	}
+	if max == 0 {
+		max = defaultMaxPort
+	}
+	if min > max {
+		return nil, fmt.Errorf("empty port range %d-%d", min, max)
+	}
+
+	rt := &portPolicy{min: min, max: max, users: make(map[uint16][]string)}
+	for s, users := range allow {
+		port, err := strconv.ParseUint(s, 10, 16)
+		if err != nil || port == 0 {
+			return nil, fmt.Errorf("invalid port %q", s)
+		}
+		rt.users[uint16(port)] = append(rt.users[uint16(port)], users...)
+	}
+
+	return rt, nil
+}
+
+// check checks user uid may publish host ports.
+func (p *portPolicy) check(uid string, ports []network.Port) error {
+	for _, port := range ports {
+		if port.Host >= p.min && port.Host <= p.max {
+			continue
+		}
+		if !allowed(p.users[port.Host], uid) {
+			return fmt.Errorf("host port %d is not allowed, expected %d-%d", port.Host, p.min, p.max)
+		}
+	}
+	return nil
+}
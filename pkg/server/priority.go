@@ -0,0 +1,50 @@
+package server
+
+import (
+	"fmt"
+)
+
+// priorityClass is a named queue priority, optionally preempting the running jobs with lower priorities.
+type priorityClass struct {
+	priority int
+	preempt  bool
+	// users may request the class. '*' matches all users
+	users []string
+}
+
+// priorityPolicy defines the queue priorities clients may request. Jobs not requesting a class get priority 0.
+type priorityPolicy struct {
+	// classes are the priority classes by name
+	classes map[string]priorityClass
+}
+
+// newPriorityPolicy checks the configured priority classes. Classes are effective with priority queue order only.
+func newPriorityPolicy(order string, cfg map[string]PriorityClassConfig) (*priorityPolicy, error) {
+	if len(cfg) > 0 && order != "priority" {
+		return nil, fmt.Errorf("priority classes require priority queue order")
+	}
+
+	rt := &priorityPolicy{classes: make(map[string]priorityClass)}
+	for name, c := range cfg {
+		if name == "" {
+			return nil, fmt.Errorf("empty priority class name")
+		}
+		rt.classes[name] = priorityClass{priority: c.Priority, preempt: c.Preempt, users: c.Users}
+	}
+
+	return rt, nil
+}
+
+// resolve checks user uid may request priority class name. Returns the priority, and whether the job may
+// preempt others.
+func (p *priorityPolicy) resolve(uid string, name string) (int, bool, error) {
+	if name == "" {
+		return 0, false, nil
+	}
+
+	c, ok := p.classes[name]
+	if !ok || !allowed(c.users, uid) {
+		return 0, false, fmt.Errorf("priority class %q is not allowed", name)
+	}
+	return c.priority, c.preempt, nil
+}
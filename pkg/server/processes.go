@@ -0,0 +1,54 @@
+package server
+
+import (
+	"context"
+	"errors"
+
+	pb "github.com/ilyazz/jobs/pkg/api/grpc/jobs/v1"
+	"github.com/ilyazz/jobs/pkg/job"
+	"github.com/ilyazz/jobs/pkg/supervisor"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Processes implements API Processes method
+// error is returned if:
+//   - request user is not authorized for read access to the job
+//   - job is not found
+//   - job is not running
+func (j *JobServer) Processes(ctx context.Context, req *pb.ProcessesRequest) (*pb.ProcessesResponse, error) {
+	cid, ok := authID(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "invalid client ID")
+	}
+
+	if !j.hasReadAccess(cid, req.JobId) {
+		log.Info().Str("client", cid).Str("job", req.JobId).Msg("no access")
+		return nil, status.Error(codes.NotFound, "job not found")
+	}
+
+	procs, err := j.jobs.Processes(req.JobId)
+	switch {
+	case errors.Is(err, supervisor.ErrNotFound):
+		return nil, status.Error(codes.NotFound, "job not found")
+	case errors.Is(err, job.ErrNotRunning), errors.Is(err, supervisor.ErrArrayJob):
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	case err != nil:
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	rsp := &pb.ProcessesResponse{}
+	for _, p := range procs {
+		rsp.Processes = append(rsp.Processes, &pb.Process{
+			Pid:       int32(p.PID),
+			NsPid:     int32(p.NsPID),
+			Cmdline:   p.Cmdline,
+			State:     p.State,
+			CpuTimeUs: p.CPUTime.Microseconds(),
+			RssBytes:  p.RSS,
+		})
+	}
+
+	return rsp, nil
+}
@@ -0,0 +1,312 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ilyazz/jobs/pkg/job"
+	"github.com/ilyazz/jobs/pkg/supervisor"
+)
+
+// defaultProfileName is the profile of jobs not requesting one, unless configured otherwise.
+const defaultProfileName = "default"
+
+// profile is a named set of isolation settings.
+type profile struct {
+	// namespaces are the optional namespaces jobs can't leave out, and get unless requesting others.
+	// job.DefaultNamespaces if nil
+	namespaces []job.Namespace
+	// hostNetwork allows jobs to share the server network
+	hostNetwork bool
+	// controllers are the cgroup controllers enabled for jobs. job.DefaultControllers if nil
+	controllers []string
+	// limits are the max limits of jobs, and the limits of jobs not requesting them
+	limits job.ExecLimits
+	// baseDir is where job directories are created
+	baseDir string
+	// shim is the shim binary. The server binary if empty
+	shim string
+	// users may run jobs with the profile. '*' matches all users
+	users []string
+}
+
+// profilePolicy defines the isolation profiles jobs may run with, and who may use them.
+type profilePolicy struct {
+	// def is the profile of jobs not requesting one
+	def string
+	// profiles are the configured profiles: name -> profile
+	profiles map[string]profile
+}
+
+// newProfilePolicy checks the configured profiles. Job directories are created under workRoot/jobs,
+// if a profile doesn't set another base dir. A default profile allowed to all users is added, unless configured.
+func newProfilePolicy(workRoot string, def string, cfg map[string]ProfileConfig) (*profilePolicy, error) {
+	baseDir := ""
+	if workRoot != "" {
+		root, err := filepath.Abs(workRoot)
+		if err != nil {
+			return nil, err
+		}
+		baseDir = filepath.Join(root, "jobs")
+	}
+
+	if def == "" {
+		def = defaultProfileName
+	}
+
+	rt := &profilePolicy{def: def, profiles: make(map[string]profile)}
+
+	for name, pc := range cfg {
+		var devices []job.DeviceIOLimit
+		for _, d := range pc.Limits.Devices {
+			devices = append(devices, job.DeviceIOLimit{
+				Device:    d.Device,
+				ReadBPS:   d.ReadBPS,
+				WriteBPS:  d.WriteBPS,
+				ReadIOPS:  d.ReadIOPS,
+				WriteIOPS: d.WriteIOPS,
+			})
+		}
+
+		p := profile{
+			hostNetwork: pc.HostNetwork,
+			controllers: pc.Controllers,
+			limits: job.ExecLimits{
+				CPU:            pc.Limits.CPU,
+				MaxRAMBytes:    pc.Limits.Memory,
+				HighRAMBytes:   pc.Limits.MemoryHigh,
+				LowRAMBytes:    pc.Limits.MemoryLow,
+				MinRAMBytes:    pc.Limits.MemoryMin,
+				MaxSwapBytes:   pc.Limits.Swap,
+				MaxDiskIOBytes: pc.Limits.IO,
+				Devices:        devices,
+				IOWeight:       pc.Limits.IOWeight,
+				MaxDiskBytes:   pc.Limits.Disk,
+			},
+			baseDir: baseDir,
+			shim:    pc.Shim,
+			users:   pc.Users,
+		}
+
+		if pc.Namespaces != nil {
+			p.namespaces = []job.Namespace{}
+			for _, ns := range pc.Namespaces {
+				parsed, err := job.ParseNamespaces(ns)
+				if err != nil {
+					return nil, fmt.Errorf("profile %q: %w", name, err)
+				}
+				p.namespaces = append(p.namespaces, parsed...)
+			}
+		}
+
+		if err := p.limits.Validate(); err != nil {
+			return nil, fmt.Errorf("profile %q: %w", name, err)
+		}
+
+		if pc.BaseDir != "" {
+			if !filepath.IsAbs(pc.BaseDir) {
+				return nil, fmt.Errorf("profile %q: base dir must be absolute", name)
+			}
+			p.baseDir = filepath.Clean(pc.BaseDir)
+		}
+
+		if pc.Shim != "" {
+			if fi, err := os.Stat(pc.Shim); err != nil {
+				return nil, fmt.Errorf("profile %q: %w", name, err)
+			} else if fi.IsDir() {
+				return nil, fmt.Errorf("profile %q: shim %q is a directory", name, pc.Shim)
+			}
+		}
+
+		rt.profiles[name] = p
+	}
+
+	if _, ok := rt.profiles[defaultProfileName]; !ok {
+		rt.profiles[defaultProfileName] = profile{baseDir: baseDir, users: []string{anyUser}}
+	}
+
+	if _, ok := rt.profiles[def]; !ok {
+		return nil, fmt.Errorf("unknown default profile: %q", def)
+	}
+
+	return rt, nil
+}
+
+// resolve checks user uid may use the requested profile, and returns it.
+func (p *profilePolicy) resolve(uid string, name string) (profile, error) {
+	if name == "" {
+		name = p.def
+	}
+
+	rt, ok := p.profiles[name]
+	if !ok {
+		return profile{}, fmt.Errorf("unknown profile: %q", name)
+	}
+
+	if !allowed(rt.users, uid) {
+		return profile{}, fmt.Errorf("profile %q is not allowed", name)
+	}
+
+	return rt, nil
+}
+
+// apply checks the namespaces and limits requested in job spec don't exceed the profile ones, and
+// sets the profile settings there, and the profile limits the job didn't request.
+func (p profile) apply(spec *supervisor.Spec) error {
+	if spec.Network == job.NetHost && !p.hostNetwork {
+		return fmt.Errorf("host network is not allowed")
+	}
+
+	if spec.Namespaces == nil {
+		spec.Namespaces = p.namespaces
+	} else {
+		required := p.namespaces
+		if required == nil {
+			required = job.DefaultNamespaces
+		}
+		for _, ns := range required {
+			if !hasNamespace(spec.Namespaces, ns) {
+				return fmt.Errorf("namespace %q is required by the profile", ns)
+			}
+		}
+	}
+
+	if err := p.limit(&spec.Limits); err != nil {
+		return err
+	}
+
+	spec.Controllers = p.controllers
+	spec.BaseDir = p.baseDir
+	spec.Shim = p.shim
+
+	return nil
+}
+
+// limit checks job limits l don't exceed the profile limits, and sets the ones the job didn't request.
+func (p profile) limit(l *job.ExecLimits) error {
+	max := p.limits
+
+	if max.CPU > 0 {
+		if l.CPU == 0 {
+			l.CPU = max.CPU
+		} else if l.CPU > max.CPU {
+			return fmt.Errorf("cpu limit %v exceeds the profile one %v", l.CPU, max.CPU)
+		}
+	}
+
+	if max.IOWeight > 0 {
+		if l.IOWeight == 0 {
+			l.IOWeight = max.IOWeight
+		} else if l.IOWeight > max.IOWeight {
+			return fmt.Errorf("io weight %d exceeds the profile one %d", l.IOWeight, max.IOWeight)
+		}
+	}
+
+	if max.MaxSwapBytes != nil {
+		if l.MaxSwapBytes == nil {
+			l.MaxSwapBytes = max.MaxSwapBytes
+		} else if *l.MaxSwapBytes > *max.MaxSwapBytes {
+			return fmt.Errorf("swap limit %d exceeds the profile one %d", *l.MaxSwapBytes, *max.MaxSwapBytes)
+		}
+	}
+
+	for _, v := range []struct {
+		name  string
+		value *int64
+		max   int64
+	}{
+		{"memory limit", &l.MaxRAMBytes, max.MaxRAMBytes},
+		{"memory high limit", &l.HighRAMBytes, max.HighRAMBytes},
+		{"memory low protection", &l.LowRAMBytes, max.LowRAMBytes},
+		{"memory min protection", &l.MinRAMBytes, max.MinRAMBytes},
+		{"io limit", &l.MaxDiskIOBytes, max.MaxDiskIOBytes},
+		{"disk limit", &l.MaxDiskBytes, max.MaxDiskBytes},
+	} {
+		if err := ceiling(v.name, v.value, v.max); err != nil {
+			return err
+		}
+	}
+
+	for _, d := range l.Devices {
+		if err := p.limitDevice(d); err != nil {
+			return err
+		}
+	}
+	// the job device limits are applied after the profile ones, lowering them
+	if len(max.Devices) > 0 {
+		l.Devices = append(append([]job.DeviceIOLimit{}, max.Devices...), l.Devices...)
+	}
+
+	return nil
+}
+
+// limitDevice checks job device limit d doesn't exceed the profile limits of the device. Devices named
+// differently may be the same, so a device the profile doesn't name is checked against all its device limits.
+func (p profile) limitDevice(d job.DeviceIOLimit) error {
+	named := false
+	for _, m := range p.limits.Devices {
+		if m.Device == d.Device {
+			named = true
+		}
+	}
+
+	for _, m := range p.limits.Devices {
+		if named && m.Device != d.Device && m.Device != job.AllDevices && d.Device != job.AllDevices {
+			continue
+		}
+		if err := limitDeviceRates(d, m); err != nil {
+			return err
+		}
+	}
+
+	// per-device limits override the disk IO limit
+	io := p.limits.MaxDiskIOBytes
+	return limitDeviceRates(d, job.DeviceIOLimit{Device: job.AllDevices, ReadBPS: io, WriteBPS: io})
+}
+
+// limitDeviceRates checks device limit d doesn't exceed the limit m.
+func limitDeviceRates(d, m job.DeviceIOLimit) error {
+	for _, v := range []struct {
+		name     string
+		value    int64
+		maxValue int64
+	}{
+		{"read rate", d.ReadBPS, m.ReadBPS},
+		{"write rate", d.WriteBPS, m.WriteBPS},
+		{"read iops", d.ReadIOPS, m.ReadIOPS},
+		{"write iops", d.WriteIOPS, m.WriteIOPS},
+	} {
+		if v.maxValue > 0 && v.value > v.maxValue {
+			return fmt.Errorf("%s limit %d of device %q exceeds the profile one %d for %q",
+				v.name, v.value, d.Device, v.maxValue, m.Device)
+		}
+	}
+	return nil
+}
+
+// ceiling checks the job limit value doesn't exceed the profile limit max, and sets it if the job
+// didn't request it. Zero means no limit.
+func ceiling(name string, value *int64, max int64) error {
+	if max == 0 {
+		return nil
+	}
+	if *value == 0 {
+		*value = max
+		return nil
+	}
+	if *value > max {
+		return fmt.Errorf("%s %d exceeds the profile one %d", name, *value, max)
+	}
+	return nil
+}
+
+// hasNamespace checks namespace ns is in the list.
+func hasNamespace(list []job.Namespace, ns job.Namespace) bool {
+	for _, n := range list {
+		if n == ns {
+			return true
+		}
+	}
+	return false
+}
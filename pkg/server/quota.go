@@ -0,0 +1,130 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	pb "github.com/ilyazz/jobs/pkg/api/grpc/jobs/v1"
+	"github.com/ilyazz/jobs/pkg/supervisor"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// quotaPolicy limits what the jobs of each client may hold.
+type quotaPolicy struct {
+	// quotas are the client quotas. '*' is the quota of clients not listed
+	quotas map[string]QuotaConfig
+
+	// locks serialize the quota checks and job starts of each client
+	lock  sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+// newQuotaPolicy checks the configured quotas.
+func newQuotaPolicy(cfg map[string]QuotaConfig) (*quotaPolicy, error) {
+	for user, q := range cfg {
+		if q.ActiveJobs < 0 || q.CPU < 0 || q.Memory < 0 || q.RetainedJobs < 0 {
+			return nil, fmt.Errorf("negative quota of %q", user)
+		}
+	}
+
+	return &quotaPolicy{quotas: cfg, locks: make(map[string]*sync.Mutex)}, nil
+}
+
+// limits returns the quota of user uid.
+func (p *quotaPolicy) limits(uid string) QuotaConfig {
+	if q, ok := p.quotas[uid]; ok {
+		return q
+	}
+	return p.quotas["*"]
+}
+
+// acquire locks the quota of user uid, until the returned function is called.
+func (p *quotaPolicy) acquire(uid string) func() {
+	p.lock.Lock()
+	l, ok := p.locks[uid]
+	if !ok {
+		l = &sync.Mutex{}
+		p.locks[uid] = l
+	}
+	p.lock.Unlock()
+
+	l.Lock()
+	return l.Unlock
+}
+
+// check returns an error if n new jobs of user uid, with spec each, exceed the user quota, given the usage.
+func (p *quotaPolicy) check(uid string, usage supervisor.Usage, spec supervisor.Spec, n int) error {
+	q := p.limits(uid)
+	total := charge(usage, spec, n)
+
+	switch {
+	case q.CPU > 0 && spec.Limits.CPU == 0:
+		return fmt.Errorf("cpu quota is set, the job must have a cpu limit")
+	case q.Memory > 0 && spec.Limits.MaxRAMBytes == 0:
+		return fmt.Errorf("memory quota is set, the job must have a memory limit")
+	case q.ActiveJobs > 0 && total.Active > q.ActiveJobs:
+		return fmt.Errorf("active jobs quota exceeded: %d used, %d requested of %d", usage.Active, n, q.ActiveJobs)
+	case q.CPU > 0 && total.CPU > q.CPU:
+		return fmt.Errorf("cpu quota exceeded: %.2f used, %.2f requested of %.2f", usage.CPU, total.CPU-usage.CPU, q.CPU)
+	case q.Memory > 0 && total.Memory > q.Memory:
+		return fmt.Errorf("memory quota exceeded: %d bytes used, %d requested of %d",
+			usage.Memory, total.Memory-usage.Memory, q.Memory)
+	}
+
+	return nil
+}
+
+// makeRoom removes the oldest completed jobs of user uid over the retained jobs quota, given the usage,
+// so that a new job fits it. Returns an error if they can't be removed.
+func (j *JobServer) makeRoom(uid string, usage supervisor.Usage) error {
+	q := j.quotas.limits(uid)
+	if q.RetainedJobs == 0 || usage.Retained < q.RetainedJobs {
+		return nil
+	}
+
+	n := usage.Retained - q.RetainedJobs + 1
+	pruned := j.jobs.PruneOldest(uid, n)
+	log.Info().Str("client", uid).Int("jobs", len(pruned)).Msg("completed jobs over the quota pruned")
+
+	if len(pruned) < n {
+		return fmt.Errorf("retained jobs quota exceeded: %d of %d, remove completed jobs", usage.Retained-len(pruned), q.RetainedJobs)
+	}
+	return nil
+}
+
+// charge returns usage with n more active jobs, with spec each.
+func charge(usage supervisor.Usage, spec supervisor.Spec, n int) supervisor.Usage {
+	usage.Active += n
+	usage.CPU += spec.Limits.CPU * float32(n)
+	usage.Memory += spec.Limits.MaxRAMBytes * int64(n)
+	return usage
+}
+
+// Quota implements API Quota method. Returns the quota, and the usage of the calling client
+func (j *JobServer) Quota(ctx context.Context, _ *pb.QuotaRequest) (*pb.QuotaResponse, error) {
+	cid, ok := authID(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "invalid client ID")
+	}
+
+	q := j.quotas.limits(cid)
+	u := j.jobs.Usage(cid)
+
+	return &pb.QuotaResponse{
+		Quota: &pb.QuotaValues{
+			ActiveJobs:   int32(q.ActiveJobs),
+			Cpu:          q.CPU,
+			Memory:       q.Memory,
+			RetainedJobs: int32(q.RetainedJobs),
+		},
+		Usage: &pb.QuotaValues{
+			ActiveJobs:   int32(u.Active),
+			Cpu:          u.CPU,
+			Memory:       u.Memory,
+			RetainedJobs: int32(u.Retained),
+		},
+	}, nil
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"time"
+
+	pb "github.com/ilyazz/jobs/pkg/api/grpc/jobs/v1"
+	"github.com/ilyazz/jobs/pkg/job"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// toRestartPolicy converts job restart policy from PB to internal format
+func toRestartPolicy(p *pb.RestartPolicy) job.RestartPolicy {
+	return job.RestartPolicy{
+		Mode:       toRestartMode(p.GetMode()),
+		MaxRetries: int(p.GetMaxRetries()),
+		Backoff:    time.Duration(p.GetBackoffMs()) * time.Millisecond,
+		MaxBackoff: time.Duration(p.GetMaxBackoffMs()) * time.Millisecond,
+	}
+}
+
+// toRestartMode converts restart mode from PB to internal format
+func toRestartMode(m pb.RestartMode) job.RestartMode {
+	switch m {
+	case pb.RestartMode_RESTART_MODE_ON_FAILURE:
+		return job.RestartOnFailure
+	case pb.RestartMode_RESTART_MODE_ALWAYS:
+		return job.RestartAlways
+	default:
+		return job.RestartNever
+	}
+}
+
+// fromRestartPolicy converts job restart policy from internal format to PB
+func fromRestartPolicy(p job.RestartPolicy) *pb.RestartPolicy {
+	rt := &pb.RestartPolicy{
+		Mode:         pb.RestartMode_RESTART_MODE_NEVER,
+		MaxRetries:   int32(p.MaxRetries),
+		BackoffMs:    p.Backoff.Milliseconds(),
+		MaxBackoffMs: p.MaxBackoff.Milliseconds(),
+	}
+
+	switch p.Mode {
+	case job.RestartOnFailure:
+		rt.Mode = pb.RestartMode_RESTART_MODE_ON_FAILURE
+	case job.RestartAlways:
+		rt.Mode = pb.RestartMode_RESTART_MODE_ALWAYS
+	}
+	return rt
+}
+
+// fromAttempts converts the job attempts history from internal format to PB
+func fromAttempts(attempts []job.Attempt) []*pb.Attempt {
+	var rt []*pb.Attempt
+	for _, a := range attempts {
+		pa := &pb.Attempt{
+			Started:  timestamppb.New(a.Started),
+			ExitCode: int32(a.ExitCode),
+			Error:    a.Error,
+			LogSize:  a.LogSize,
+		}
+		if !a.Ended.IsZero() {
+			pa.Ended = timestamppb.New(a.Ended)
+		}
+		rt = append(rt, pa)
+	}
+	return rt
+}
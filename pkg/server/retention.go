@@ -0,0 +1,40 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/ilyazz/jobs/pkg/acl"
+	pb "github.com/ilyazz/jobs/pkg/api/grpc/jobs/v1"
+	"github.com/ilyazz/jobs/pkg/job"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Prune implements API Prune method. Removes the completed jobs the client has started
+func (j *JobServer) Prune(ctx context.Context, req *pb.PruneRequest) (*pb.PruneResponse, error) {
+	cid, ok := authID(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "invalid client ID")
+	}
+
+	if req.OlderThanMs < 0 {
+		return nil, status.Error(codes.InvalidArgument, "negative age")
+	}
+
+	rsp := &pb.PruneResponse{}
+	for _, id := range j.jobs.Prune(cid, time.Duration(req.OlderThanMs)*time.Millisecond) {
+		rsp.JobIds = append(rsp.JobIds, string(id))
+	}
+
+	log.Info().Str("client", cid).Int("jobs", len(rsp.JobIds)).Msg("jobs pruned")
+	return rsp, nil
+}
+
+// removed drops the ACL entry of job id, removed by the supervisor
+func (j *JobServer) removed(id job.ID) {
+	if err := j.auth.Remove(acl.ObjectID(id)); err != nil {
+		log.Warn().Err(err).Str("id", string(id)).Msg("failed to update ACL")
+	}
+}
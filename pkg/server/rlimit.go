@@ -0,0 +1,98 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+
+	pb "github.com/ilyazz/jobs/pkg/api/grpc/jobs/v1"
+	"github.com/ilyazz/jobs/pkg/job"
+)
+
+// rlimitPolicy defines default and max POSIX resource limits of job processes.
+type rlimitPolicy struct {
+	// defaults are applied if the job doesn't request the resource
+	defaults map[string]job.Rlimit
+	// max are the highest values a job may request. If not set for a resource,
+	// the server's own hard limit is used
+	max map[string]job.Rlimit
+}
+
+// newRlimitPolicy parses the configured rlimits. Core dumps are disabled by default.
+func newRlimitPolicy(defaults, max map[string]string) (*rlimitPolicy, error) {
+	rt := &rlimitPolicy{
+		defaults: map[string]job.Rlimit{
+			"core": {Resource: "core"},
+		},
+		max: make(map[string]job.Rlimit),
+	}
+
+	for res, v := range defaults {
+		r, err := job.ParseRlimit(res, v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid default rlimit: %w", err)
+		}
+		rt.defaults[res] = r
+	}
+
+	for res, v := range max {
+		r, err := job.ParseRlimit(res, v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid max rlimit: %w", err)
+		}
+		rt.max[res] = r
+	}
+
+	for res, r := range rt.defaults {
+		if err := rt.check(r); err != nil {
+			return nil, fmt.Errorf("invalid default rlimit %s: %w", res, err)
+		}
+	}
+
+	return rt, nil
+}
+
+// check verifies the limit doesn't exceed the max value.
+func (p *rlimitPolicy) check(r job.Rlimit) error {
+	if err := r.Validate(); err != nil {
+		return err
+	}
+
+	max, ok := p.max[r.Resource]
+	if !ok {
+		cur, err := job.CurrentRlimit(r.Resource)
+		if err != nil {
+			return err
+		}
+		max = cur
+	}
+
+	if r.Hard > max.Hard {
+		return fmt.Errorf("%w: %s limit exceeds max value %s", job.ErrInvalidRlimit, r.Resource, max)
+	}
+
+	return nil
+}
+
+// apply merges the requested limits with defaults, and checks them against max values.
+func (p *rlimitPolicy) apply(req []*pb.Rlimit) ([]job.Rlimit, error) {
+	limits := make(map[string]job.Rlimit)
+	for res, r := range p.defaults {
+		limits[res] = r
+	}
+
+	for _, r := range req {
+		l := job.Rlimit{Resource: r.Resource, Soft: r.Soft, Hard: r.Hard}
+		if err := p.check(l); err != nil {
+			return nil, err
+		}
+		limits[r.Resource] = l
+	}
+
+	var rt []job.Rlimit
+	for _, l := range limits {
+		rt = append(rt, l)
+	}
+	sort.Slice(rt, func(i, j int) bool { return rt[i].Resource < rt[j].Resource })
+
+	return rt, nil
+}
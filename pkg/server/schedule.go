@@ -0,0 +1,168 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/ilyazz/jobs/pkg/acl"
+	pb "github.com/ilyazz/jobs/pkg/api/grpc/jobs/v1"
+	"github.com/ilyazz/jobs/pkg/job"
+	"github.com/ilyazz/jobs/pkg/supervisor"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// CreateSchedule implements API CreateSchedule method. The job is checked now, and at each run again,
+// on behalf of the client
+func (j *JobServer) CreateSchedule(ctx context.Context, req *pb.CreateScheduleRequest) (*pb.CreateScheduleResponse, error) {
+	cid, ok := authID(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "invalid client ID")
+	}
+
+	if req.Job == nil {
+		return nil, status.Error(codes.InvalidArgument, "job required")
+	}
+	if req.Job.Array != nil {
+		return nil, status.Error(codes.InvalidArgument, "array jobs can't be scheduled")
+	}
+	if _, err := j.toSpec(cid, req.Job); err != nil {
+		return nil, err
+	}
+
+	data, err := proto.Marshal(req.Job)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	d, err := j.jobs.CreateSchedule(supervisor.Schedule{
+		Cron:        req.Cron,
+		Concurrency: toConcurrencyPolicy(req.Concurrency),
+		Owner:       cid,
+		Job:         data,
+	})
+	switch {
+	case errors.Is(err, supervisor.ErrInvalidSchedule):
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	case err != nil:
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	_ = j.auth.SetOwner(acl.ObjectID(d.ID), acl.UserID(cid))
+	return &pb.CreateScheduleResponse{Schedule: fromSchedule(d)}, nil
+}
+
+// ListSchedules implements API ListSchedules method. Lists the schedules the client has access to
+func (j *JobServer) ListSchedules(ctx context.Context, _ *pb.ListSchedulesRequest) (*pb.ListSchedulesResponse, error) {
+	cid, ok := authID(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "invalid client ID")
+	}
+
+	rt := &pb.ListSchedulesResponse{}
+	for _, d := range j.jobs.ListSchedules() {
+		if j.hasReadAccess(cid, string(d.ID)) {
+			rt.Schedules = append(rt.Schedules, fromSchedule(d))
+		}
+	}
+	return rt, nil
+}
+
+// DeleteSchedule implements API DeleteSchedule method
+func (j *JobServer) DeleteSchedule(ctx context.Context, req *pb.DeleteScheduleRequest) (*pb.DeleteScheduleResponse, error) {
+	cid, ok := authID(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "invalid client ID")
+	}
+
+	if !j.hasFullAccess(cid, req.ScheduleId) {
+		log.Info().Str("client", cid).Str("schedule", req.ScheduleId).Msg("no access")
+		return nil, status.Error(codes.NotFound, "schedule not found")
+	}
+
+	err := j.jobs.DeleteSchedule(supervisor.ScheduleID(req.ScheduleId))
+	switch {
+	case errors.Is(err, supervisor.ErrScheduleNotFound):
+		return nil, status.Error(codes.NotFound, "schedule not found")
+	case err != nil:
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &pb.DeleteScheduleResponse{}, nil
+}
+
+// launch starts a run of schedule sc on behalf of its owner. It's the supervisor launcher
+func (j *JobServer) launch(sc supervisor.Schedule) (job.ID, error) {
+	var req pb.StartRequest
+	if err := proto.Unmarshal(sc.Job, &req); err != nil {
+		return "", err
+	}
+
+	id, err := j.start(sc.Owner, &req)
+	if err != nil {
+		return "", errors.New(status.Convert(err).Message())
+	}
+	return id, nil
+}
+
+// restoreSchedules gives the owners of the loaded schedules access to them
+func (j *JobServer) restoreSchedules() {
+	for _, d := range j.jobs.ListSchedules() {
+		_ = j.auth.SetOwner(acl.ObjectID(d.ID), acl.UserID(d.Owner))
+	}
+}
+
+// toConcurrencyPolicy converts the schedule concurrency policy from PB to internal format
+func toConcurrencyPolicy(p pb.ConcurrencyPolicy) supervisor.ConcurrencyPolicy {
+	switch p {
+	case pb.ConcurrencyPolicy_CONCURRENCY_POLICY_FORBID:
+		return supervisor.ConcurrencyForbid
+	case pb.ConcurrencyPolicy_CONCURRENCY_POLICY_REPLACE:
+		return supervisor.ConcurrencyReplace
+	default:
+		return supervisor.ConcurrencyAllow
+	}
+}
+
+// fromConcurrencyPolicy converts the schedule concurrency policy from internal format to PB
+func fromConcurrencyPolicy(p supervisor.ConcurrencyPolicy) pb.ConcurrencyPolicy {
+	switch p {
+	case supervisor.ConcurrencyForbid:
+		return pb.ConcurrencyPolicy_CONCURRENCY_POLICY_FORBID
+	case supervisor.ConcurrencyReplace:
+		return pb.ConcurrencyPolicy_CONCURRENCY_POLICY_REPLACE
+	default:
+		return pb.ConcurrencyPolicy_CONCURRENCY_POLICY_ALLOW
+	}
+}
+
+// fromSchedule converts the schedule details from internal format to PB
+func fromSchedule(d supervisor.ScheduleDetails) *pb.Schedule {
+	rt := &pb.Schedule{
+		Id:          string(d.ID),
+		Cron:        d.Cron,
+		Concurrency: fromConcurrencyPolicy(d.Concurrency),
+		LastJobId:   string(d.LastJob),
+		LastError:   d.LastError,
+	}
+
+	var req pb.StartRequest
+	if err := proto.Unmarshal(d.Job, &req); err == nil {
+		rt.Command = strings.Join(append([]string{req.Command}, req.Args...), " ")
+	}
+
+	if !d.NextRun.IsZero() {
+		rt.NextRun = timestamppb.New(d.NextRun)
+	}
+	if !d.LastRun.IsZero() {
+		rt.LastRun = timestamppb.New(d.LastRun)
+	}
+	for _, id := range d.Active {
+		rt.ActiveJobIds = append(rt.ActiveJobIds, string(id))
+	}
+	return rt
+}
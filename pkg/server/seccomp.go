@@ -0,0 +1,96 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/ilyazz/jobs/pkg/seccomp"
+)
+
+// unconfinedProfile is the profile name to run jobs without syscall filtering.
+const unconfinedProfile = "unconfined"
+
+// seccompProfile is an admin-defined profile.
+type seccompProfile struct {
+	// path is the profile file
+	path string
+	// users may run jobs with the profile. '*' matches all users
+	users []string
+}
+
+// seccompPolicy defines the syscall filtering profiles jobs may use, and who may use them.
+type seccompPolicy struct {
+	// def is the profile of jobs not requesting one
+	def string
+	// profiles are admin-defined profiles: name -> profile
+	profiles map[string]seccompProfile
+	// unconfined are the users who may run jobs without filtering
+	unconfined []string
+}
+
+// newSeccompPolicy checks the configured profiles load and compile.
+func newSeccompPolicy(def string, cfg map[string]SeccompConfig, unconfined []string) (*seccompPolicy, error) {
+	if def == "" {
+		def = seccomp.DefaultProfile
+	}
+
+	rt := &seccompPolicy{def: def, profiles: make(map[string]seccompProfile), unconfined: unconfined}
+
+	for name, pc := range cfg {
+		if name == seccomp.DefaultProfile || name == unconfinedProfile {
+			return nil, fmt.Errorf("seccomp profile %q: reserved name", name)
+		}
+
+		if _, err := seccomp.Load(pc.Path); err != nil {
+			return nil, fmt.Errorf("seccomp profile %q: %w", name, err)
+		}
+
+		rt.profiles[name] = seccompProfile{path: pc.Path, users: pc.Users}
+	}
+
+	if _, ok := rt.profiles[def]; !ok && def != seccomp.DefaultProfile && def != unconfinedProfile {
+		return nil, fmt.Errorf("unknown default seccomp profile: %q", def)
+	}
+
+	return rt, nil
+}
+
+// resolve checks user uid may use the requested profile, and returns the profile name and file.
+// The name is empty if the job is unconfined, the file is empty for the built-in profile.
+func (p *seccompPolicy) resolve(uid string, name string) (string, string, error) {
+	// the configured default is allowed to all users
+	requested := name != ""
+	if !requested {
+		name = p.def
+	}
+
+	switch name {
+	case seccomp.DefaultProfile:
+		return name, "", nil
+	case unconfinedProfile:
+		if requested && !allowed(p.unconfined, uid) {
+			return "", "", fmt.Errorf("unconfined jobs are not allowed")
+		}
+		return "", "", nil
+	}
+
+	sp, ok := p.profiles[name]
+	if !ok {
+		return "", "", fmt.Errorf("unknown seccomp profile: %q", name)
+	}
+
+	if requested && !allowed(sp.users, uid) {
+		return "", "", fmt.Errorf("seccomp profile %q is not allowed", name)
+	}
+
+	return name, sp.path, nil
+}
+
+// allowed checks user uid is in users list, directly or via '*'.
+func allowed(users []string, uid string) bool {
+	for _, u := range users {
+		if u == uid || u == anyUser {
+			return true
+		}
+	}
+	return false
+}
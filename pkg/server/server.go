@@ -5,22 +5,54 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/ilyazz/jobs/pkg/acl"
 	pb "github.com/ilyazz/jobs/pkg/api/grpc/jobs/v1"
+	"github.com/ilyazz/jobs/pkg/image"
 	"github.com/ilyazz/jobs/pkg/job"
+	"github.com/ilyazz/jobs/pkg/network"
 	"github.com/ilyazz/jobs/pkg/supervisor"
 	"github.com/rs/zerolog/log"
+	"golang.org/x/sys/unix"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 // JobServer implements protobuf Jobs API
 type JobServer struct {
-	jobs *supervisor.JobSupervisor
-	auth *acl.AccessControl
+	jobs    *supervisor.JobSupervisor
+	auth    *acl.AccessControl
+	rlimits *rlimitPolicy
+	// images are the root filesystems available for jobs: name -> directory
+	images map[string]string
+	// volumes are the host paths available for jobs
+	volumes *volumePolicy
+	// network is the bridge network of jobs
+	network *network.Manager
+	// egress are the outbound traffic policy defaults and ceiling
+	egress network.EgressLimits
+	// ports are the host ports jobs may publish
+	ports *portPolicy
+	// identities are UIDs/GIDs clients may run jobs with
+	identities *identityPolicy
+	// userNS is set if jobs run in their own user namespaces
+	userNS bool
+	// seccomp are the syscall filtering profiles of jobs
+	seccomp *seccompPolicy
+	// caps are the capabilities jobs may keep
+	caps *capabilityPolicy
+	// profiles are the isolation profiles of jobs
+	profiles *profilePolicy
+	// priorities are the queue priorities clients may request
+	priorities *priorityPolicy
+	// quotas limit what the jobs of each client may hold
+	quotas *quotaPolicy
 
 	pb.UnimplementedJobServiceServer
 }
@@ -52,29 +84,436 @@ func (j *JobServer) Start(ctx context.Context, req *pb.StartRequest) (*pb.StartR
 		return nil, status.Error(codes.Unauthenticated, "invalid client ID")
 	}
 
-	jid, err := j.jobs.Start(req.Command, req.Args, toJobLimits(req.Limits))
-	switch {
-	case errors.Is(err, supervisor.ErrNotFound):
-		return nil, status.Error(codes.NotFound, "job not found")
-	case err != nil:
-		return nil, status.Error(codes.Internal, err.Error())
+	start := j.start
+	if req.Array != nil {
+		start = j.startArray
+	}
+
+	jid, err := start(cid, req)
+	if err != nil {
+		return nil, err
 	}
 
-	_ = j.auth.SetOwner(acl.ObjectID(jid), acl.UserID(cid))
 	return &pb.StartResponse{
 		JobId: string(jid),
 	}, nil
 }
 
+// start starts job req on behalf of user cid. Returns gRPC errors
+func (j *JobServer) start(cid string, req *pb.StartRequest) (job.ID, error) {
+	spec, err := j.toSpec(cid, req)
+	if err != nil {
+		return "", err
+	}
+
+	// the usage must not change until the job is started
+	release := j.quotas.acquire(cid)
+	defer release()
+
+	usage := j.jobs.Usage(cid)
+	if err := j.quotas.check(cid, usage, spec, 1); err != nil {
+		return "", status.Error(codes.ResourceExhausted, err.Error())
+	}
+	if err := j.makeRoom(cid, usage); err != nil {
+		return "", status.Error(codes.ResourceExhausted, err.Error())
+	}
+	spec.Owner = cid
+
+	if err := j.connect(cid, &spec, req); err != nil {
+		return "", err
+	}
+
+	jid, err := j.jobs.Start(spec)
+	if err != nil {
+		return "", startError(err)
+	}
+
+	_ = j.auth.SetOwner(acl.ObjectID(jid), acl.UserID(cid))
+	return jid, nil
+}
+
+// toSpec checks user cid may start job req, and converts it to the supervisor format.
+// The job network endpoint is not allocated yet
+func (j *JobServer) toSpec(cid string, req *pb.StartRequest) (supervisor.Spec, error) {
+	rlimits, err := j.rlimits.apply(req.Rlimits)
+	if err != nil {
+		return supervisor.Spec{}, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	priority, preempt, err := j.priorities.resolve(cid, req.PriorityClass)
+	if err != nil {
+		return supervisor.Spec{}, status.Error(codes.PermissionDenied, err.Error())
+	}
+
+	if req.TtlMs < 0 {
+		return supervisor.Spec{}, status.Error(codes.InvalidArgument, "negative TTL")
+	}
+	if req.Remove && req.TtlMs > 0 {
+		return supervisor.Spec{}, status.Error(codes.InvalidArgument, "TTL is set for a job removed once it's completed")
+	}
+
+	var rootFS string
+	if req.Image != "" {
+		var ok bool
+		rootFS, ok = j.images[req.Image]
+		if !ok {
+			return supervisor.Spec{}, status.Errorf(codes.InvalidArgument, "unknown image: %q", req.Image)
+		}
+	}
+
+	volumes, err := j.volumes.resolve(cid, req.Volumes)
+	if err != nil {
+		return supervisor.Spec{}, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	var ids *job.ExecIdentity
+	if j.userNS {
+		if req.RunAsUser != "" || req.RunAsGroup != "" {
+			return supervisor.Spec{}, status.Error(codes.InvalidArgument, "jobs run as root in user namespaces")
+		}
+	} else {
+		runAs, err := j.identities.resolve(cid, req.RunAsUser, req.RunAsGroup)
+		if err != nil {
+			return supervisor.Spec{}, status.Error(codes.PermissionDenied, err.Error())
+		}
+		ids = &runAs
+	}
+
+	profile, profilePath, err := j.seccomp.resolve(cid, req.SeccompProfile)
+	if err != nil {
+		return supervisor.Spec{}, status.Error(codes.PermissionDenied, err.Error())
+	}
+
+	caps, err := j.caps.resolve(cid, req.Capabilities)
+	if errors.Is(err, job.ErrInvalidCapability) {
+		return supervisor.Spec{}, status.Error(codes.InvalidArgument, err.Error())
+	} else if err != nil {
+		return supervisor.Spec{}, status.Error(codes.PermissionDenied, err.Error())
+	}
+
+	var namespaces []job.Namespace
+	if req.Namespaces != nil {
+		namespaces, err = job.ParseNamespaces(strings.Join(req.Namespaces.Names, ","))
+		if err != nil {
+			return supervisor.Spec{}, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+
+	spec := supervisor.Spec{
+		Command:          req.Command,
+		Args:             req.Args,
+		Limits:           toJobLimits(req.Limits),
+		PressureTriggers: toPressureTriggers(req.PressureTriggers),
+		Rlimits:          rlimits,
+		RootFS:           rootFS,
+		Volumes:          volumes,
+		Network:          toNetMode(req.Network),
+		IDs:              ids,
+		Seccomp:          profile,
+		SeccompPath:      profilePath,
+		Caps:             caps,
+		Hostname:         req.Hostname,
+		Namespaces:       namespaces,
+		Restart:          toRestartPolicy(req.Restart),
+		Priority:         priority,
+		Preempt:          preempt,
+		TTL:              time.Duration(req.TtlMs) * time.Millisecond,
+		AutoRemove:       req.Remove,
+	}
+
+	prof, err := j.profiles.resolve(cid, req.Profile)
+	if err != nil {
+		return supervisor.Spec{}, status.Error(codes.PermissionDenied, err.Error())
+	}
+	if err := prof.apply(&spec); err != nil {
+		return supervisor.Spec{}, status.Error(codes.PermissionDenied, err.Error())
+	}
+
+	// the egress ceiling is enforced in the job network namespace, a host network job would bypass it
+	if spec.Network == job.NetHost && !j.egress.Max.Empty() {
+		return supervisor.Spec{}, status.Error(codes.PermissionDenied, "host network is not allowed with the egress policy ceiling")
+	}
+
+	return spec, nil
+}
+
+// connect allocates the network endpoint of job spec, requested by req on behalf of user cid, in bridge network mode.
+func (j *JobServer) connect(cid string, spec *supervisor.Spec, req *pb.StartRequest) error {
+	switch {
+	case spec.Network == job.NetBridge:
+		requested, err := toEgressPolicy(req.Egress)
+		if err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+		egress, err := j.egress.Resolve(requested)
+		if err != nil {
+			return status.Error(codes.PermissionDenied, err.Error())
+		}
+		// the job could flush the policy rules
+		if !egress.Empty() && hasCapability(spec.Caps, job.Capability(unix.CAP_NET_ADMIN)) {
+			return status.Error(codes.PermissionDenied, "NET_ADMIN capability is not allowed with an egress policy")
+		}
+
+		ports := toPorts(req.Ports)
+		if err := j.ports.check(cid, ports); err != nil {
+			return status.Error(codes.PermissionDenied, err.Error())
+		}
+
+		ep, err := j.network.Endpoint(ports, egress)
+		if err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+		spec.Endpoint = ep
+	case len(req.Ports) > 0:
+		return status.Error(codes.InvalidArgument, "ports may be published in bridge network mode only")
+	case len(req.Egress.GetAllow()) > 0 || len(req.Egress.GetDeny()) > 0:
+		return status.Error(codes.InvalidArgument, "egress policy is supported in bridge network mode only")
+	}
+
+	return nil
+}
+
+// hasCapability checks if c is in caps
+func hasCapability(caps []job.Capability, c job.Capability) bool {
+	for _, cc := range caps {
+		if cc == c {
+			return true
+		}
+	}
+	return false
+}
+
+// startError converts the job start error to the gRPC one
+func startError(err error) error {
+	switch {
+	case errors.Is(err, supervisor.ErrNotFound):
+		return status.Error(codes.NotFound, "job not found")
+	case errors.Is(err, network.ErrPortInUse), errors.Is(err, network.ErrNoAddress):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, supervisor.ErrNoIDRange):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, supervisor.ErrExceedsCapacity):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, job.ErrInvalidLimits), errors.Is(err, job.ErrInvalidTrigger), errors.Is(err, job.ErrInvalidRlimit),
+		errors.Is(err, job.ErrInvalidMount), errors.Is(err, job.ErrInvalidNetwork), errors.Is(err, job.ErrInvalidNamespace),
+		errors.Is(err, job.ErrInvalidRestartPolicy):
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
 // toJobLimits converts job limits object from PB to internal format
 func toJobLimits(limits *pb.Limits) job.ExecLimits {
+	var devices []job.DeviceIOLimit
+	for _, d := range limits.GetDevices() {
+		devices = append(devices, job.DeviceIOLimit{
+			Device:    d.Device,
+			ReadBPS:   d.ReadBps,
+			WriteBPS:  d.WriteBps,
+			ReadIOPS:  d.ReadIops,
+			WriteIOPS: d.WriteIops,
+		})
+	}
+
 	return job.ExecLimits{
-		CPU:            limits.Cpus,
-		MaxDiskIOBytes: limits.Io,
-		MaxRAMBytes:    limits.Memory,
+		CPU:            limits.GetCpus(),
+		MaxDiskIOBytes: limits.GetIo(),
+		MaxRAMBytes:    limits.GetMemory(),
+		HighRAMBytes:   limits.GetMemoryHigh(),
+		LowRAMBytes:    limits.GetMemoryLow(),
+		MinRAMBytes:    limits.GetMemoryMin(),
+		MaxSwapBytes:   limits.Swap,
+		Devices:        devices,
+		IOWeight:       int(limits.GetIoWeight()),
+		MaxDiskBytes:   limits.GetDisk(),
 	}
 }
 
+// toNetMode converts job network mode from PB to internal format
+func toNetMode(m pb.NetworkMode) job.NetMode {
+	switch m {
+	case pb.NetworkMode_NETWORK_MODE_HOST:
+		return job.NetHost
+	case pb.NetworkMode_NETWORK_MODE_BRIDGE:
+		return job.NetBridge
+	default:
+		return job.NetNone
+	}
+}
+
+// fromNetMode converts job network mode from internal format to PB
+func fromNetMode(m job.NetMode) pb.NetworkMode {
+	switch m {
+	case job.NetHost:
+		return pb.NetworkMode_NETWORK_MODE_HOST
+	case job.NetBridge:
+		return pb.NetworkMode_NETWORK_MODE_BRIDGE
+	default:
+		return pb.NetworkMode_NETWORK_MODE_NONE
+	}
+}
+
+// toPorts converts published ports from PB to internal format. Out of range ports are zeroed,
+// to fail the validation
+func toPorts(ports []*pb.Port) []network.Port {
+	var rt []network.Port
+	for _, p := range ports {
+		np := network.Port{Protocol: p.Protocol}
+		if np.Protocol == "" {
+			np.Protocol = "tcp"
+		}
+		if p.HostPort <= math.MaxUint16 {
+			np.Host = uint16(p.HostPort)
+		}
+		if p.JobPort <= math.MaxUint16 {
+			np.Job = uint16(p.JobPort)
+		}
+		rt = append(rt, np)
+	}
+	return rt
+}
+
+// toEgressPolicy converts outbound traffic policy from PB to internal format
+func toEgressPolicy(p *pb.EgressPolicy) (*network.EgressPolicy, error) {
+	if p == nil {
+		return nil, nil
+	}
+
+	allow, err := network.ParseRules(p.Allow)
+	if err != nil {
+		return nil, err
+	}
+	deny, err := network.ParseRules(p.Deny)
+	if err != nil {
+		return nil, err
+	}
+
+	return &network.EgressPolicy{Allow: allow, Deny: deny}, nil
+}
+
+// toPressureTriggers converts PSI triggers from PB to internal format
+func toPressureTriggers(triggers []*pb.PressureTrigger) []job.PressureTrigger {
+	var rt []job.PressureTrigger
+	for _, t := range triggers {
+		rt = append(rt, job.PressureTrigger{
+			Resource: t.Resource,
+			Full:     t.Full,
+			Stall:    time.Duration(t.StallUs) * time.Microsecond,
+			Window:   time.Duration(t.WindowUs) * time.Microsecond,
+			Stop:     t.Stop,
+		})
+	}
+	return rt
+}
+
+// fromPressureTrigger converts PSI trigger from internal format to PB
+func fromPressureTrigger(t job.PressureTrigger) *pb.PressureTrigger {
+	return &pb.PressureTrigger{
+		Resource: t.Resource,
+		Full:     t.Full,
+		StallUs:  t.Stall.Microseconds(),
+		WindowUs: t.Window.Microseconds(),
+		Stop:     t.Stop,
+	}
+}
+
+// fromPressureAvg converts PSI averages from internal format to PB
+func fromPressureAvg(a job.PressureAvg) *pb.PressureAvg {
+	return &pb.PressureAvg{
+		Avg10:   a.Avg10,
+		Avg60:   a.Avg60,
+		Avg300:  a.Avg300,
+		TotalUs: a.Total.Microseconds(),
+	}
+}
+
+// fromJobDetails converts job details from internal format to PB
+func fromJobDetails(d job.Details) *pb.Details {
+	rt := &pb.Details{
+		Command:        strings.Join(d.Command, " "),
+		Status:         fromJobStatus(d.Status),
+		ExitCode:       int32(d.ExitCode),
+		DiskUsage:      d.DiskUsageBytes,
+		DiskLimit:      d.DiskLimitBytes,
+		Network:        fromNetMode(d.Network),
+		Address:        d.Address,
+		Egress:         d.Egress,
+		Uid:            int32(d.IDs.UID),
+		Gid:            int32(d.IDs.GID),
+		SeccompProfile: d.Seccomp,
+		Hostname:       d.Hostname,
+		Restart:        fromRestartPolicy(d.Restart),
+		Attempts:       fromAttempts(d.Attempts),
+		QueuePosition:  int32(d.QueuePosition),
+		Error:          d.Error,
+		ScheduleId:     d.Schedule,
+		Array:          fromArraySummary(d.Array),
+		ArrayId:        string(d.ArrayID),
+		ArrayIndex:     int32(d.ArrayIndex),
+	}
+
+	for _, p := range d.Preemptions {
+		rt.Preemptions = append(rt.Preemptions, &pb.Preemption{At: timestamppb.New(p.At), By: string(p.By)})
+	}
+
+	if !d.NextRestart.IsZero() {
+		rt.NextRestart = timestamppb.New(d.NextRestart)
+	}
+
+	for _, c := range d.Caps {
+		rt.Capabilities = append(rt.Capabilities, c.String())
+	}
+
+	for _, ns := range d.Namespaces {
+		rt.Namespaces = append(rt.Namespaces, string(ns))
+	}
+
+	for _, p := range d.Pressure {
+		rt.Pressure = append(rt.Pressure, &pb.Pressure{
+			Resource: p.Resource,
+			Some:     fromPressureAvg(p.Some),
+			Full:     fromPressureAvg(p.Full),
+		})
+	}
+
+	for _, e := range d.PressureEvents {
+		rt.PressureEvents = append(rt.PressureEvents, &pb.PressureEvent{
+			Trigger: fromPressureTrigger(e.Trigger),
+			Time:    timestamppb.New(e.Time),
+		})
+	}
+
+	return rt
+}
+
+// newEgressLimits parses the configured outbound traffic policies
+func newEgressLimits(cfg *Config) (network.EgressLimits, error) {
+	var rt network.EgressLimits
+	for _, p := range []struct {
+		policy *network.EgressPolicy
+		cfg    EgressConfig
+	}{
+		{&rt.Defaults, cfg.Network.Egress.Defaults},
+		{&rt.Max, cfg.Network.Egress.Max},
+	} {
+		var err error
+		if p.policy.Allow, err = network.ParseRules(p.cfg.Allow); err != nil {
+			return rt, err
+		}
+		if p.policy.Deny, err = network.ParseRules(p.cfg.Deny); err != nil {
+			return rt, err
+		}
+	}
+
+	// the defaults must fit the ceiling
+	if _, err := rt.Resolve(nil); err != nil {
+		return rt, err
+	}
+
+	return rt, nil
+}
+
 // hasReadAccess checks if user cid has read access to job jid
 func (j *JobServer) hasReadAccess(cid, jid string) bool {
 	return j.auth.Check(acl.AccessRequest{
@@ -133,17 +572,30 @@ func (j *JobServer) Remove(ctx context.Context, req *pb.RemoveRequest) (*pb.Remo
 		log.Info().Str("client", cid).Str("job", req.JobId).Msg("no access")
 		return nil, status.Error(codes.NotFound, "job not found")
 	}
+
+	// the tasks of an array job are removed with it
+	objects := []acl.ObjectID{acl.ObjectID(req.JobId)}
+	if d, err := j.jobs.Inspect(req.JobId); err == nil && d.Array != nil {
+		for _, t := range d.Array.Tasks {
+			objects = append(objects, acl.ObjectID(t.JobID))
+		}
+	}
+
 	err := j.jobs.Remove(req.JobId)
 
 	switch {
 	case errors.Is(err, supervisor.ErrNotFound):
 		return nil, status.Error(codes.NotFound, "job not found")
+	case errors.Is(err, supervisor.ErrQueued):
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
 	case err != nil:
 		return nil, status.Error(codes.Internal, err.Error())
 	}
 
-	if err := j.auth.Remove(acl.ObjectID(req.JobId)); err != nil {
-		log.Warn().Err(err).Str("id", req.JobId).Msg("failed to update ACL")
+	for _, o := range objects {
+		if err := j.auth.Remove(o); err != nil {
+			log.Warn().Err(err).Str("id", string(o)).Msg("failed to update ACL")
+		}
 	}
 
 	return &pb.RemoveResponse{}, nil
@@ -164,7 +616,7 @@ func (j *JobServer) Inspect(ctx context.Context, req *pb.InspectRequest) (*pb.In
 		log.Info().Str("client", cid).Str("job", req.JobId).Msg("no access")
 		return nil, status.Error(codes.NotFound, "job not found")
 	}
-	st, code, cmd, err := j.jobs.Inspect(req.JobId)
+	details, err := j.jobs.Inspect(req.JobId)
 
 	switch {
 	case errors.Is(err, supervisor.ErrNotFound):
@@ -174,11 +626,7 @@ func (j *JobServer) Inspect(ctx context.Context, req *pb.InspectRequest) (*pb.In
 	}
 
 	return &pb.InspectResponse{
-		Details: &pb.Details{
-			Command:  cmd,
-			Status:   fromJobStatus(st),
-			ExitCode: code,
-		},
+		Details: fromJobDetails(details),
 	}, nil
 }
 
@@ -193,6 +641,8 @@ func fromJobStatus(st job.Status) pb.Status {
 		return pb.Status_STATUS_STOPPING
 	case job.StatusStopped:
 		return pb.Status_STATUS_STOPPED
+	case job.StatusQueued:
+		return pb.Status_STATUS_QUEUED
 	default:
 		return pb.Status_STATUS_UNSPECIFIED
 	}
@@ -214,10 +664,20 @@ func (j *JobServer) Logs(req *pb.LogsRequest, server pb.JobService_LogsServer) e
 		return status.Error(codes.NotFound, "job not found")
 	}
 
-	r, err := j.jobs.Logs(req.JobId)
+	var r io.ReadCloser
+	var err error
+	if n := req.Options.GetAttempt(); n > 0 {
+		r, err = j.jobs.AttemptLogs(req.JobId, int(n))
+	} else {
+		r, err = j.jobs.Logs(req.JobId)
+	}
 	switch {
 	case errors.Is(err, supervisor.ErrNotFound):
 		return status.Error(codes.NotFound, "job not found")
+	case errors.Is(err, job.ErrNoAttempt):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, supervisor.ErrQueued), errors.Is(err, supervisor.ErrArrayJob):
+		return status.Error(codes.FailedPrecondition, err.Error())
 	case err != nil:
 		return status.Error(codes.Internal, err.Error())
 	}
@@ -288,9 +748,126 @@ func New(cfg *Config) (*JobServer, error) {
 		return nil, fmt.Errorf("invalid gid configured")
 	}
 
+	rlimits, err := newRlimitPolicy(cfg.Rlimits.Defaults, cfg.Rlimits.Max)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %v", err)
+	}
+
+	images, err := image.Load(cfg.WorkRoot, cfg.Images)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load images: %v", err)
+	}
+
+	volumes, err := newVolumePolicy(cfg.Volumes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %v", err)
+	}
+
+	nm, err := network.New(network.Config{
+		Bridge: cfg.Network.Bridge,
+		Subnet: cfg.Network.Subnet,
+		NAT:    cfg.Network.NAT,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid network config: %v", err)
+	}
+
+	egress, err := newEgressLimits(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid egress config: %v", err)
+	}
+
+	ports, err := newPortPolicy(cfg.Network.Ports.Min, cfg.Network.Ports.Max, cfg.Network.Ports.Allow)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ports config: %v", err)
+	}
+
+	jobs := supervisor.New(uid, gid)
+	if cfg.UserNS.Enabled {
+		pool, err := supervisor.NewIDPool(cfg.UserNS.Base, cfg.UserNS.Size, cfg.UserNS.Count)
+		if err != nil {
+			return nil, fmt.Errorf("invalid userns config: %v", err)
+		}
+		jobs.UseUserNS(pool)
+	}
+
+	err = jobs.UseCapacity(supervisor.Capacity{
+		MaxJobs: cfg.Queue.MaxJobs,
+		CPU:     cfg.Queue.CPU,
+		Memory:  cfg.Queue.Memory,
+		Order:   supervisor.QueueOrder(cfg.Queue.Order),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid queue config: %v", err)
+	}
+
+	identities, err := newIdentityPolicy(job.ExecIdentity{UID: uid, GID: gid}, cfg.Identities)
+	if err != nil {
+		return nil, fmt.Errorf("invalid identities config: %v", err)
+	}
+
+	profiles, err := newSeccompPolicy(cfg.Seccomp.Default, cfg.Seccomp.Profiles, cfg.Seccomp.Unconfined)
+	if err != nil {
+		return nil, fmt.Errorf("invalid seccomp config: %v", err)
+	}
+
+	caps, err := newCapabilityPolicy(cfg.Capabilities)
+	if err != nil {
+		return nil, fmt.Errorf("invalid capabilities config: %v", err)
+	}
+
+	isolation, err := newProfilePolicy(cfg.WorkRoot, cfg.DefaultProfile, cfg.Profiles)
+	if err != nil {
+		return nil, fmt.Errorf("invalid profiles config: %v", err)
+	}
+
+	priorities, err := newPriorityPolicy(cfg.Queue.Order, cfg.Queue.PriorityClasses)
+	if err != nil {
+		return nil, fmt.Errorf("invalid queue config: %v", err)
+	}
+
+	quotas, err := newQuotaPolicy(cfg.Quotas)
+	if err != nil {
+		return nil, fmt.Errorf("invalid quotas config: %v", err)
+	}
+
 	rt := &JobServer{
-		auth: auth,
-		jobs: supervisor.New(uid, gid),
+		auth:    auth,
+		jobs:    jobs,
+		rlimits: rlimits,
+		images:  images,
+		volumes: volumes,
+		network: nm,
+		egress:  egress,
+		ports:   ports,
+
+		identities: identities,
+		userNS:     cfg.UserNS.Enabled,
+		seccomp:    profiles,
+		caps:       caps,
+		profiles:   isolation,
+
+		priorities: priorities,
+		quotas:     quotas,
+	}
+
+	schedules := cfg.SchedulesFile
+	if schedules == "" && cfg.WorkRoot != "" {
+		schedules = filepath.Join(cfg.WorkRoot, "schedules.json")
+	}
+	if err := jobs.UseSchedules(schedules, rt.launch); err != nil {
+		return nil, fmt.Errorf("invalid schedules: %v", err)
+	}
+	rt.restoreSchedules()
+
+	err = jobs.UseRetention(supervisor.Retention{
+		TTL:         cfg.Retention.TTL,
+		MaxRetained: cfg.Retention.MaxRetainedJobs,
+		MaxLogBytes: cfg.Retention.MaxLogBytes,
+		Interval:    cfg.Retention.Interval,
+	}, rt.removed)
+	if err != nil {
+		return nil, fmt.Errorf("invalid retention config: %v", err)
 	}
 
 	return rt, nil
@@ -0,0 +1,62 @@
+package shim
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+
+	"github.com/ilyazz/jobs/pkg/job"
+	"github.com/ilyazz/jobs/pkg/seccomp"
+)
+
+// Exec runs the shim process in exec mode: enters the cgroup and namespaces ns of the job process
+// target, runs the command there, and exits with its exit code
+func Exec(command string, args []string, cfg job.ProcConfig, target int, ns []job.Namespace) {
+	// sanity check
+	if os.Args[0] != "/proc/self/exe" {
+		_, _ = fmt.Fprint(os.Stderr, "should not be called directly")
+		os.Exit(1)
+	}
+
+	code, err := job.EnterJob(command, args, cfg, target, ns)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "failed to enter the job: %v\n", err)
+		os.Exit(1)
+	}
+	os.Exit(code)
+}
+
+// ExecInner sets up the process inside the job namespaces, and executes the command
+func ExecInner(command string, args []string, cfg job.ProcConfig) {
+	var profile *seccomp.Profile
+	if cfg.Seccomp != "" {
+		var err error
+		if profile, err = seccomp.LoadNamed(cfg.Seccomp); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "failed to load seccomp profile: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if err := job.SetupExecProc(cfg); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "failed to setup the process: %v\n", err)
+		os.Exit(1)
+	}
+
+	path, err := exec.LookPath(command)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "failed to exec: %v\n", err)
+		os.Exit(127)
+	}
+
+	if profile != nil {
+		if err := seccomp.Install(profile); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "failed to setup the process: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	err = syscall.Exec(path, append([]string{command}, args...), os.Environ())
+	_, _ = fmt.Fprintf(os.Stderr, "failed to exec: %v\n", err)
+	os.Exit(127)
+}
@@ -8,9 +8,11 @@ import (
 	"syscall"
 
 	"github.com/ilyazz/jobs/pkg/job"
+	"github.com/ilyazz/jobs/pkg/seccomp"
 )
 
-func Main(command string, args []string, cgroup string, uid int, gid int) {
+// Main runs the shim process: sets up the process according to cfg, and executes the job command
+func Main(command string, args []string, cfg job.ProcConfig) {
 	// sanity check
 	if os.Args[0] != "/proc/self/exe" {
 		_, _ = fmt.Fprint(os.Stderr, "should not be called directly")
@@ -19,12 +21,18 @@ func Main(command string, args []string, cgroup string, uid int, gid int) {
 
 	f := os.NewFile(3, "out")
 
-	ids := job.ExecIdentity{
-		UID: uid,
-		GID: gid,
+	// the profile file may be out of reach after the root and IDs are changed
+	var profile *seccomp.Profile
+	if cfg.Seccomp != "" {
+		var err error
+		if profile, err = seccomp.LoadNamed(cfg.Seccomp); err != nil {
+			_, _ = f.WriteString("failed to load seccomp profile: " + err.Error())
+			_ = f.Close()
+			os.Exit(1)
+		}
 	}
 
-	if err := job.SetupProc(cgroup, ids); err != nil {
+	if err := job.SetupProc(cfg); err != nil {
 		_, _ = f.WriteString("failed to setup the process: " + err.Error())
 		_ = f.Close()
 		os.Exit(1)
@@ -32,6 +40,12 @@ func Main(command string, args []string, cgroup string, uid int, gid int) {
 
 	_ = f.Close()
 
+	// closes the pipe in any case, the job command must not inherit it
+	if err := job.WaitReady(cfg, os.NewFile(4, "ready")); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "failed to setup the process: %v\n", err)
+		os.Exit(1)
+	}
+
 	// must be after setting process uid/gid
 	_, _, errno := syscall.RawSyscall(uintptr(syscall.SYS_PRCTL), uintptr(syscall.PR_SET_PDEATHSIG), uintptr(syscall.SIGHUP), 0)
 	if errno != 0 {
@@ -52,6 +66,15 @@ func Main(command string, args []string, cgroup string, uid int, gid int) {
 	cmd := exec.Command(command, args...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
+
+	// applies to the shim as well, the profile must allow process management syscalls
+	if profile != nil {
+		if err := seccomp.Install(profile); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "failed to setup the process: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	if err := cmd.Start(); err != nil {
 		_, _ = fmt.Fprintf(os.Stderr, "failed to exec: %v\n", err)
 	}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	pb "github.com/ilyazz/jobs/pkg/api/grpc/jobs/v1"
+	"github.com/ilyazz/jobs/pkg/job"
+)
+
+// anyUser matches all users in volume permissions.
+const anyUser = "*"
+
+// volume is a host path jobs may mount.
+type volume struct {
+	// path is the host path
+	path string
+	// users maps user ID to the permission to mount read-write
+	users map[string]bool
+}
+
+// volumePolicy defines named host paths jobs may bind-mount, and who may mount them.
+type volumePolicy struct {
+	volumes map[string]volume
+}
+
+// newVolumePolicy checks the configured volumes.
+func newVolumePolicy(cfg map[string]VolumeConfig) (*volumePolicy, error) {
+	rt := &volumePolicy{volumes: make(map[string]volume)}
+
+	for name, vc := range cfg {
+		if !filepath.IsAbs(vc.Path) || filepath.Clean(vc.Path) != vc.Path {
+			return nil, fmt.Errorf("volume %q: path must be absolute and clean", name)
+		}
+
+		if fi, err := os.Stat(vc.Path); err != nil {
+			return nil, fmt.Errorf("volume %q: %w", name, err)
+		} else if !fi.IsDir() {
+			return nil, fmt.Errorf("volume %q: %q is not a directory", name, vc.Path)
+		}
+
+		v := volume{path: vc.Path, users: make(map[string]bool)}
+		for u, mode := range vc.Users {
+			switch mode {
+			case "ro":
+				v.users[u] = false
+			case "rw":
+				v.users[u] = true
+			default:
+				return nil, fmt.Errorf("volume %q: invalid mode %q of user %q", name, mode, u)
+			}
+		}
+
+		rt.volumes[name] = v
+	}
+
+	return rt, nil
+}
+
+// resolve checks user uid may mount the requested volumes, and returns the mounts.
+func (p *volumePolicy) resolve(uid string, req []*pb.Volume) ([]job.Mount, error) {
+	var rt []job.Mount
+	targets := make(map[string]bool)
+
+	for _, r := range req {
+		v, ok := p.volumes[r.Name]
+		if !ok {
+			return nil, fmt.Errorf("unknown volume: %q", r.Name)
+		}
+
+		rw, ok := v.users[uid]
+		if !ok {
+			rw, ok = v.users[anyUser]
+		}
+		if !ok {
+			return nil, fmt.Errorf("volume %q is not allowed", r.Name)
+		}
+		if !rw && !r.ReadOnly {
+			return nil, fmt.Errorf("volume %q is allowed read-only", r.Name)
+		}
+
+		m := job.Mount{Source: v.path, Target: r.Target, ReadOnly: r.ReadOnly}
+		if err := m.Validate(); err != nil {
+			return nil, err
+		}
+
+		if targets[m.Target] {
+			return nil, fmt.Errorf("duplicate volume target: %q", m.Target)
+		}
+		targets[m.Target] = true
+
+		rt = append(rt, m)
+	}
+
+	return rt, nil
+}
@@ -0,0 +1,324 @@
+package supervisor
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/ilyazz/jobs/pkg/job"
+	"github.com/rs/zerolog/log"
+)
+
+// ErrInvalidArray means the array job tasks are not valid
+var ErrInvalidArray = errors.New("invalid array job")
+
+// ErrArrayJob means the operation applies to the array tasks, not to the array job
+var ErrArrayJob = errors.New("not supported for array jobs, use the task jobs")
+
+const (
+	// ArrayIDEnv is the environment variable with the array job ID, set for the tasks
+	ArrayIDEnv = "JOB_ARRAY_ID"
+	// ArrayIndexEnv is the environment variable with the task index
+	ArrayIndexEnv = "JOB_ARRAY_INDEX"
+	// ArrayItemEnv is the environment variable with the task item, if the array has an item list
+	ArrayItemEnv = "JOB_ARRAY_ITEM"
+)
+
+// Array is the task set of an array job. Each task runs the array job spec.
+type Array struct {
+	// Indexes are the task indexes, one task each
+	Indexes []int
+	// Items are the task items, if not empty. Task i gets item Items[i]
+	Items []string
+	// Parallelism is the max number of tasks started at the same time. 0 means no limit
+	Parallelism int
+}
+
+// Validate checks if the array is valid.
+func (a Array) Validate() error {
+	if len(a.Indexes) == 0 {
+		return fmt.Errorf("%w: no tasks", ErrInvalidArray)
+	}
+	if len(a.Items) > 0 && len(a.Items) != len(a.Indexes) {
+		return fmt.Errorf("%w: %d items for %d tasks", ErrInvalidArray, len(a.Items), len(a.Indexes))
+	}
+	if a.Parallelism < 0 {
+		return fmt.Errorf("%w: negative parallelism", ErrInvalidArray)
+	}
+
+	known := make(map[int]bool, len(a.Indexes))
+	for _, i := range a.Indexes {
+		if i < 0 {
+			return fmt.Errorf("%w: negative index %d", ErrInvalidArray, i)
+		}
+		if known[i] {
+			return fmt.Errorf("%w: duplicate index %d", ErrInvalidArray, i)
+		}
+		known[i] = true
+	}
+	return nil
+}
+
+// arrayTask is the internal task state. The step states are reused: StepSkipped means cancelled
+type arrayTask struct {
+	index int
+	item  string
+	job   job.ID
+	state StepState
+	err   string
+}
+
+// array is a submitted array job.
+type array struct {
+	id          job.ID
+	spec        Spec
+	items       bool
+	parallelism int
+	tasks       []*arrayTask
+	// stopped means the array job is stopped via API
+	stopped bool
+}
+
+// arrayRef is the array of a task job.
+type arrayRef struct {
+	array *array
+	task  *arrayTask
+}
+
+// StartArray submits array job spec, with tasks a. The tasks start, or are queued, as long as the number of
+// the started tasks is below the parallelism. Returns the array job ID, and the task job IDs, assigned right away.
+func (s *JobSupervisor) StartArray(spec Spec, a Array) (job.ID, []job.ID, error) {
+	if err := a.Validate(); err != nil {
+		return "", nil, err
+	}
+	if spec.Endpoint != nil {
+		return "", nil, fmt.Errorf("%w: bridge network is not supported", ErrInvalidArray)
+	}
+
+	arr := &array{id: newID(), spec: spec, items: len(a.Items) > 0, parallelism: a.Parallelism}
+	ids := make([]job.ID, 0, len(a.Indexes))
+	for i, index := range a.Indexes {
+		t := &arrayTask{index: index, job: newID()}
+		if arr.items {
+			t.item = a.Items[i]
+		}
+		arr.tasks = append(arr.tasks, t)
+		ids = append(ids, t.job)
+	}
+
+	s.plock.Lock()
+	defer s.plock.Unlock()
+
+	s.arrays[arr.id] = arr
+	for _, t := range arr.tasks {
+		s.taskArrays[t.job] = arrayRef{array: arr, task: t}
+	}
+
+	log.Info().Str("id", string(arr.id)).Int("tasks", len(arr.tasks)).Int("parallelism", a.Parallelism).Msg("array job started")
+	s.advanceArray(arr)
+
+	return arr.id, ids, nil
+}
+
+// advanceArray updates the states of the started tasks, and starts the next tasks, up to the parallelism.
+func (s *JobSupervisor) advanceArray(a *array) {
+	// supposed to be called under s.plock
+	started := 0
+	for _, t := range a.tasks {
+		if t.state != StepStarted {
+			continue
+		}
+		if state, done := s.outcome(t.job); done {
+			t.state = state
+			continue
+		}
+		started++
+	}
+
+	for _, t := range a.tasks {
+		if t.state != StepWaiting {
+			continue
+		}
+		if a.stopped {
+			t.state = StepSkipped
+			continue
+		}
+		if a.parallelism > 0 && started >= a.parallelism {
+			return
+		}
+
+		if err := s.start(t.job, a.task(t)); err != nil {
+			log.Warn().Err(err).Str("id", string(a.id)).Int("index", t.index).Msg("failed to start the array task")
+			t.state = StepFailed
+			t.err = err.Error()
+			continue
+		}
+		t.state = StepStarted
+		started++
+	}
+}
+
+// task returns the job spec of task t.
+func (a *array) task(t *arrayTask) Spec {
+	spec := a.spec
+	spec.Env = append(append([]string(nil), a.spec.Env...),
+		ArrayIDEnv+"="+string(a.id), ArrayIndexEnv+"="+strconv.Itoa(t.index))
+	if a.items {
+		spec.Env = append(spec.Env, ArrayItemEnv+"="+t.item)
+	}
+	return spec
+}
+
+// isArray checks if id is an array job.
+func (s *JobSupervisor) isArray(id job.ID) bool {
+	s.plock.Lock()
+	defer s.plock.Unlock()
+
+	_, ok := s.arrays[id]
+	return ok
+}
+
+// inspectArray returns the details of array job id. Returns false if there's no such array.
+func (s *JobSupervisor) inspectArray(id job.ID) (job.Details, bool) {
+	s.plock.Lock()
+	defer s.plock.Unlock()
+
+	a, ok := s.arrays[id]
+	if !ok {
+		return job.Details{}, false
+	}
+
+	s.advanceArray(a)
+	return s.arrayDetails(a), true
+}
+
+// arrayDetails returns the array job state snapshot, aggregated over the tasks.
+func (s *JobSupervisor) arrayDetails(a *array) job.Details {
+	// supposed to be called under s.plock
+	sum := &job.ArraySummary{Total: len(a.tasks)}
+	for _, t := range a.tasks {
+		at := job.ArrayTask{Index: t.index, Item: t.item, JobID: t.job}
+
+		switch t.state {
+		case StepWaiting:
+			sum.Waiting++
+			at.Status = job.StatusQueued
+		case StepSkipped:
+			sum.Cancelled++
+			at.Status, at.ExitCode = job.StatusStopped, -1
+		default:
+			switch t.state {
+			case StepStarted:
+				sum.Active++
+			case StepSucceeded:
+				sum.Succeeded++
+			default:
+				sum.Failed++
+			}
+
+			if d, err := s.inspect(t.job); err == nil {
+				at.Status, at.ExitCode = d.Status, d.ExitCode
+			} else if t.err != "" {
+				// failed to start
+				at.Status, at.ExitCode = job.StatusEnded, -1
+			} else {
+				at.Status = job.StatusRemoved
+			}
+		}
+		sum.Tasks = append(sum.Tasks, at)
+	}
+
+	d := job.Details{
+		Command: append([]string{a.spec.Command}, a.spec.Args...),
+		Network: a.spec.Network,
+		Array:   sum,
+	}
+
+	switch running := sum.Waiting+sum.Active > 0; {
+	case running && a.stopped:
+		d.Status = job.StatusStopping
+	case running:
+		d.Status = job.StatusActive
+	case a.stopped:
+		d.Status, d.ExitCode = job.StatusStopped, -1
+	default:
+		d.Status = job.StatusEnded
+		if sum.Failed > 0 {
+			d.ExitCode = 1
+		}
+	}
+	return d
+}
+
+// stopArray stops array job id: the waiting tasks are cancelled, and the started ones are stopped.
+// Returns false if there's no such array.
+func (s *JobSupervisor) stopArray(id job.ID, graceful bool) (bool, error) {
+	s.plock.Lock()
+	a, ok := s.arrays[id]
+	if !ok {
+		s.plock.Unlock()
+		return false, nil
+	}
+
+	a.stopped = true
+	s.advanceArray(a)
+
+	var started []job.ID
+	for _, t := range a.tasks {
+		if t.state == StepStarted {
+			started = append(started, t.job)
+		}
+	}
+	s.plock.Unlock()
+
+	log.Info().Str("id", string(id)).Msg("array job stopped")
+
+	for _, jid := range started {
+		// the task may have completed meanwhile, Stop logs the failure
+		_, _ = s.Stop(string(jid), graceful)
+	}
+	return true, nil
+}
+
+// removeArray removes completed array job id, with its tasks. Returns false if there's no such array.
+func (s *JobSupervisor) removeArray(id job.ID) (bool, error) {
+	s.plock.Lock()
+	defer s.plock.Unlock()
+
+	a, ok := s.arrays[id]
+	if !ok {
+		return false, nil
+	}
+
+	s.advanceArray(a)
+	for _, t := range a.tasks {
+		if t.state == StepWaiting || t.state == StepStarted {
+			return true, fmt.Errorf("array job is still running")
+		}
+	}
+
+	for _, t := range a.tasks {
+		if t.state == StepSkipped || t.err != "" {
+			delete(s.taskArrays, t.job)
+			continue
+		}
+		if err := s.removeJob(t.job); err != nil && !errors.Is(err, ErrNotFound) {
+			return true, err
+		}
+		delete(s.taskArrays, t.job)
+	}
+
+	delete(s.arrays, id)
+	return true, nil
+}
+
+// taskOf sets the array job of task id in details d, if it's an array task.
+func (s *JobSupervisor) taskOf(id job.ID, d *job.Details) {
+	s.plock.Lock()
+	defer s.plock.Unlock()
+
+	if ref, ok := s.taskArrays[id]; ok {
+		d.ArrayID = ref.array.id
+		d.ArrayIndex = ref.task.index
+	}
+}
@@ -0,0 +1,72 @@
+package supervisor
+
+import (
+	"testing"
+
+	"github.com/ilyazz/jobs/pkg/job"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArrayValidate(t *testing.T) {
+	assert.NoError(t, Array{Indexes: []int{0, 1, 2}, Parallelism: 2}.Validate())
+	assert.NoError(t, Array{Indexes: []int{0, 1}, Items: []string{"a", "b"}}.Validate())
+
+	for _, a := range []Array{
+		{},
+		{Indexes: []int{0, 1}, Items: []string{"a"}},
+		{Indexes: []int{1, 1}},
+		{Indexes: []int{-1}},
+		{Indexes: []int{0}, Parallelism: -1},
+	} {
+		assert.ErrorIs(t, a.Validate(), ErrInvalidArray)
+	}
+}
+
+func TestArrayParallelism(t *testing.T) {
+	// the task jobs stay queued
+	s := fullSupervisor(t, Capacity{MaxJobs: 1})
+
+	id, tasks, err := s.StartArray(Spec{Command: "ls"}, Array{
+		Indexes:     []int{0, 1, 2, 3, 4},
+		Items:       []string{"a", "b", "c", "d", "e"},
+		Parallelism: 2,
+	})
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 5)
+
+	d, err := s.Inspect(string(id))
+	assert.NoError(t, err)
+	assert.Equal(t, job.StatusActive, d.Status)
+	assert.Equal(t, 5, d.Array.Total)
+	assert.Equal(t, 2, d.Array.Active)
+	assert.Equal(t, 3, d.Array.Waiting)
+	assert.Equal(t, tasks[1], d.Array.Tasks[1].JobID)
+	assert.Equal(t, "b", d.Array.Tasks[1].Item)
+
+	assert.Subset(t, s.pending[tasks[1]].spec.Env,
+		[]string{"JOB_ARRAY_ID=" + string(id), "JOB_ARRAY_INDEX=1", "JOB_ARRAY_ITEM=b"})
+
+	td, err := s.Inspect(string(tasks[1]))
+	assert.NoError(t, err)
+	assert.Equal(t, id, td.ArrayID)
+	assert.Equal(t, 1, td.ArrayIndex)
+
+	_, err = s.Logs(string(id))
+	assert.ErrorIs(t, err, ErrArrayJob)
+	assert.Error(t, s.Remove(string(id)))
+
+	_, err = s.Stop(string(id), true)
+	assert.NoError(t, err)
+
+	d, err = s.Inspect(string(id))
+	assert.NoError(t, err)
+	assert.Equal(t, job.StatusStopped, d.Status)
+	assert.Equal(t, 2, d.Array.Failed)
+	assert.Equal(t, 3, d.Array.Cancelled)
+
+	assert.NoError(t, s.Remove(string(id)))
+	_, err = s.Inspect(string(id))
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = s.Inspect(string(tasks[0]))
+	assert.ErrorIs(t, err, ErrNotFound)
+}
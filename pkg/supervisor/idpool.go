@@ -0,0 +1,60 @@
+package supervisor
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ilyazz/jobs/pkg/job"
+)
+
+// ErrNoIDRange means all the user namespace ID ranges are in use.
+var ErrNoIDRange = errors.New("no free id range")
+
+// IDPool allocates subordinate ID ranges for job user namespaces. The pool is count ranges of
+// size IDs each, starting from host ID base.
+type IDPool struct {
+	lock sync.Mutex
+	base int
+	size int
+	used []bool
+}
+
+// NewIDPool creates a pool of count ranges of size IDs, starting from base.
+func NewIDPool(base, size, count int) (*IDPool, error) {
+	if base <= 0 || size <= 0 || count <= 0 {
+		return nil, fmt.Errorf("base, size and count must be positive")
+	}
+	// uid_t is 32-bit, and -1 is reserved
+	if int64(base)+int64(size)*int64(count) > 1<<32-1 {
+		return nil, fmt.Errorf("id ranges exceed the max id")
+	}
+
+	return &IDPool{base: base, size: size, used: make([]bool, count)}, nil
+}
+
+// Get allocates a free range.
+func (p *IDPool) Get() (job.IDRange, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for i, u := range p.used {
+		if !u {
+			p.used[i] = true
+			return job.IDRange{HostID: p.base + i*p.size, Size: p.size}, nil
+		}
+	}
+
+	return job.IDRange{}, ErrNoIDRange
+}
+
+// Put releases the range.
+func (p *IDPool) Put(r job.IDRange) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	i := (r.HostID - p.base) / p.size
+	if i >= 0 && i < len(p.used) {
+		p.used[i] = false
+	}
+}
@@ -0,0 +1,34 @@
+package supervisor
+
+import (
+	"testing"
+
+	"github.com/ilyazz/jobs/pkg/job"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIDPool(t *testing.T) {
+	p, err := NewIDPool(100000, 65536, 2)
+	assert.NoError(t, err)
+
+	r1, err := p.Get()
+	assert.NoError(t, err)
+	assert.Equal(t, job.IDRange{HostID: 100000, Size: 65536}, r1)
+
+	r2, err := p.Get()
+	assert.NoError(t, err)
+	assert.Equal(t, job.IDRange{HostID: 165536, Size: 65536}, r2)
+
+	_, err = p.Get()
+	assert.ErrorIs(t, err, ErrNoIDRange)
+
+	p.Put(r1)
+	r3, err := p.Get()
+	assert.NoError(t, err)
+	assert.Equal(t, r1, r3)
+
+	for _, args := range [][3]int{{0, 1, 1}, {1, 0, 1}, {1, 1, 0}, {1 << 31, 1 << 16, 1 << 15}} {
+		_, err := NewIDPool(args[0], args[1], args[2])
+		assert.Error(t, err, args)
+	}
+}
@@ -0,0 +1,439 @@
+package supervisor
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ilyazz/jobs/pkg/job"
+	"github.com/rs/xid"
+	"github.com/rs/zerolog/log"
+)
+
+// ErrInvalidPipeline means the pipeline steps or their dependencies are not valid
+var ErrInvalidPipeline = errors.New("invalid pipeline")
+
+// ErrPipelineNotFound means there's no such pipeline
+var ErrPipelineNotFound = errors.New("pipeline not found")
+
+// Condition is the outcome of a dependency a pipeline step requires to start
+type Condition string
+
+const (
+	// OnSuccess requires the dependency job to end with exit code 0. The default
+	OnSuccess = Condition("success")
+	// OnFailure requires the dependency job to fail: exit with a non-zero code, be stopped, or fail to start
+	OnFailure = Condition("failure")
+	// Always requires the dependency to be done, whatever the outcome, including a skipped one
+	Always = Condition("always")
+)
+
+// Dependency is an edge of the pipeline graph.
+type Dependency struct {
+	// Step is the name of the step depended on
+	Step string
+	// Condition is the required outcome of the step. OnSuccess if empty
+	Condition Condition
+}
+
+// Step is a pipeline job.
+type Step struct {
+	// Name is the step name, unique within the pipeline
+	Name string
+	// Spec is the step job
+	Spec Spec
+	// DependsOn are the steps to be done before the step job starts
+	DependsOn []Dependency
+}
+
+// PipelineID is a pipeline ID
+type PipelineID string
+
+// PipelineStatus is the pipeline status
+type PipelineStatus int
+
+const (
+	// PipelineRunning means some steps are not done yet
+	PipelineRunning = PipelineStatus(0)
+	// PipelineSucceeded means all the steps are done, and the step jobs started have succeeded
+	PipelineSucceeded = PipelineStatus(1)
+	// PipelineFailed means all the steps are done, and some step job has failed
+	PipelineFailed = PipelineStatus(2)
+	// PipelineCancelled means the pipeline is stopped via API
+	PipelineCancelled = PipelineStatus(3)
+)
+
+// String implements Stringer interface for PipelineStatus.
+func (s PipelineStatus) String() string {
+	switch s {
+	case PipelineRunning:
+		return "RUNNING"
+	case PipelineSucceeded:
+		return "SUCCEEDED"
+	case PipelineFailed:
+		return "FAILED"
+	case PipelineCancelled:
+		return "CANCELLED"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// StepState is the pipeline step state
+type StepState int
+
+const (
+	// StepWaiting means the step dependencies are not done yet
+	StepWaiting = StepState(0)
+	// StepStarted means the step job is started or queued
+	StepStarted = StepState(1)
+	// StepSucceeded means the step job has ended with exit code 0
+	StepSucceeded = StepState(2)
+	// StepFailed means the step job has exited with a non-zero code, was stopped, or failed to start
+	StepFailed = StepState(3)
+	// StepSkipped means the step job never starts: the dependency conditions are not met, or the pipeline is cancelled
+	StepSkipped = StepState(4)
+)
+
+// String implements Stringer interface for StepState.
+func (s StepState) String() string {
+	switch s {
+	case StepWaiting:
+		return "WAITING"
+	case StepStarted:
+		return "STARTED"
+	case StepSucceeded:
+		return "SUCCEEDED"
+	case StepFailed:
+		return "FAILED"
+	case StepSkipped:
+		return "SKIPPED"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// StepDetails is a snapshot of the pipeline step state.
+type StepDetails struct {
+	// Name is the step name
+	Name string
+	// JobID is the step job ID. Assigned on the pipeline start, the job exists once the step is started
+	JobID job.ID
+	// State is the step state
+	State StepState
+	// Error is why the step job failed to start, if it did
+	Error string
+}
+
+// PipelineDetails is a snapshot of the pipeline state.
+type PipelineDetails struct {
+	// Status is the pipeline status
+	Status PipelineStatus
+	// Steps are the pipeline steps, in the submitted order
+	Steps []StepDetails
+}
+
+// pipelineStep is the internal step state.
+type pipelineStep struct {
+	Step
+	job   job.ID
+	state StepState
+	err   string
+}
+
+// pipeline is a submitted pipeline.
+type pipeline struct {
+	id     PipelineID
+	steps  []*pipelineStep
+	byName map[string]*pipelineStep
+	// cancelled means the pipeline is stopped via API
+	cancelled bool
+}
+
+// validateSteps checks the step names are unique, and the dependencies are known and acyclic.
+func validateSteps(steps []Step) error {
+	if len(steps) == 0 {
+		return fmt.Errorf("%w: no steps", ErrInvalidPipeline)
+	}
+
+	known := make(map[string]bool, len(steps))
+	for _, st := range steps {
+		if st.Name == "" {
+			return fmt.Errorf("%w: empty step name", ErrInvalidPipeline)
+		}
+		if known[st.Name] {
+			return fmt.Errorf("%w: duplicate step %q", ErrInvalidPipeline, st.Name)
+		}
+		known[st.Name] = true
+	}
+
+	// the steps left after removing the ones with all the dependencies removed are the cycles
+	pending := make(map[string]int, len(steps))
+	dependents := make(map[string][]string)
+	for _, st := range steps {
+		for _, d := range st.DependsOn {
+			if !known[d.Step] {
+				return fmt.Errorf("%w: step %q depends on unknown step %q", ErrInvalidPipeline, st.Name, d.Step)
+			}
+			switch d.Condition {
+			case "", OnSuccess, OnFailure, Always:
+			default:
+				return fmt.Errorf("%w: unknown condition %q", ErrInvalidPipeline, d.Condition)
+			}
+			pending[st.Name]++
+			dependents[d.Step] = append(dependents[d.Step], st.Name)
+		}
+	}
+
+	var ready []string
+	for _, st := range steps {
+		if pending[st.Name] == 0 {
+			ready = append(ready, st.Name)
+		}
+	}
+
+	done := 0
+	for len(ready) > 0 {
+		name := ready[len(ready)-1]
+		ready = ready[:len(ready)-1]
+		done++
+
+		for _, dep := range dependents[name] {
+			if pending[dep]--; pending[dep] == 0 {
+				ready = append(ready, dep)
+			}
+		}
+	}
+
+	if done < len(steps) {
+		return fmt.Errorf("%w: dependency cycle", ErrInvalidPipeline)
+	}
+	return nil
+}
+
+// StartPipeline submits a pipeline of steps. A step job starts, or is queued, once the dependencies are done
+// and their conditions are met. Otherwise the step is skipped. The step job IDs are assigned right away.
+func (s *JobSupervisor) StartPipeline(steps []Step) (PipelineID, PipelineDetails, error) {
+	if err := validateSteps(steps); err != nil {
+		return "", PipelineDetails{}, err
+	}
+
+	p := &pipeline{
+		id:     PipelineID(xid.New().String()),
+		byName: make(map[string]*pipelineStep, len(steps)),
+	}
+	for _, st := range steps {
+		ps := &pipelineStep{Step: st, job: newID()}
+		p.steps = append(p.steps, ps)
+		p.byName[st.Name] = ps
+	}
+
+	s.plock.Lock()
+	defer s.plock.Unlock()
+
+	s.pipelines[p.id] = p
+	for _, ps := range p.steps {
+		s.stepJobs[ps.job] = p
+	}
+
+	log.Info().Str("pipeline", string(p.id)).Int("steps", len(steps)).Msg("pipeline started")
+	s.advance(p)
+
+	return p.id, p.details(), nil
+}
+
+// InspectPipeline returns pipeline id details. The pipeline is gone once all the step jobs are removed.
+func (s *JobSupervisor) InspectPipeline(id PipelineID) (PipelineDetails, error) {
+	s.plock.Lock()
+	defer s.plock.Unlock()
+
+	p, ok := s.pipelines[id]
+	if !ok {
+		return PipelineDetails{}, ErrPipelineNotFound
+	}
+
+	s.advance(p)
+	return p.details(), nil
+}
+
+// StopPipeline cancels pipeline id: the waiting steps are skipped, and the started step jobs are stopped gracefully.
+func (s *JobSupervisor) StopPipeline(id PipelineID) error {
+	s.plock.Lock()
+	p, ok := s.pipelines[id]
+	if !ok {
+		s.plock.Unlock()
+		return ErrPipelineNotFound
+	}
+
+	p.cancelled = true
+	s.advance(p)
+
+	var started []job.ID
+	for _, st := range p.steps {
+		if st.state == StepStarted {
+			started = append(started, st.job)
+		}
+	}
+	s.plock.Unlock()
+
+	log.Info().Str("pipeline", string(id)).Msg("pipeline cancelled")
+
+	for _, jid := range started {
+		// the job may have completed meanwhile, Stop logs the failure
+		_, _ = s.Stop(string(jid), true)
+	}
+	return nil
+}
+
+// completed advances the pipeline or the array job of job id, if any, once the job is done.
+// Asynchronous, so that the caller may hold any lock.
+func (s *JobSupervisor) completed(id job.ID) {
+	go func() {
+		s.plock.Lock()
+		defer s.plock.Unlock()
+
+		if p, ok := s.stepJobs[id]; ok {
+			s.advance(p)
+		}
+		if ref, ok := s.taskArrays[id]; ok {
+			s.advanceArray(ref.array)
+		}
+	}()
+}
+
+// removeEmptyPipelines drops the pipelines that are done, with all the step jobs removed. Returns the removed ones.
+func (s *JobSupervisor) removeEmptyPipelines(pipelines map[*pipeline]bool) []PipelineID {
+	s.plock.Lock()
+	defer s.plock.Unlock()
+
+	var rt []PipelineID
+	for p := range pipelines {
+		if _, ok := s.pipelines[p.id]; !ok || !s.emptyPipeline(p) {
+			continue
+		}
+		for _, st := range p.steps {
+			delete(s.stepJobs, st.job)
+		}
+		delete(s.pipelines, p.id)
+		rt = append(rt, p.id)
+		log.Info().Str("pipeline", string(p.id)).Msg("pipeline removed")
+	}
+	return rt
+}
+
+// emptyPipeline checks if pipeline p is done, and the step jobs are removed.
+func (s *JobSupervisor) emptyPipeline(p *pipeline) bool {
+	// supposed to be called under s.plock
+	for _, st := range p.steps {
+		switch {
+		case st.state == StepWaiting || st.state == StepStarted:
+			return false
+		case st.state == StepSkipped || st.err != "":
+			// never started
+		default:
+			if _, err := s.inspect(st.job); err == nil {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// advance updates the states of the pipeline steps, and starts the step jobs that are ready.
+func (s *JobSupervisor) advance(p *pipeline) {
+	// supposed to be called under s.plock
+	for changed := true; changed; {
+		changed = false
+
+		for _, st := range p.steps {
+			switch st.state {
+			case StepStarted:
+				if state, done := s.outcome(st.job); done {
+					st.state = state
+					changed = true
+				}
+			case StepWaiting:
+				run, ready := p.ready(st)
+				if !ready && !p.cancelled {
+					continue
+				}
+				changed = true
+
+				if !run || p.cancelled {
+					st.state = StepSkipped
+					detachEndpoint(st.Spec)
+					continue
+				}
+
+				if err := s.start(st.job, st.Spec); err != nil {
+					log.Warn().Err(err).Str("pipeline", string(p.id)).Str("step", st.Name).Msg("failed to start the step job")
+					st.state = StepFailed
+					st.err = err.Error()
+					continue
+				}
+				st.state = StepStarted
+			}
+		}
+	}
+}
+
+// outcome returns the step state of job id, and true if the job is done.
+func (s *JobSupervisor) outcome(id job.ID) (StepState, bool) {
+	d, err := s.inspect(id)
+	if err != nil {
+		// removed, so it's done
+		return StepFailed, true
+	}
+
+	switch d.Status {
+	case job.StatusEnded:
+		if d.ExitCode == 0 && d.Error == "" {
+			return StepSucceeded, true
+		}
+		return StepFailed, true
+	case job.StatusStopped:
+		return StepFailed, true
+	default:
+		return StepStarted, false
+	}
+}
+
+// ready checks if the dependencies of step st are done, and if their conditions are met.
+func (p *pipeline) ready(st *pipelineStep) (run bool, ready bool) {
+	run = true
+	for _, d := range st.DependsOn {
+		dep := p.byName[d.Step]
+		if dep.state == StepWaiting || dep.state == StepStarted {
+			return false, false
+		}
+
+		switch d.Condition {
+		case Always:
+		case OnFailure:
+			run = run && dep.state == StepFailed
+		default:
+			run = run && dep.state == StepSucceeded
+		}
+	}
+	return run, true
+}
+
+// details returns the pipeline state snapshot.
+func (p *pipeline) details() PipelineDetails {
+	rt := PipelineDetails{Status: PipelineSucceeded}
+
+	for _, st := range p.steps {
+		rt.Steps = append(rt.Steps, StepDetails{Name: st.Name, JobID: st.job, State: st.state, Error: st.err})
+
+		switch {
+		case st.state == StepWaiting || st.state == StepStarted:
+			rt.Status = PipelineRunning
+		case st.state == StepFailed && rt.Status != PipelineRunning:
+			rt.Status = PipelineFailed
+		}
+	}
+
+	if p.cancelled {
+		rt.Status = PipelineCancelled
+	}
+	return rt
+}
@@ -0,0 +1,117 @@
+package supervisor
+
+import (
+	"testing"
+
+	"github.com/ilyazz/jobs/pkg/job"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateSteps(t *testing.T) {
+	ls := Spec{Command: "ls"}
+
+	tests := []struct {
+		name  string
+		steps []Step
+		valid bool
+	}{
+		{"empty", nil, false},
+		{"single", []Step{{Name: "a", Spec: ls}}, true},
+		{"chain", []Step{
+			{Name: "a", Spec: ls},
+			{Name: "b", Spec: ls, DependsOn: []Dependency{{Step: "a"}}},
+			{Name: "c", Spec: ls, DependsOn: []Dependency{{Step: "a"}, {Step: "b", Condition: OnFailure}}},
+		}, true},
+		{"duplicate", []Step{{Name: "a", Spec: ls}, {Name: "a", Spec: ls}}, false},
+		{"unknown step", []Step{{Name: "a", Spec: ls, DependsOn: []Dependency{{Step: "b"}}}}, false},
+		{"unknown condition", []Step{
+			{Name: "a", Spec: ls},
+			{Name: "b", Spec: ls, DependsOn: []Dependency{{Step: "a", Condition: "sometimes"}}},
+		}, false},
+		{"self", []Step{{Name: "a", Spec: ls, DependsOn: []Dependency{{Step: "a"}}}}, false},
+		{"cycle", []Step{
+			{Name: "a", Spec: ls},
+			{Name: "b", Spec: ls, DependsOn: []Dependency{{Step: "a"}, {Step: "c"}}},
+			{Name: "c", Spec: ls, DependsOn: []Dependency{{Step: "b"}}},
+		}, false},
+	}
+
+	for _, tt := range tests {
+		err := validateSteps(tt.steps)
+		if tt.valid {
+			assert.NoError(t, err, tt.name)
+		} else {
+			assert.ErrorIs(t, err, ErrInvalidPipeline, tt.name)
+		}
+	}
+}
+
+func TestPipelineConditions(t *testing.T) {
+	// the step jobs stay queued
+	s := fullSupervisor(t, Capacity{MaxJobs: 1})
+
+	ls := Spec{Command: "ls"}
+	id, d, err := s.StartPipeline([]Step{
+		{Name: "build", Spec: ls},
+		{Name: "test", Spec: ls, DependsOn: []Dependency{{Step: "build"}}},
+		{Name: "report", Spec: ls, DependsOn: []Dependency{{Step: "test", Condition: OnFailure}}},
+		{Name: "cleanup", Spec: ls, DependsOn: []Dependency{{Step: "test", Condition: Always}}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, PipelineRunning, d.Status)
+	assert.Equal(t, []StepState{StepStarted, StepWaiting, StepWaiting, StepWaiting}, stepStates(d))
+
+	// the build fails
+	_, err = s.Stop(string(d.Steps[0].JobID), true)
+	assert.NoError(t, err)
+
+	d, err = s.InspectPipeline(id)
+	assert.NoError(t, err)
+	assert.Equal(t, PipelineRunning, d.Status)
+	assert.Equal(t, []StepState{StepFailed, StepSkipped, StepSkipped, StepStarted}, stepStates(d))
+
+	assert.NoError(t, s.StopPipeline(id))
+
+	d, err = s.InspectPipeline(id)
+	assert.NoError(t, err)
+	assert.Equal(t, PipelineCancelled, d.Status)
+	assert.Equal(t, []StepState{StepFailed, StepSkipped, StepSkipped, StepFailed}, stepStates(d))
+
+	_, err = s.InspectPipeline("unknown")
+	assert.ErrorIs(t, err, ErrPipelineNotFound)
+
+	// the pipeline goes with the last step job
+	assert.NoError(t, s.Remove(string(d.Steps[0].JobID)))
+	_, err = s.InspectPipeline(id)
+	assert.NoError(t, err)
+
+	assert.NoError(t, s.Remove(string(d.Steps[3].JobID)))
+	_, err = s.InspectPipeline(id)
+	assert.ErrorIs(t, err, ErrPipelineNotFound)
+}
+
+func TestPipelineUsage(t *testing.T) {
+	s := fullSupervisor(t, Capacity{MaxJobs: 1})
+
+	spec := Spec{Command: "ls", Owner: "alice", Limits: job.ExecLimits{CPU: 1}}
+	id, _, err := s.StartPipeline([]Step{
+		{Name: "build", Spec: spec},
+		{Name: "test", Spec: spec, DependsOn: []Dependency{{Step: "build"}}},
+	})
+	assert.NoError(t, err)
+
+	// the step waiting for the build is reserved
+	assert.Equal(t, Usage{Active: 2, CPU: 2}, s.Usage("alice"))
+
+	assert.NoError(t, s.StopPipeline(id))
+	assert.Equal(t, Usage{Retained: 1}, s.Usage("alice"))
+}
+
+// stepStates returns the states of the pipeline steps.
+func stepStates(d PipelineDetails) []StepState {
+	var rt []StepState
+	for _, st := range d.Steps {
+		rt = append(rt, st.State)
+	}
+	return rt
+}
@@ -0,0 +1,117 @@
+package supervisor
+
+import (
+	"sort"
+	"time"
+
+	"github.com/ilyazz/jobs/pkg/job"
+	"github.com/rs/zerolog/log"
+)
+
+// preemptTimeout is how long a preempted job has to stop gracefully
+const preemptTimeout = 30 * time.Second
+
+// preempt picks the running jobs to stop, so that new job e, at the head of the queue, fits the capacity,
+// and marks them preempted.
+// Jobs with lower priorities are picked first, the most recently started first among the same priority.
+// Nothing is picked if the job doesn't fit even then. Returns the jobs to stop.
+func (s *JobSupervisor) preempt(e *entry) []*job.Job {
+	// supposed to be called under s.lock
+	d := demandOf(e.spec)
+
+	// the capacity of the jobs already preempted is being freed
+	left := make(map[job.ID]demand, len(s.running))
+	var candidates []*entry
+	for id, r := range s.running {
+		a, ok := s.accounts[id]
+		if ok && a.origin.preempted {
+			continue
+		}
+		left[id] = r
+		if ok && a.origin.spec.Priority < e.spec.Priority {
+			candidates = append(candidates, a.origin)
+		}
+	}
+
+	sort.Slice(candidates, func(i, k int) bool {
+		if candidates[i].spec.Priority != candidates[k].spec.Priority {
+			return candidates[i].spec.Priority < candidates[k].spec.Priority
+		}
+		// IDs are ordered by the creation time
+		return candidates[i].id > candidates[k].id
+	})
+
+	var picked []*entry
+	for _, c := range candidates {
+		if s.capacity.fits(d, left) {
+			break
+		}
+		delete(left, c.id)
+		picked = append(picked, c)
+	}
+	if !s.capacity.fits(d, left) {
+		return nil
+	}
+
+	var rt []*job.Job
+	for _, c := range picked {
+		c.preempted = true
+		c.preemptions = append(c.preemptions, job.Preemption{At: time.Now(), By: e.id})
+		if j, ok := s.jobs[c.id]; ok {
+			rt = append(rt, j)
+		}
+	}
+	return rt
+}
+
+// stopPreempted stops preempted jobs gracefully.
+func stopPreempted(jobs []*job.Job) {
+	for _, j := range jobs {
+		log.Info().Str("id", string(j.ID)).Msg("preempting job")
+		if err := j.InitStop(preemptTimeout); err != nil {
+			log.Warn().Err(err).Str("id", string(j.ID)).Msg("failed to stop the preempted job")
+		}
+	}
+}
+
+// requeue queues completed job j again, if it was preempted. The job run is cleaned up, its output is discarded,
+// and its network endpoint is detached.
+// Returns true if the job is queued again.
+func (s *JobSupervisor) requeue(j *job.Job) bool {
+	s.lock.RLock()
+	a, ok := s.accounts[j.ID]
+	preempted := ok && a.origin.preempted
+	s.lock.RUnlock()
+
+	if !preempted {
+		return false
+	}
+
+	if err := j.Cleanup(); err != nil {
+		log.Warn().Err(err).Str("id", string(j.ID)).Msg("failed to clean up the preempted job")
+
+		s.lock.Lock()
+		a.origin.preempted = false
+		s.lock.Unlock()
+		return false
+	}
+	s.releaseIDs(j.ID)
+	// the address and the ports are not held while the job is queued, the next run attaches the endpoint anew
+	detachEndpoint(a.origin.spec)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.jobs[j.ID] != j {
+		// removed meanwhile
+		return false
+	}
+	delete(s.jobs, j.ID)
+	delete(s.accounts, j.ID)
+
+	a.origin.preempted = false
+	s.enqueue(a.origin)
+
+	log.Info().Str("id", string(j.ID)).Msg("preempted job queued again")
+	return true
+}
@@ -0,0 +1,295 @@
+package supervisor
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ilyazz/jobs/pkg/job"
+	"github.com/rs/xid"
+	"github.com/rs/zerolog/log"
+)
+
+// ErrExceedsCapacity means the job limits are above the server capacity, so it can never start
+var ErrExceedsCapacity = errors.New("job limits exceed the server capacity")
+
+// ErrQueued means the job is waiting in the queue, and has not started yet
+var ErrQueued = errors.New("job is queued")
+
+// QueueOrder is the order queued jobs are started in
+type QueueOrder string
+
+const (
+	// QueueFIFO starts jobs in the order they were queued. The default
+	QueueFIFO = QueueOrder("fifo")
+	// QueuePriority starts jobs with higher Spec.Priority first, in the order they were queued otherwise
+	QueuePriority = QueueOrder("priority")
+)
+
+// Capacity limits the jobs running at the same time, by their number, and by their requested limits.
+// Jobs that don't fit wait in the queue. Jobs without a CPU or memory limit count as 0 for it
+type Capacity struct {
+	// MaxJobs is the max number of running jobs. 0 means no limit
+	MaxJobs int
+	// CPU is the total CPU limit of running jobs. 0 means no limit
+	CPU float32
+	// Memory is the total memory limit of running jobs, in bytes. 0 means no limit
+	Memory int64
+	// Order is the queue order. QueueFIFO if empty
+	Order QueueOrder
+}
+
+// Validate checks if the capacity is valid.
+func (c Capacity) Validate() error {
+	if c.MaxJobs < 0 || c.CPU < 0 || c.Memory < 0 {
+		return fmt.Errorf("negative capacity")
+	}
+	switch c.Order {
+	case "", QueueFIFO, QueuePriority:
+	default:
+		return fmt.Errorf("unknown queue order %q", c.Order)
+	}
+	return nil
+}
+
+// demand is what a running job counts against the capacity.
+type demand struct {
+	cpu float32
+	mem int64
+}
+
+// demandOf returns the capacity demand of spec.
+func demandOf(spec Spec) demand {
+	return demand{cpu: spec.Limits.CPU, mem: spec.Limits.MaxRAMBytes}
+}
+
+// admits checks if a job with demand d may ever run, i.e. fits the empty server.
+func (c Capacity) admits(d demand) bool {
+	return (c.CPU == 0 || d.cpu <= c.CPU) && (c.Memory == 0 || d.mem <= c.Memory)
+}
+
+// fits checks if a job with demand d may start next to the running ones.
+func (c Capacity) fits(d demand, running map[job.ID]demand) bool {
+	if c.MaxJobs > 0 && len(running) >= c.MaxJobs {
+		return false
+	}
+
+	total := d
+	for _, r := range running {
+		total.cpu += r.cpu
+		total.mem += r.mem
+	}
+	return c.admits(total)
+}
+
+// entryState is the state of a job that has not started yet
+type entryState int
+
+const (
+	// entryWaiting means the job is in the queue
+	entryWaiting = entryState(iota)
+	// entryStarting means the job has left the queue, and is being started
+	entryStarting
+	// entryCancelled means the job was stopped while in the queue
+	entryCancelled
+	// entryFailed means the job failed to start
+	entryFailed
+)
+
+// entry is a job that has not started yet, or has never started.
+type entry struct {
+	id     job.ID
+	spec   Spec
+	runAs  job.ExecIdentity
+	queued time.Time
+	state  entryState
+	// err is why the job failed to start
+	err error
+	// preempted means the started job is being stopped to free the capacity, and is queued again once it completes
+	preempted bool
+	// preemptions are the preemptions of the job so far
+	preemptions []job.Preemption
+	// ended is when the job completed, was cancelled in the queue, or failed to start
+	ended time.Time
+}
+
+// details returns the entry state snapshot. position is the entry position in the queue, starting with 1
+func (e *entry) details(position int) job.Details {
+	d := job.Details{
+		Status:      job.StatusQueued,
+		Command:     append([]string{e.spec.Command}, e.spec.Args...),
+		Preemptions: append([]job.Preemption(nil), e.preemptions...),
+	}
+
+	switch e.state {
+	case entryWaiting:
+		d.QueuePosition = position
+	case entryCancelled:
+		d.Status = job.StatusStopped
+		d.ExitCode = -1
+	case entryFailed:
+		d.Status = job.StatusEnded
+		d.ExitCode = -1
+		d.Error = e.err.Error()
+	}
+	return d
+}
+
+// UseCapacity makes the supervisor queue new jobs that don't fit capacity c.
+func (s *JobSupervisor) UseCapacity(c Capacity) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	if c.Order == "" {
+		c.Order = QueueFIFO
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.capacity = c
+	return nil
+}
+
+// ahead returns the number of waiting jobs to start before a new job with priority p.
+func (s *JobSupervisor) ahead(p int) int {
+	// supposed to be called under s.lock
+	if s.capacity.Order != QueuePriority {
+		return len(s.queue)
+	}
+	return sort.Search(len(s.queue), func(i int) bool {
+		return s.queue[i].spec.Priority < p
+	})
+}
+
+// enqueue adds a new entry to the queue, in the queue order.
+func (s *JobSupervisor) enqueue(e *entry) {
+	// supposed to be called under s.lock
+	e.queued = time.Now()
+	e.state = entryWaiting
+
+	i := s.ahead(e.spec.Priority)
+	s.queue = append(s.queue, nil)
+	copy(s.queue[i+1:], s.queue[i:])
+	s.queue[i] = e
+
+	s.pending[e.id] = e
+}
+
+// position returns the position of waiting entry id in the queue, starting with 1. 0 if it's not waiting.
+func (s *JobSupervisor) position(id job.ID) int {
+	// supposed to be called under s.lock
+	for i, e := range s.queue {
+		if e.id == id {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// dequeue removes waiting entry id from the queue.
+func (s *JobSupervisor) dequeue(id job.ID) {
+	// supposed to be called under s.lock
+	for i, e := range s.queue {
+		if e.id == id {
+			s.queue = append(s.queue[:i], s.queue[i+1:]...)
+			return
+		}
+	}
+}
+
+// detachEndpoint releases the network endpoint of a job that never starts.
+func detachEndpoint(spec Spec) {
+	if spec.Endpoint == nil {
+		return
+	}
+	if err := spec.Endpoint.Detach(); err != nil {
+		log.Warn().Err(err).Msg("failed to release the job network endpoint")
+	}
+}
+
+// newID generates a new job ID.
+func newID() job.ID {
+	return job.ID(xid.New().String())
+}
+
+// dispatch starts the queued jobs, while the head of the queue fits the capacity.
+func (s *JobSupervisor) dispatch() {
+	for {
+		s.lock.Lock()
+		if len(s.queue) == 0 || !s.capacity.fits(demandOf(s.queue[0].spec), s.running) {
+			s.lock.Unlock()
+			return
+		}
+
+		e := s.queue[0]
+		s.queue = s.queue[1:]
+		e.state = entryStarting
+		s.running[e.id] = demandOf(e.spec)
+		s.lock.Unlock()
+
+		log.Info().Str("id", string(e.id)).Dur("waited", time.Since(e.queued)).Msg("starting queued job")
+
+		if err := s.launch(e); err != nil {
+			s.lock.Lock()
+			e.state = entryFailed
+			e.err = err
+			s.retire(e)
+			s.lock.Unlock()
+
+			s.completed(e.id)
+		}
+	}
+}
+
+// release returns the capacity reserved for job id.
+func (s *JobSupervisor) release(id job.ID) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.running, id)
+}
+
+// watch releases the capacity of job j once it completes, queues it again if it was preempted,
+// and starts the queued jobs that fit.
+func (s *JobSupervisor) watch(j *job.Job) {
+	j.Wait()
+	s.release(j.ID)
+	if !s.requeue(j) {
+		s.lock.Lock()
+		if a, ok := s.accounts[j.ID]; ok {
+			s.retire(a.origin)
+		}
+		s.lock.Unlock()
+
+		s.completed(j.ID)
+	}
+	s.dispatch()
+}
+
+// cancel stops pending job id, if it's waiting in the queue. Returns false if there's no such entry.
+// The jobs behind may fit then, dispatch them after
+func (s *JobSupervisor) cancel(id job.ID) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	e, ok := s.pending[id]
+	if !ok {
+		return false, nil
+	}
+
+	switch e.state {
+	case entryWaiting:
+		s.dequeue(id)
+		e.state = entryCancelled
+		s.retire(e)
+		detachEndpoint(e.spec)
+		log.Info().Str("id", string(id)).Msg("queued job cancelled")
+		return true, nil
+	case entryStarting:
+		return true, fmt.Errorf("job is starting")
+	default:
+		return true, fmt.Errorf("job is not queued")
+	}
+}
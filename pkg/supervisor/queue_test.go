@@ -0,0 +1,176 @@
+package supervisor
+
+import (
+	"testing"
+
+	"github.com/ilyazz/jobs/pkg/job"
+	"github.com/stretchr/testify/assert"
+)
+
+// fullSupervisor creates a supervisor with capacity c, and job "running" taking all of it.
+func fullSupervisor(t *testing.T, c Capacity) *JobSupervisor {
+	s := New(1000, 1000)
+	assert.NoError(t, s.UseCapacity(c))
+	s.running["running"] = demand{cpu: c.CPU, mem: c.Memory}
+	return s
+}
+
+func TestQueueFIFO(t *testing.T) {
+	s := fullSupervisor(t, Capacity{MaxJobs: 1})
+
+	id1, err := s.Start(Spec{Command: "ls", Priority: 1})
+	assert.NoError(t, err)
+	id2, err := s.Start(Spec{Command: "ls", Priority: 5})
+	assert.NoError(t, err)
+
+	d, err := s.Inspect(string(id1))
+	assert.NoError(t, err)
+	assert.Equal(t, job.StatusQueued, d.Status)
+	assert.Equal(t, 1, d.QueuePosition)
+
+	d, err = s.Inspect(string(id2))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, d.QueuePosition)
+
+	_, err = s.Logs(string(id1))
+	assert.ErrorIs(t, err, ErrQueued)
+	_, err = s.Processes(string(id1))
+	assert.ErrorIs(t, err, job.ErrNotRunning)
+	assert.ErrorIs(t, s.Remove(string(id1)), ErrQueued)
+}
+
+func TestQueuePriority(t *testing.T) {
+	s := fullSupervisor(t, Capacity{CPU: 2, Order: QueuePriority})
+
+	var ids []job.ID
+	for _, p := range []int{1, 5, 1, 3} {
+		id, err := s.Start(Spec{Command: "ls", Priority: p, Limits: job.ExecLimits{CPU: 1}})
+		assert.NoError(t, err)
+		ids = append(ids, id)
+	}
+
+	for i, pos := range []int{3, 1, 4, 2} {
+		d, err := s.Inspect(string(ids[i]))
+		assert.NoError(t, err)
+		assert.Equal(t, pos, d.QueuePosition, i)
+	}
+
+	_, err := s.Start(Spec{Command: "ls", Limits: job.ExecLimits{CPU: 3}})
+	assert.ErrorIs(t, err, ErrExceedsCapacity)
+}
+
+func TestQueueCancel(t *testing.T) {
+	s := fullSupervisor(t, Capacity{Memory: 1 << 30})
+
+	id1, err := s.Start(Spec{Command: "ls", Limits: job.ExecLimits{MaxRAMBytes: 1 << 20}})
+	assert.NoError(t, err)
+	id2, err := s.Start(Spec{Command: "ls", Limits: job.ExecLimits{MaxRAMBytes: 1 << 20}})
+	assert.NoError(t, err)
+
+	_, err = s.Stop(string(id1), true)
+	assert.NoError(t, err)
+
+	d, err := s.Inspect(string(id1))
+	assert.NoError(t, err)
+	assert.Equal(t, job.StatusStopped, d.Status)
+	assert.Equal(t, 0, d.QueuePosition)
+
+	d, err = s.Inspect(string(id2))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, d.QueuePosition)
+
+	_, err = s.Stop(string(id1), false)
+	assert.Error(t, err)
+
+	assert.NoError(t, s.Remove(string(id1)))
+	_, err = s.Inspect(string(id1))
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestCapacityFits(t *testing.T) {
+	c := Capacity{MaxJobs: 3, CPU: 4, Memory: 1000}
+	running := map[job.ID]demand{"a": {cpu: 2, mem: 500}, "b": {cpu: 1}}
+
+	assert.True(t, c.fits(demand{cpu: 1, mem: 500}, running))
+	assert.False(t, c.fits(demand{cpu: 1.5}, running))
+	assert.False(t, c.fits(demand{mem: 501}, running))
+
+	running["c"] = demand{}
+	assert.False(t, c.fits(demand{}, running))
+
+	assert.True(t, Capacity{}.fits(demand{cpu: 100, mem: 1 << 40}, running))
+	assert.Error(t, Capacity{Order: "random"}.Validate())
+}
+
+func TestUsage(t *testing.T) {
+	s := fullSupervisor(t, Capacity{MaxJobs: 1})
+
+	limits := job.ExecLimits{CPU: 0.5, MaxRAMBytes: 1 << 20}
+	id1, err := s.Start(Spec{Command: "ls", Owner: "alice", Limits: limits})
+	assert.NoError(t, err)
+	_, err = s.Start(Spec{Command: "ls", Owner: "alice", Limits: limits})
+	assert.NoError(t, err)
+	_, err = s.Start(Spec{Command: "ls", Owner: "bob", Limits: limits})
+	assert.NoError(t, err)
+
+	_, err = s.Stop(string(id1), true)
+	assert.NoError(t, err)
+
+	assert.Equal(t, Usage{Active: 1, CPU: 0.5, Memory: 1 << 20, Retained: 1}, s.Usage("alice"))
+	assert.Equal(t, Usage{Active: 1, CPU: 0.5, Memory: 1 << 20}, s.Usage("bob"))
+	assert.Equal(t, Usage{}, s.Usage("carol"))
+
+	// a job being removed is not counted
+	s.accounts["removed"] = account{owner: "carol", origin: &entry{}}
+	assert.Equal(t, Usage{}, s.Usage("carol"))
+}
+
+// fakeStarted registers a started job with priority and cpu limit, without a process.
+func fakeStarted(s *JobSupervisor, id string, priority int, cpu float32) *entry {
+	e := &entry{id: job.ID(id), spec: Spec{Command: "ls", Priority: priority, Limits: job.ExecLimits{CPU: cpu}}}
+	s.running[e.id] = demandOf(e.spec)
+	s.accounts[e.id] = account{demand: demandOf(e.spec), origin: e}
+	return e
+}
+
+func TestPreempt(t *testing.T) {
+	s := New(1000, 1000)
+	assert.NoError(t, s.UseCapacity(Capacity{CPU: 4, Order: QueuePriority}))
+
+	older := fakeStarted(s, "a", 0, 2)
+	newer := fakeStarted(s, "b", 0, 1)
+	important := fakeStarted(s, "c", 5, 1)
+	// the endpoint is attached anew once the job starts again
+	newer.spec.Network = job.NetBridge
+
+	// no preemption without the permission
+	_, err := s.Start(Spec{Command: "ls", Priority: 2, Limits: job.ExecLimits{CPU: 1}})
+	assert.NoError(t, err)
+	assert.False(t, newer.preempted)
+
+	// the capacity would go to the jobs ahead in the queue
+	_, err = s.Start(Spec{Command: "ls", Priority: 1, Preempt: true, Limits: job.ExecLimits{CPU: 1}})
+	assert.NoError(t, err)
+	assert.False(t, newer.preempted)
+
+	// jobs with higher priorities are never preempted
+	_, err = s.Start(Spec{Command: "ls", Priority: 3, Preempt: true, Limits: job.ExecLimits{CPU: 4}})
+	assert.NoError(t, err)
+	assert.False(t, newer.preempted)
+	assert.False(t, older.preempted)
+	assert.False(t, important.preempted)
+
+	id, err := s.Start(Spec{Command: "ls", Priority: 4, Preempt: true, Limits: job.ExecLimits{CPU: 1}})
+	assert.NoError(t, err)
+	assert.True(t, newer.preempted)
+	assert.False(t, older.preempted)
+	assert.False(t, important.preempted)
+	if assert.Len(t, newer.preemptions, 1) {
+		assert.Equal(t, id, newer.preemptions[0].By)
+	}
+
+	// the capacity of the preempted job is being freed already
+	_, err = s.Start(Spec{Command: "ls", Priority: 5, Preempt: true, Limits: job.ExecLimits{CPU: 1}})
+	assert.NoError(t, err)
+	assert.False(t, older.preempted)
+}
@@ -0,0 +1,299 @@
+package supervisor
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ilyazz/jobs/pkg/job"
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultReapInterval is how often the reaper removes the expired jobs, if Retention.Interval is not set
+const DefaultReapInterval = time.Minute
+
+// Retention limits the completed jobs kept: ended, stopped, cancelled in the queue, or failed to start.
+// The reaper removes the jobs over the limits, the oldest first
+type Retention struct {
+	// TTL is how long a completed job is kept, unless its Spec.TTL is set. 0 means no limit
+	TTL time.Duration
+	// MaxRetained is the max number of completed jobs of an owner. 0 means no limit
+	MaxRetained int
+	// MaxLogBytes is the max total output size of the completed jobs. 0 means no limit
+	MaxLogBytes int64
+	// Interval is how often the reaper runs. DefaultReapInterval if 0
+	Interval time.Duration
+}
+
+// Validate checks if the retention is valid.
+func (r Retention) Validate() error {
+	if r.TTL < 0 || r.MaxRetained < 0 || r.MaxLogBytes < 0 || r.Interval < 0 {
+		return fmt.Errorf("negative retention")
+	}
+	return nil
+}
+
+// RemoveHook is called for each job, array job or pipeline the reaper removes, and for the pipeline
+// removed with its last step job.
+type RemoveHook func(id job.ID)
+
+// retained is a completed job.
+type retained struct {
+	id      job.ID
+	owner   string
+	ended   time.Time
+	logSize int64
+	// ttl is the job TTL, the retention one is used if 0
+	ttl time.Duration
+	// remove means the job is removed once it's completed
+	remove bool
+}
+
+// expired returns the jobs to remove at time now, out of completed jobs, sorted by the completion time.
+func (r Retention) expired(jobs []retained, now time.Time) []job.ID {
+	var rt []job.ID
+	var kept []retained
+	for _, j := range jobs {
+		ttl := j.ttl
+		if ttl == 0 {
+			ttl = r.TTL
+		}
+		if j.remove || (ttl > 0 && now.Sub(j.ended) >= ttl) {
+			rt = append(rt, j.id)
+			continue
+		}
+		kept = append(kept, j)
+	}
+
+	owned := make(map[string]int)
+	var logSize int64
+	for _, j := range kept {
+		owned[j.owner]++
+		logSize += j.logSize
+	}
+
+	// the oldest jobs go first
+	for _, j := range kept {
+		if (r.MaxRetained > 0 && owned[j.owner] > r.MaxRetained) || (r.MaxLogBytes > 0 && logSize > r.MaxLogBytes) {
+			rt = append(rt, j.id)
+			owned[j.owner]--
+			logSize -= j.logSize
+		}
+	}
+	return rt
+}
+
+// UseRetention makes the supervisor remove the completed jobs over retention r, in the background.
+// Hook removed is called for each job removed.
+func (s *JobSupervisor) UseRetention(r Retention, removed RemoveHook) error {
+	if err := r.Validate(); err != nil {
+		return err
+	}
+	if r.Interval == 0 {
+		r.Interval = DefaultReapInterval
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.reapStop != nil {
+		close(s.reapStop)
+	}
+	s.retention = r
+	s.removed = removed
+	s.reapStop = make(chan struct{})
+
+	go s.runReaper(r.Interval, s.reapStop)
+	return nil
+}
+
+// runReaper removes the expired jobs every interval, and once a job to be removed right away completes,
+// until stop is closed.
+func (s *JobSupervisor) runReaper(interval time.Duration, stop chan struct{}) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+		case <-s.reap:
+		}
+
+		s.lock.RLock()
+		r := s.retention
+		s.lock.RUnlock()
+
+		ids := r.expired(s.retained(), time.Now())
+		if n := len(s.removeRetained(ids)); n > 0 {
+			log.Info().Int("jobs", n).Msg("expired jobs removed")
+		}
+	}
+}
+
+// retire records the completion time of job e, and wakes the reaper up if the job is to be removed right away.
+func (s *JobSupervisor) retire(e *entry) {
+	// supposed to be called under s.lock
+	e.ended = time.Now()
+	if e.spec.AutoRemove {
+		select {
+		case s.reap <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Prune removes the jobs of owner completed at least olderThan ago. Returns the jobs removed.
+func (s *JobSupervisor) Prune(owner string, olderThan time.Duration) []job.ID {
+	deadline := time.Now().Add(-olderThan)
+
+	var ids []job.ID
+	for _, j := range s.retained() {
+		if j.owner == owner && !j.ended.After(deadline) {
+			ids = append(ids, j.id)
+		}
+	}
+	return s.removeRetained(ids)
+}
+
+// PruneOldest removes the n oldest completed jobs of owner. Returns the jobs removed.
+func (s *JobSupervisor) PruneOldest(owner string, n int) []job.ID {
+	var ids []job.ID
+	for _, j := range s.retained() {
+		if len(ids) == n {
+			break
+		}
+		if j.owner == owner {
+			ids = append(ids, j.id)
+		}
+	}
+	return s.removeRetained(ids)
+}
+
+// retained returns the completed jobs, sorted by the completion time.
+func (s *JobSupervisor) retained() []retained {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	var rt []retained
+	add := func(e *entry, logSize int64) {
+		rt = append(rt, retained{
+			id:      e.id,
+			owner:   e.spec.Owner,
+			ended:   e.ended,
+			logSize: logSize,
+			ttl:     e.spec.TTL,
+			remove:  e.spec.AutoRemove,
+		})
+	}
+
+	for id, a := range s.accounts {
+		j, ok := s.jobs[id]
+		// not ended yet, or being removed
+		if !ok || a.origin.ended.IsZero() {
+			continue
+		}
+		add(a.origin, j.LogSize())
+	}
+	for _, e := range s.pending {
+		if (e.state == entryCancelled || e.state == entryFailed) && !e.ended.IsZero() {
+			add(e, 0)
+		}
+	}
+
+	sort.Slice(rt, func(i, k int) bool {
+		return rt[i].ended.Before(rt[k].ended)
+	})
+	return rt
+}
+
+// removeRetained removes completed jobs ids, their array jobs once all the tasks are removed, and their
+// pipelines once all the step jobs are removed.
+// Returns the jobs removed.
+func (s *JobSupervisor) removeRetained(ids []job.ID) []job.ID {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	// the pipelines and the array jobs record the job outcomes first
+	arrays := make(map[*array]bool)
+	pipelines := make(map[*pipeline]bool)
+	s.plock.Lock()
+	for _, id := range ids {
+		if p, ok := s.stepJobs[id]; ok {
+			s.advance(p)
+			pipelines[p] = true
+		}
+		if ref, ok := s.taskArrays[id]; ok {
+			s.advanceArray(ref.array)
+			arrays[ref.array] = true
+		}
+	}
+	s.plock.Unlock()
+
+	s.lock.RLock()
+	removed := s.removed
+	s.lock.RUnlock()
+
+	var rt []job.ID
+	for _, id := range ids {
+		if err := s.removeJob(id); err != nil {
+			log.Warn().Err(err).Str("id", string(id)).Msg("failed to remove the expired job")
+			continue
+		}
+		rt = append(rt, id)
+		if removed != nil {
+			removed(id)
+		}
+	}
+
+	for _, id := range s.removeEmptyArrays(arrays) {
+		if removed != nil {
+			removed(id)
+		}
+	}
+	for _, id := range s.removeEmptyPipelines(pipelines) {
+		if removed != nil {
+			removed(job.ID(id))
+		}
+	}
+	return rt
+}
+
+// removeEmptyArrays removes the array jobs of arrays that are done, with all the task jobs removed.
+func (s *JobSupervisor) removeEmptyArrays(arrays map[*array]bool) []job.ID {
+	s.plock.Lock()
+	defer s.plock.Unlock()
+
+	var rt []job.ID
+	for a := range arrays {
+		if _, ok := s.arrays[a.id]; !ok || !s.emptyArray(a) {
+			continue
+		}
+		for _, t := range a.tasks {
+			delete(s.taskArrays, t.job)
+		}
+		delete(s.arrays, a.id)
+		rt = append(rt, a.id)
+	}
+	return rt
+}
+
+// emptyArray checks if array job a is done, and the task jobs are removed.
+func (s *JobSupervisor) emptyArray(a *array) bool {
+	// supposed to be called under s.plock
+	for _, t := range a.tasks {
+		switch {
+		case t.state == StepWaiting || t.state == StepStarted:
+			return false
+		case t.state == StepSkipped || t.err != "":
+			// never started
+		default:
+			if _, err := s.inspect(t.job); err == nil {
+				return false
+			}
+		}
+	}
+	return true
+}
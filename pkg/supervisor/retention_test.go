@@ -0,0 +1,126 @@
+package supervisor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ilyazz/jobs/pkg/job"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetentionExpired(t *testing.T) {
+	now := time.Now()
+	jobs := []retained{
+		{id: "a1", owner: "alice", ended: now.Add(-3 * time.Hour), logSize: 100},
+		{id: "b1", owner: "bob", ended: now.Add(-2 * time.Hour), logSize: 100, ttl: time.Hour},
+		{id: "a2", owner: "alice", ended: now.Add(-time.Hour), logSize: 300},
+		{id: "a3", owner: "alice", ended: now.Add(-time.Minute), logSize: 100},
+		{id: "b2", owner: "bob", ended: now, logSize: 100, remove: true},
+	}
+
+	tests := []struct {
+		name      string
+		retention Retention
+		expired   []job.ID
+	}{
+		{"no limits", Retention{}, []job.ID{"b1", "b2"}},
+		{"ttl", Retention{TTL: 2 * time.Hour}, []job.ID{"a1", "b1", "b2"}},
+		{"max retained", Retention{MaxRetained: 2}, []job.ID{"b1", "b2", "a1"}},
+		{"max log bytes", Retention{MaxLogBytes: 400}, []job.ID{"b1", "b2", "a1"}},
+		{"all", Retention{TTL: 2 * time.Hour, MaxRetained: 2, MaxLogBytes: 300}, []job.ID{"a1", "b1", "b2", "a2"}},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expired, tt.retention.expired(jobs, now), tt.name)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	// the jobs stay queued
+	s := fullSupervisor(t, Capacity{MaxJobs: 1})
+
+	var ids []job.ID
+	for i := 0; i < 2; i++ {
+		id, err := s.Start(Spec{Command: "ls", Owner: "alice"})
+		assert.NoError(t, err)
+		_, err = s.Stop(string(id), true)
+		assert.NoError(t, err)
+		ids = append(ids, id)
+	}
+
+	assert.Empty(t, s.Prune("bob", 0))
+	assert.Empty(t, s.Prune("alice", time.Hour))
+	assert.ElementsMatch(t, ids, s.Prune("alice", 0))
+
+	_, err := s.Inspect(string(ids[0]))
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestPruneOldest(t *testing.T) {
+	// the jobs stay queued
+	s := fullSupervisor(t, Capacity{MaxJobs: 1})
+
+	var ids []job.ID
+	for i := 0; i < 3; i++ {
+		id, err := s.Start(Spec{Command: "ls", Owner: "alice"})
+		assert.NoError(t, err)
+		_, err = s.Stop(string(id), true)
+		assert.NoError(t, err)
+		ids = append(ids, id)
+	}
+
+	assert.Empty(t, s.PruneOldest("bob", 1))
+	assert.Equal(t, ids[:2], s.PruneOldest("alice", 2))
+	assert.Equal(t, Usage{Retained: 1}, s.Usage("alice"))
+}
+
+func TestAutoRemove(t *testing.T) {
+	s := fullSupervisor(t, Capacity{MaxJobs: 1})
+
+	removed := make(chan job.ID, 1)
+	assert.NoError(t, s.UseRetention(Retention{}, func(id job.ID) { removed <- id }))
+	defer s.StopSupervisor()
+
+	id, err := s.Start(Spec{Command: "ls", AutoRemove: true})
+	assert.NoError(t, err)
+	_, err = s.Stop(string(id), true)
+	assert.NoError(t, err)
+
+	select {
+	case rid := <-removed:
+		assert.Equal(t, id, rid)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the job is not removed")
+	}
+
+	_, err = s.Inspect(string(id))
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestReapPipeline(t *testing.T) {
+	s := fullSupervisor(t, Capacity{MaxJobs: 1})
+
+	removed := make(chan job.ID, 2)
+	assert.NoError(t, s.UseRetention(Retention{}, func(id job.ID) { removed <- id }))
+	defer s.StopSupervisor()
+
+	id, d, err := s.StartPipeline([]Step{{Name: "build", Spec: Spec{Command: "ls", AutoRemove: true}}})
+	assert.NoError(t, err)
+	_, err = s.Stop(string(d.Steps[0].JobID), true)
+	assert.NoError(t, err)
+
+	// the pipeline goes with its last step job
+	var ids []job.ID
+	for len(ids) < 2 {
+		select {
+		case rid := <-removed:
+			ids = append(ids, rid)
+		case <-time.After(5 * time.Second):
+			t.Fatal("the pipeline is not removed")
+		}
+	}
+	assert.Equal(t, []job.ID{d.Steps[0].JobID, job.ID(id)}, ids)
+
+	_, err = s.InspectPipeline(id)
+	assert.ErrorIs(t, err, ErrPipelineNotFound)
+}
@@ -0,0 +1,341 @@
+package supervisor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/ilyazz/jobs/pkg/cron"
+	"github.com/ilyazz/jobs/pkg/job"
+	"github.com/rs/xid"
+	"github.com/rs/zerolog/log"
+)
+
+// ErrInvalidSchedule means the schedule cron expression or concurrency policy is not valid
+var ErrInvalidSchedule = errors.New("invalid schedule")
+
+// ErrScheduleNotFound means there's no such schedule
+var ErrScheduleNotFound = errors.New("schedule not found")
+
+// ConcurrencyPolicy defines what a scheduled run does if the previous runs are still active
+type ConcurrencyPolicy string
+
+const (
+	// ConcurrencyAllow starts the run anyway. The default
+	ConcurrencyAllow = ConcurrencyPolicy("allow")
+	// ConcurrencyForbid skips the run
+	ConcurrencyForbid = ConcurrencyPolicy("forbid")
+	// ConcurrencyReplace stops the active runs gracefully, and starts the new one
+	ConcurrencyReplace = ConcurrencyPolicy("replace")
+)
+
+// ScheduleID is a schedule ID
+type ScheduleID string
+
+// Schedule is a job started periodically, at the times of a cron expression.
+type Schedule struct {
+	// ID is the schedule ID. Assigned on creation
+	ID ScheduleID
+	// Cron is the cron expression of the run times, in the server local time
+	Cron string
+	// Concurrency is what a run does if the previous runs are still active. ConcurrencyAllow if empty
+	Concurrency ConcurrencyPolicy
+	// Owner is the client who created the schedule
+	Owner string
+	// Job is the job definition, opaque to the supervisor. The launcher builds the job spec of it
+	Job []byte
+	// Created is when the schedule was created. Assigned on creation
+	Created time.Time
+}
+
+// ScheduleDetails is a snapshot of the schedule state.
+type ScheduleDetails struct {
+	Schedule
+	// NextRun is the time of the next run. Zero if the expression never matches again
+	NextRun time.Time
+	// LastRun is the time of the last run. Zero if it has never run since the server start
+	LastRun time.Time
+	// LastJob is the job of the last run. Empty if the last run didn't start
+	LastJob job.ID
+	// LastError is why the last run didn't start, if it didn't
+	LastError string
+	// Active are the runs not completed yet
+	Active []job.ID
+}
+
+// Launcher starts a run of schedule sc, and returns the job ID. It builds the job spec of sc.Job,
+// checks it on behalf of the owner, and starts it with Start.
+type Launcher func(sc Schedule) (job.ID, error)
+
+// schedule is the internal schedule state.
+type schedule struct {
+	Schedule
+	expr *cron.Expr
+	// closed when the schedule is deleted
+	stop chan struct{}
+
+	next, last time.Time
+	lastJob    job.ID
+	lastErr    string
+	active     []job.ID
+}
+
+// UseSchedules loads the schedules persisted in file path, if any, and starts them. New schedules are
+// persisted there. Schedules are kept in memory only, if the path is empty. Runs are started by launcher l.
+func (s *JobSupervisor) UseSchedules(path string, l Launcher) error {
+	var loaded []Schedule
+	if path != "" {
+		data, err := os.ReadFile(path)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+		case err != nil:
+			return fmt.Errorf("failed to read schedules: %w", err)
+		default:
+			if err := json.Unmarshal(data, &loaded); err != nil {
+				return fmt.Errorf("failed to parse schedules %s: %w", path, err)
+			}
+		}
+	}
+
+	s.slock.Lock()
+	defer s.slock.Unlock()
+
+	s.scheduleFile = path
+	s.launcher = l
+
+	for _, sc := range loaded {
+		expr, err := cron.Parse(sc.Cron)
+		if err != nil {
+			return fmt.Errorf("schedule %s: %w", sc.ID, err)
+		}
+		s.addSchedule(sc, expr)
+	}
+
+	if len(loaded) > 0 {
+		log.Info().Int("schedules", len(loaded)).Msg("schedules loaded")
+	}
+	return nil
+}
+
+// CreateSchedule adds and persists a new schedule. The ID and the creation time are assigned.
+func (s *JobSupervisor) CreateSchedule(sc Schedule) (ScheduleDetails, error) {
+	expr, err := cron.Parse(sc.Cron)
+	if err != nil {
+		return ScheduleDetails{}, fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+	}
+
+	switch sc.Concurrency {
+	case "":
+		sc.Concurrency = ConcurrencyAllow
+	case ConcurrencyAllow, ConcurrencyForbid, ConcurrencyReplace:
+	default:
+		return ScheduleDetails{}, fmt.Errorf("%w: unknown concurrency policy %q", ErrInvalidSchedule, sc.Concurrency)
+	}
+
+	sc.ID = ScheduleID(xid.New().String())
+	sc.Created = time.Now()
+
+	s.slock.Lock()
+	defer s.slock.Unlock()
+
+	if s.launcher == nil {
+		return ScheduleDetails{}, fmt.Errorf("schedules are not enabled")
+	}
+
+	internal := s.addSchedule(sc, expr)
+	if err := s.saveSchedules(); err != nil {
+		s.deleteSchedule(sc.ID)
+		return ScheduleDetails{}, err
+	}
+
+	log.Info().Str("schedule", string(sc.ID)).Str("cron", sc.Cron).Msg("schedule created")
+
+	d := internal.details()
+	// the loop may not have computed it yet
+	d.NextRun = expr.Next(time.Now())
+	return d, nil
+}
+
+// DeleteSchedule deletes schedule id. Its active runs are not stopped.
+func (s *JobSupervisor) DeleteSchedule(id ScheduleID) error {
+	s.slock.Lock()
+	defer s.slock.Unlock()
+
+	if _, ok := s.schedules[id]; !ok {
+		return ErrScheduleNotFound
+	}
+
+	s.deleteSchedule(id)
+	if err := s.saveSchedules(); err != nil {
+		return err
+	}
+
+	log.Info().Str("schedule", string(id)).Msg("schedule deleted")
+	return nil
+}
+
+// ListSchedules returns the details of all the schedules, ordered by the creation time.
+func (s *JobSupervisor) ListSchedules() []ScheduleDetails {
+	s.slock.Lock()
+	defer s.slock.Unlock()
+
+	rt := make([]ScheduleDetails, 0, len(s.schedules))
+	for _, sc := range s.schedules {
+		rt = append(rt, sc.details())
+	}
+	sort.Slice(rt, func(i, k int) bool {
+		return rt[i].Created.Before(rt[k].Created)
+	})
+	return rt
+}
+
+// addSchedule registers schedule sc with parsed expression expr, and starts its loop.
+func (s *JobSupervisor) addSchedule(sc Schedule, expr *cron.Expr) *schedule {
+	// supposed to be called under s.slock
+	internal := &schedule{Schedule: sc, expr: expr, stop: make(chan struct{})}
+	s.schedules[sc.ID] = internal
+
+	go s.runSchedule(internal)
+	return internal
+}
+
+// deleteSchedule unregisters schedule id, and stops its loop.
+func (s *JobSupervisor) deleteSchedule(id ScheduleID) {
+	// supposed to be called under s.slock
+	close(s.schedules[id].stop)
+	delete(s.schedules, id)
+}
+
+// saveSchedules persists the schedules, replacing the file atomically.
+func (s *JobSupervisor) saveSchedules() error {
+	// supposed to be called under s.slock
+	if s.scheduleFile == "" {
+		return nil
+	}
+
+	list := make([]Schedule, 0, len(s.schedules))
+	for _, sc := range s.schedules {
+		list = append(list, sc.Schedule)
+	}
+	sort.Slice(list, func(i, k int) bool {
+		return list[i].Created.Before(list[k].Created)
+	})
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.scheduleFile), 0700); err != nil {
+		return fmt.Errorf("failed to save schedules: %w", err)
+	}
+
+	tmp := s.scheduleFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to save schedules: %w", err)
+	}
+	if err := os.Rename(tmp, s.scheduleFile); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to save schedules: %w", err)
+	}
+	return nil
+}
+
+// runSchedule starts the runs of schedule sc, until it's deleted.
+func (s *JobSupervisor) runSchedule(sc *schedule) {
+	for {
+		next := sc.expr.Next(time.Now())
+
+		s.slock.Lock()
+		sc.next = next
+		s.slock.Unlock()
+
+		if next.IsZero() {
+			log.Warn().Str("schedule", string(sc.ID)).Msg("schedule never runs again")
+			return
+		}
+
+		t := time.NewTimer(time.Until(next))
+		select {
+		case <-sc.stop:
+			t.Stop()
+			return
+		case <-t.C:
+			s.fire(sc)
+		}
+	}
+}
+
+// fire starts a run of schedule sc, according to its concurrency policy.
+func (s *JobSupervisor) fire(sc *schedule) {
+	s.slock.Lock()
+	active := s.activeRuns(sc)
+	launch := s.launcher
+	s.slock.Unlock()
+
+	switch {
+	case len(active) == 0:
+	case sc.Concurrency == ConcurrencyForbid:
+		log.Info().Str("schedule", string(sc.ID)).Msg("scheduled run skipped, the previous run is active")
+
+		s.slock.Lock()
+		sc.last, sc.lastJob, sc.lastErr = time.Now(), "", "skipped, the previous run is active"
+		s.slock.Unlock()
+		return
+	case sc.Concurrency == ConcurrencyReplace:
+		for _, id := range active {
+			log.Info().Str("schedule", string(sc.ID)).Str("id", string(id)).Msg("replacing scheduled run")
+			_, _ = s.Stop(string(id), true)
+		}
+	}
+
+	id, err := launch(sc.Schedule)
+
+	s.slock.Lock()
+	defer s.slock.Unlock()
+
+	sc.last = time.Now()
+	if err != nil {
+		log.Warn().Err(err).Str("schedule", string(sc.ID)).Msg("failed to start scheduled run")
+		sc.lastJob, sc.lastErr = "", err.Error()
+		return
+	}
+
+	log.Info().Str("schedule", string(sc.ID)).Str("id", string(id)).Msg("scheduled run started")
+	sc.lastJob, sc.lastErr = id, ""
+	sc.active = append(sc.active, id)
+
+	s.lock.Lock()
+	s.runs[id] = sc.ID
+	s.lock.Unlock()
+}
+
+// activeRuns drops the completed runs of schedule sc, and returns the active ones.
+func (s *JobSupervisor) activeRuns(sc *schedule) []job.ID {
+	// supposed to be called under s.slock
+	active := sc.active[:0]
+	for _, id := range sc.active {
+		if _, done := s.outcome(id); !done {
+			active = append(active, id)
+		}
+	}
+	sc.active = active
+	return append([]job.ID(nil), active...)
+}
+
+// details returns the schedule state snapshot.
+func (sc *schedule) details() ScheduleDetails {
+	// supposed to be called under s.slock
+	return ScheduleDetails{
+		Schedule:  sc.Schedule,
+		NextRun:   sc.next,
+		LastRun:   sc.last,
+		LastJob:   sc.lastJob,
+		LastError: sc.lastErr,
+		Active:    append([]job.ID(nil), sc.active...),
+	}
+}
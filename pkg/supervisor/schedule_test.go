@@ -0,0 +1,81 @@
+package supervisor
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/ilyazz/jobs/pkg/job"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchedulePersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedules.json")
+	noop := func(Schedule) (job.ID, error) { return "", nil }
+
+	s := New(1000, 1000)
+	assert.NoError(t, s.UseSchedules(path, noop))
+
+	_, err := s.CreateSchedule(Schedule{Cron: "61 * * * *"})
+	assert.ErrorIs(t, err, ErrInvalidSchedule)
+	_, err = s.CreateSchedule(Schedule{Cron: "@hourly", Concurrency: "sometimes"})
+	assert.ErrorIs(t, err, ErrInvalidSchedule)
+
+	d1, err := s.CreateSchedule(Schedule{Cron: "@hourly", Owner: "alice", Job: []byte("ls")})
+	assert.NoError(t, err)
+	assert.Equal(t, ConcurrencyAllow, d1.Concurrency)
+	assert.False(t, d1.NextRun.IsZero())
+	d2, err := s.CreateSchedule(Schedule{Cron: "*/5 * * * *", Concurrency: ConcurrencyForbid, Job: []byte("date")})
+	assert.NoError(t, err)
+	assert.NoError(t, s.DeleteSchedule(d2.ID))
+	assert.ErrorIs(t, s.DeleteSchedule(d2.ID), ErrScheduleNotFound)
+
+	s.StopSupervisor()
+
+	// a server restart
+	s = New(1000, 1000)
+	assert.NoError(t, s.UseSchedules(path, noop))
+	defer s.StopSupervisor()
+
+	list := s.ListSchedules()
+	if assert.Len(t, list, 1) {
+		assert.Equal(t, d1.ID, list[0].ID)
+		assert.Equal(t, "alice", list[0].Owner)
+		assert.Equal(t, []byte("ls"), list[0].Job)
+	}
+}
+
+func TestScheduleConcurrency(t *testing.T) {
+	// the runs stay queued, so they're active
+	s := fullSupervisor(t, Capacity{MaxJobs: 1})
+	launch := func(sc Schedule) (job.ID, error) {
+		return s.Start(Spec{Command: string(sc.Job), Owner: sc.Owner})
+	}
+	assert.NoError(t, s.UseSchedules("", launch))
+
+	for _, policy := range []ConcurrencyPolicy{ConcurrencyAllow, ConcurrencyForbid, ConcurrencyReplace} {
+		d, err := s.CreateSchedule(Schedule{Cron: "@yearly", Concurrency: policy, Job: []byte("ls")})
+		assert.NoError(t, err)
+
+		sc := s.schedules[d.ID]
+		s.fire(sc)
+		first := sc.lastJob
+		s.fire(sc)
+
+		jd, err := s.Inspect(string(first))
+		assert.NoError(t, err)
+		assert.Equal(t, string(d.ID), jd.Schedule)
+
+		switch policy {
+		case ConcurrencyAllow:
+			assert.Len(t, sc.active, 2)
+		case ConcurrencyForbid:
+			assert.Equal(t, []job.ID{first}, sc.active)
+			assert.NotEmpty(t, sc.lastErr)
+		case ConcurrencyReplace:
+			assert.Equal(t, job.StatusStopped, jd.Status)
+			s.slock.Lock()
+			assert.Len(t, s.activeRuns(sc), 1)
+			s.slock.Unlock()
+		}
+	}
+}
@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"strings"
 	"sync"
 	"time"
 
@@ -24,13 +23,103 @@ type JobSupervisor struct {
 
 	// ids - uid/gid used by supervisor to run job processes
 	ids job.ExecIdentity
+
+	// idPool allocates user namespace ID ranges. nil if jobs share the host user namespace
+	idPool *IDPool
+	// idRanges are the ID ranges of the jobs
+	idRanges map[job.ID]job.IDRange
+
+	// capacity limits the running jobs. No limits if zero
+	capacity Capacity
+	// running are the capacity demands of the started jobs, until they complete
+	running map[job.ID]demand
+	// queue are the jobs waiting to start, in the start order
+	queue []*entry
+	// pending are the jobs that have not started: waiting, starting, cancelled or failed to start
+	pending map[job.ID]*entry
+	// accounts are the owners and the requested resources of the started jobs, until they're removed
+	accounts map[job.ID]account
+
+	// plock guards the pipelines and the array jobs. Taken before lock, if both are needed
+	plock sync.Mutex
+	// pipelines are the submitted pipelines
+	pipelines map[PipelineID]*pipeline
+	// stepJobs are the pipelines of the step jobs
+	stepJobs map[job.ID]*pipeline
+	// arrays are the submitted array jobs
+	arrays map[job.ID]*array
+	// taskArrays are the array jobs of the task jobs
+	taskArrays map[job.ID]arrayRef
+
+	// slock guards the schedules. Taken before lock, if both are needed
+	slock sync.Mutex
+	// schedules are the job schedules
+	schedules map[ScheduleID]*schedule
+	// scheduleFile is where the schedules are persisted. Not persisted if empty
+	scheduleFile string
+	// launcher starts the scheduled runs. Schedules are disabled if nil
+	launcher Launcher
+	// runs are the schedules of the scheduled jobs, until they're removed. Guarded by lock
+	runs map[job.ID]ScheduleID
+
+	// retention limits the completed jobs kept
+	retention Retention
+	// removed is called for each job the reaper removes
+	removed RemoveHook
+	// reapStop stops the reaper. nil if it's not running
+	reapStop chan struct{}
+	// reap wakes the reaper up
+	reap chan struct{}
 }
 
-// Remove all job artifacts, and the unlinks the job id from supervisor
+// Remove all job artifacts, and the unlinks the job id from supervisor. Removing an array job removes its tasks
 func (s *JobSupervisor) Remove(id string) error {
+	jid := job.ID(id)
+	if ok, err := s.removeArray(jid); ok {
+		return err
+	}
+
+	// the pipeline records the job outcome first
+	s.plock.Lock()
+	p, step := s.stepJobs[jid]
+	if step {
+		s.advance(p)
+	}
+	s.plock.Unlock()
+
+	if err := s.removeJob(jid); err != nil {
+		return err
+	}
+	if !step {
+		return nil
+	}
+
+	s.lock.RLock()
+	removed := s.removed
+	s.lock.RUnlock()
+
+	for _, id := range s.removeEmptyPipelines(map[*pipeline]bool{p: true}) {
+		if removed != nil {
+			removed(job.ID(id))
+		}
+	}
+	return nil
+}
+
+// removeJob removes job jid.
+func (s *JobSupervisor) removeJob(jid job.ID) error {
 	s.lock.Lock()
 	// intentionally no defer unlock. see comment below
-	jid := job.ID(id)
+
+	if e, ok := s.pending[jid]; ok {
+		defer s.lock.Unlock()
+		if e.state == entryWaiting || e.state == entryStarting {
+			return ErrQueued
+		}
+		delete(s.pending, jid)
+		delete(s.runs, jid)
+		return nil
+	}
 
 	j, ok := s.jobs[jid]
 	if !ok {
@@ -42,24 +131,49 @@ func (s *JobSupervisor) Remove(id string) error {
 		return fmt.Errorf("job is still running")
 	}
 
+	// the account goes with the job, so that the job usage is never seen without the job
+	a, accounted := s.accounts[jid]
 	delete(s.jobs, jid)
+	delete(s.accounts, jid)
 	// j.Cleanup() can take a while, don't block other operations and release the lock here
 	s.lock.Unlock()
 
 	err := j.Cleanup()
 	if err != nil {
 		// cleanup failed. put the job back
-		s.add(j)
+		s.lock.Lock()
+		s.jobs[jid] = j
+		if accounted {
+			s.accounts[jid] = a
+		}
+		s.lock.Unlock()
 		return err
 	}
 
+	s.releaseIDs(jid)
+	s.forget(jid)
 	return nil
 }
 
 // New creates s new job supervisor. All jobs will be run with uid/gid credentials
 func New(uid, gid int) *JobSupervisor {
 	return &JobSupervisor{
-		jobs: make(map[job.ID]*job.Job),
+		jobs:     make(map[job.ID]*job.Job),
+		idRanges: make(map[job.ID]job.IDRange),
+		running:  make(map[job.ID]demand),
+		pending:  make(map[job.ID]*entry),
+		accounts: make(map[job.ID]account),
+
+		pipelines:  make(map[PipelineID]*pipeline),
+		stepJobs:   make(map[job.ID]*pipeline),
+		arrays:     make(map[job.ID]*array),
+		taskArrays: make(map[job.ID]arrayRef),
+
+		schedules: make(map[ScheduleID]*schedule),
+		runs:      make(map[job.ID]ScheduleID),
+
+		reap: make(chan struct{}, 1),
+
 		ids: job.ExecIdentity{
 			UID: uid,
 			GID: gid,
@@ -67,28 +181,216 @@ func New(uid, gid int) *JobSupervisor {
 	}
 }
 
-// Start a new job with given parameters
-func (s *JobSupervisor) Start(cmd string, args []string, limits job.ExecLimits) (job.ID, error) {
-	j, err := createJob(cmd, args, limits, s.ids)
-	if err != nil {
-		log.Warn().Err(err).Str("cmd", cmd).Msg("failed to start the job")
+// UseUserNS makes the supervisor run new jobs in their own user namespaces,
+// with ID ranges allocated from pool p.
+func (s *JobSupervisor) UseUserNS(p *IDPool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.idPool = p
+}
+
+// releaseIDs returns the ID range of removed job id to the pool.
+func (s *JobSupervisor) releaseIDs(id job.ID) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	r, ok := s.idRanges[id]
+	if !ok {
+		return
+	}
+	delete(s.idRanges, id)
+	s.idPool.Put(r)
+}
+
+// Spec describes a job to start.
+type Spec struct {
+	// Command is the job command, without args
+	Command string
+	// Args are the job command arguments
+	Args []string
+	// Limits are the job resource limits
+	Limits job.ExecLimits
+	// PressureTriggers are PSI thresholds to watch
+	PressureTriggers []job.PressureTrigger
+	// Rlimits are POSIX resource limits of the job process
+	Rlimits []job.Rlimit
+	// RootFS is the job root filesystem directory. The host root is used if empty
+	RootFS string
+	// Volumes are host paths to bind-mount into the job
+	Volumes []job.Mount
+	// Network is the job network mode
+	Network job.NetMode
+	// Endpoint connects the job to the host network in job.NetBridge mode
+	Endpoint job.Network
+	// IDs are the job process UID/GID. The supervisor ones are used if nil
+	IDs *job.ExecIdentity
+	// Seccomp is the syscall filtering profile name. No filtering if empty
+	Seccomp string
+	// SeccompPath is the profile file. The built-in profile is used if empty
+	SeccompPath string
+	// Caps are the capabilities the job keeps. All the others are dropped
+	Caps []job.Capability
+	// Namespaces are the optional namespaces of the job. job.DefaultNamespaces if nil
+	Namespaces []job.Namespace
+	// Hostname is the job hostname. The job ID if empty
+	Hostname string
+	// Controllers are the cgroup controllers enabled for the job. job.DefaultControllers if nil
+	Controllers []string
+	// BaseDir is where the job directory is created. The job package default if empty
+	BaseDir string
+	// Shim is the shim binary. The job package default if empty
+	Shim string
+	// Restart is the job restart policy. The job never restarts if the mode is empty
+	Restart job.RestartPolicy
+	// Priority orders the queue if it's QueuePriority: higher first
+	Priority int
+	// Preempt allows stopping running jobs with lower priorities, if the job doesn't fit the capacity.
+	// Effective if the queue is QueuePriority
+	Preempt bool
+	// Owner is the client who started the job, to account the job usage
+	Owner string
+	// Env are extra environment variables of the job command, KEY=VALUE each
+	Env []string
+	// TTL is how long the job is kept once it's completed. The retention TTL is used if 0
+	TTL time.Duration
+	// AutoRemove makes the reaper remove the job once it's completed
+	AutoRemove bool
+}
+
+// Start a new job with given parameters. If the job doesn't fit the capacity, or other jobs are queued
+// before it, it's queued. Errors of a queued job start are reported in its details. A job allowed to
+// preempt, with no jobs queued before it, stops the running jobs with lower priorities, if that frees
+// enough capacity for it.
+func (s *JobSupervisor) Start(spec Spec) (job.ID, error) {
+	id := newID()
+	if err := s.start(id, spec); err != nil {
 		return "", err
 	}
+	return id, nil
+}
+
+// start starts, or queues, job id.
+func (s *JobSupervisor) start(id job.ID, spec Spec) error {
+	runAs := s.ids
+	if spec.IDs != nil {
+		runAs = *spec.IDs
+	}
+
+	e := &entry{id: id, spec: spec, runAs: runAs}
+	d := demandOf(spec)
+
+	s.lock.Lock()
+	if !s.capacity.admits(d) {
+		s.lock.Unlock()
+		return ErrExceedsCapacity
+	}
+
+	if s.ahead(spec.Priority) > 0 || !s.capacity.fits(d, s.running) {
+		var victims []*job.Job
+		// the freed capacity goes to the head of the queue, so only the job getting there preempts
+		if spec.Preempt && s.capacity.Order == QueuePriority && s.ahead(spec.Priority) == 0 {
+			victims = s.preempt(e)
+		}
+		s.enqueue(e)
+		s.lock.Unlock()
+
+		log.Info().Str("id", string(e.id)).Str("cmd", spec.Command).Msg("job queued")
+		stopPreempted(victims)
+		return nil
+	}
+
+	s.running[e.id] = d
+	s.lock.Unlock()
+
+	if err := s.launch(e); err != nil {
+		// the queued jobs may fit into the reserved capacity
+		s.dispatch()
+		return err
+	}
+	return nil
+}
+
+// launch starts job e with the capacity reserved. The capacity is released if the job fails to start,
+// or once it completes.
+func (s *JobSupervisor) launch(e *entry) error {
+	id, spec := e.id, e.spec
+
+	s.lock.RLock()
+	pool := s.idPool
+	s.lock.RUnlock()
+
+	var ids *job.IDRange
+	if pool != nil {
+		r, err := pool.Get()
+		if err != nil {
+			s.release(id)
+			return err
+		}
+		ids = &r
+	}
+
+	j, err := createJob(id, spec, e.runAs, ids)
+	if err != nil {
+		if ids != nil {
+			pool.Put(*ids)
+		}
+		log.Warn().Err(err).Str("cmd", spec.Command).Msg("failed to start the job")
+		s.release(id)
+		return err
+	}
 
 	s.lock.Lock()
-	defer s.lock.Unlock()
 	s.jobs[j.ID] = j
+	if ids != nil {
+		s.idRanges[j.ID] = *ids
+	}
+	s.accounts[j.ID] = account{owner: spec.Owner, demand: demandOf(spec), origin: e}
+	delete(s.pending, j.ID)
+	s.lock.Unlock()
+
+	go s.watch(j)
 
-	return j.ID, nil
+	return nil
 }
 
 // StopSupervisor ends all current jobs
 // first, it initiates graceful stop with 10 sec timeout
 // then it wait for all jobs to stop, and cleans them up
 func (s *JobSupervisor) StopSupervisor() {
+	// no more scheduled runs. The schedules stay persisted
+	s.slock.Lock()
+	for _, sc := range s.schedules {
+		close(sc.stop)
+	}
+	s.schedules = make(map[ScheduleID]*schedule)
+	s.launcher = nil
+	s.slock.Unlock()
+
+	// no more array tasks
+	s.plock.Lock()
+	for _, a := range s.arrays {
+		a.stopped = true
+	}
+	s.plock.Unlock()
+
 	s.lock.Lock()
 	defer s.lock.Unlock()
 
+	if s.reapStop != nil {
+		close(s.reapStop)
+		s.reapStop = nil
+	}
+
+	// nothing else starts
+	for _, e := range s.queue {
+		e.state = entryCancelled
+	}
+	s.queue = nil
+	for _, a := range s.accounts {
+		a.origin.preempted = false
+	}
+
 	var wg sync.WaitGroup
 	for _, j := range s.jobs {
 		_ = j.InitStop(10 * time.Second)
@@ -106,14 +408,32 @@ func (s *JobSupervisor) StopSupervisor() {
 }
 
 func (s *JobSupervisor) Stop(id string, graceful bool) (any, error) {
-	s.lock.RLock()
-	defer s.lock.RUnlock()
+	if ok, err := s.stopArray(job.ID(id), graceful); ok {
+		return nil, err
+	}
+
+	if ok, err := s.cancel(job.ID(id)); ok {
+		if err == nil {
+			s.completed(job.ID(id))
+			// the jobs behind may fit now
+			s.dispatch()
+		}
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
 
 	j, ok := s.jobs[job.ID(id)]
 	if !ok {
 		return nil, ErrNotFound
 	}
 
+	if a, ok := s.accounts[j.ID]; ok && !j.Completed() {
+		// stopped by the client, not to be queued again
+		a.origin.preempted = false
+	}
+
 	var err error
 	if graceful {
 		err = j.InitStop(30 * time.Second)
@@ -127,27 +447,65 @@ func (s *JobSupervisor) Stop(id string, graceful bool) (any, error) {
 	return nil, err
 }
 
-// Inspect returns job details: status, exit code and command
-// TODO get rid of 4 ret values, add a structure
-func (s *JobSupervisor) Inspect(id string) (job.Status, int32, string, error) {
+// Inspect returns job details: status, exit code, command etc. The details of an array job
+// aggregate the task states
+func (s *JobSupervisor) Inspect(id string) (job.Details, error) {
+	if d, ok := s.inspectArray(job.ID(id)); ok {
+		return d, nil
+	}
+
+	d, err := s.inspect(job.ID(id))
+	if err != nil {
+		return d, err
+	}
+	s.taskOf(job.ID(id), &d)
+	return d, nil
+}
+
+// inspect returns the details of job id, not an array job.
+func (s *JobSupervisor) inspect(id job.ID) (job.Details, error) {
 	s.lock.RLock()
-	defer s.lock.RUnlock()
 
-	j, ok := s.jobs[job.ID(id)]
+	if e, ok := s.pending[id]; ok {
+		defer s.lock.RUnlock()
+		d := e.details(s.position(e.id))
+		d.Schedule = string(s.runs[e.id])
+		return d, nil
+	}
+
+	j, ok := s.jobs[id]
 	if !ok {
-		return 0, 0, "", ErrNotFound
+		s.lock.RUnlock()
+		return job.Details{}, ErrNotFound
 	}
-	st, code := j.Status()
 
-	cmd := append([]string{j.Command}, j.Args...)
-	return st, int32(code), strings.Join(cmd, " "), nil
+	var preemptions []job.Preemption
+	if a, ok := s.accounts[j.ID]; ok {
+		preemptions = append(preemptions, a.origin.preemptions...)
+	}
+	schedule := string(s.runs[j.ID])
+	// j.Details() may walk the job working directory, don't block other operations meanwhile
+	s.lock.RUnlock()
+
+	d := j.Details()
+	d.Preemptions = preemptions
+	d.Schedule = schedule
+	return d, nil
 }
 
 // Logs returns log reader for job id
 func (s *JobSupervisor) Logs(id string) (io.ReadCloser, error) {
+	if s.isArray(job.ID(id)) {
+		return nil, ErrArrayJob
+	}
+
 	s.lock.RLock()
 	defer s.lock.RUnlock()
 
+	if _, ok := s.pending[job.ID(id)]; ok {
+		return nil, ErrQueued
+	}
+
 	j, ok := s.jobs[job.ID(id)]
 	if !ok {
 		return nil, ErrNotFound
@@ -156,6 +514,69 @@ func (s *JobSupervisor) Logs(id string) (io.ReadCloser, error) {
 	return j.Logs()
 }
 
+// AttemptLogs returns log reader for attempt n of job id, starting with 1
+func (s *JobSupervisor) AttemptLogs(id string, n int) (io.ReadCloser, error) {
+	if s.isArray(job.ID(id)) {
+		return nil, ErrArrayJob
+	}
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if _, ok := s.pending[job.ID(id)]; ok {
+		return nil, ErrQueued
+	}
+
+	j, ok := s.jobs[job.ID(id)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return j.AttemptLogs(n)
+}
+
+// Exec starts a command in running job id
+func (s *JobSupervisor) Exec(id string, command string, args []string, stdin io.Reader, stdout, stderr io.Writer) (*job.Process, error) {
+	if s.isArray(job.ID(id)) {
+		return nil, ErrArrayJob
+	}
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if _, ok := s.pending[job.ID(id)]; ok {
+		return nil, job.ErrNotRunning
+	}
+
+	j, ok := s.jobs[job.ID(id)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return j.Exec(command, args, stdin, stdout, stderr)
+}
+
+// Processes lists the processes of running job id
+func (s *JobSupervisor) Processes(id string) ([]job.ProcessInfo, error) {
+	if s.isArray(job.ID(id)) {
+		return nil, ErrArrayJob
+	}
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if _, ok := s.pending[job.ID(id)]; ok {
+		return nil, job.ErrNotRunning
+	}
+
+	j, ok := s.jobs[job.ID(id)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return j.Processes()
+}
+
 // remove deletes the job id from internal storage
 func (s *JobSupervisor) remove(id string) (*job.Job, error) {
 	s.lock.Lock()
@@ -189,13 +610,79 @@ func (s *JobSupervisor) Cleanup(id string) error {
 		return err
 	}
 
+	s.releaseIDs(j.ID)
+	s.forget(j.ID)
 	return nil
 }
 
-// createJob is an internal wrapper for job.New(..)
-func createJob(cmd string, args []string, limits job.ExecLimits, ids job.ExecIdentity) (*job.Job, error) {
-	return job.New(cmd, args,
+// createJob is an internal wrapper for job.New(..). The job runs in its own user namespace,
+// if userNS is set
+func createJob(id job.ID, spec Spec, ids job.ExecIdentity, userNS *job.IDRange) (*job.Job, error) {
+	limits := spec.Limits
+	opts := []job.Option{
+		job.JobID(id),
 		job.CPU(limits.CPU), job.Mem(limits.MaxRAMBytes), job.IO(limits.MaxDiskIOBytes),
-		job.UID(ids.UID), job.GID(ids.GID),
-		job.Log(zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339}).With().Timestamp().Logger()))
+		job.MemHigh(limits.HighRAMBytes), job.MemLow(limits.LowRAMBytes), job.MemMin(limits.MinRAMBytes),
+		job.IOWeight(limits.IOWeight), job.Disk(limits.MaxDiskBytes),
+		job.UID(ids.UID), job.GID(ids.GID), job.Rlimits(spec.Rlimits...), job.RootFS(spec.RootFS),
+		job.Net(spec.Network, spec.Endpoint),
+		job.Log(zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339}).With().Timestamp().Logger()),
+	}
+
+	if limits.MaxSwapBytes != nil {
+		opts = append(opts, job.Swap(*limits.MaxSwapBytes))
+	}
+	for _, d := range limits.Devices {
+		opts = append(opts, job.DeviceIO(d))
+	}
+
+	for _, t := range spec.PressureTriggers {
+		opts = append(opts, job.Trigger(t))
+	}
+
+	for _, m := range spec.Volumes {
+		opts = append(opts, job.Volume(m))
+	}
+
+	if userNS != nil {
+		opts = append(opts, job.UserNS(*userNS))
+	}
+
+	if spec.Seccomp != "" {
+		opts = append(opts, job.Seccomp(spec.Seccomp, spec.SeccompPath))
+	}
+
+	if len(spec.Caps) > 0 {
+		opts = append(opts, job.Caps(spec.Caps...))
+	}
+
+	if spec.Namespaces != nil {
+		opts = append(opts, job.Namespaces(spec.Namespaces...))
+	}
+
+	if spec.Hostname != "" {
+		opts = append(opts, job.Hostname(spec.Hostname))
+	}
+
+	if spec.Controllers != nil {
+		opts = append(opts, job.Controllers(spec.Controllers...))
+	}
+
+	if spec.BaseDir != "" {
+		opts = append(opts, job.BaseDir(spec.BaseDir))
+	}
+
+	if spec.Shim != "" {
+		opts = append(opts, job.Shim(spec.Shim))
+	}
+
+	if spec.Restart.Mode != "" {
+		opts = append(opts, job.Restart(spec.Restart))
+	}
+
+	if len(spec.Env) > 0 {
+		opts = append(opts, job.Env(spec.Env...))
+	}
+
+	return job.New(spec.Command, spec.Args, opts...)
 }
@@ -0,0 +1,82 @@
+package supervisor
+
+import "github.com/ilyazz/jobs/pkg/job"
+
+// Usage is what the jobs of an owner hold.
+type Usage struct {
+	// Active is the number of running and queued jobs, and pipeline steps not started yet
+	Active int
+	// CPU is the total CPU limit of the active jobs
+	CPU float32
+	// Memory is the total memory limit of the active jobs, in bytes
+	Memory int64
+	// Retained is the number of completed jobs, not removed yet
+	Retained int
+}
+
+// account is the owner of a started job, and its requested resources.
+type account struct {
+	owner  string
+	demand demand
+	// origin is the start request, to queue the job again if it's preempted
+	origin *entry
+}
+
+// Usage returns what the jobs of owner hold. The pipeline steps are reserved until they start, or the
+// pipeline is cancelled.
+func (s *JobSupervisor) Usage(owner string) Usage {
+	s.plock.Lock()
+	defer s.plock.Unlock()
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	var rt Usage
+	for _, p := range s.pipelines {
+		for _, st := range p.steps {
+			if st.state == StepWaiting && st.Spec.Owner == owner {
+				rt.add(demandOf(st.Spec))
+			}
+		}
+	}
+	for id, a := range s.accounts {
+		j, ok := s.jobs[id]
+		// being removed
+		if a.owner != owner || !ok {
+			continue
+		}
+		if j.Completed() {
+			rt.Retained++
+			continue
+		}
+		rt.add(a.demand)
+	}
+
+	for _, e := range s.pending {
+		if e.spec.Owner != owner {
+			continue
+		}
+		if e.state == entryCancelled || e.state == entryFailed {
+			rt.Retained++
+			continue
+		}
+		rt.add(demandOf(e.spec))
+	}
+
+	return rt
+}
+
+// add counts an active job with demand d.
+func (u *Usage) add(d demand) {
+	u.Active++
+	u.CPU += d.cpu
+	u.Memory += d.mem
+}
+
+// forget drops the account of removed job id.
+func (s *JobSupervisor) forget(id job.ID) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.accounts, id)
+	delete(s.runs, id)
+}